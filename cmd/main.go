@@ -1,15 +1,19 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"flag"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
-	"sync"
 	"syscall"
+	"time"
 
 	"answers-processor/config"
 	websocket "answers-processor/internal/delivery"
+	"answers-processor/internal/delivery/admin"
 	consumer "answers-processor/internal/infrastructure/rabbitmq/consumer"
 	publisher "answers-processor/internal/infrastructure/rabbitmq/publisher"
 	"answers-processor/internal/repository"
@@ -18,44 +22,153 @@ import (
 	"answers-processor/pkg/logger"
 )
 
+// shutdownTimeout bounds how long open HTTP requests may take to finish.
+const shutdownTimeout = 10 * time.Second
+
 func main() {
+	os.Exit(run())
+}
+
+// run starts the processor and serves until SIGINT or SIGTERM. Its deferred
+// calls are the shutdown sequence, so it returns instead of exiting.
+func run() int {
+	configPath := flag.String("config", "", "path to the YAML config file, defaults to $CONFIG_PATH or config.yaml")
+	flag.Parse()
+
 	// Load the configuration
-	cfg := config.LoadConfig()
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
 
 	// Set up the logger
 	logInstance, err := logger.SetupLogger(cfg.Env)
 	if err != nil {
 		log.Fatalf("Failed to set up logger: %v", err)
-		os.Exit(1)
+	}
+	if err := logInstance.SetLevel(cfg.LogLevel); err != nil {
+		log.Fatalf("Failed to set log level: %v", err)
 	}
 
 	// Initialize the repository
-	repository.Init(logInstance)
+	dialect, err := db.LookupDialect(cfg.Database.Driver)
+	if err != nil {
+		logInstance.ErrorLogger.Error("Invalid database configuration", "error", err)
+		return 1
+	}
+	repository.Init(logInstance, cfg.Database.QueryTimeout, dialect)
+	repository.SetConsistentReadsOnPrimary(!cfg.Database.ReplicaConsistentReads)
 
-	// Connect to the database
-	dbInstance, err := db.NewDatabase(cfg.Database.Addr)
+	// Connect to the database; DATETIME columns hold business-timezone wall-clock times
+	location, err := time.LoadLocation(cfg.Dates.Timezone)
+	if err != nil {
+		logInstance.ErrorLogger.Error("Invalid business timezone", "timezone", cfg.Dates.Timezone, "error", err)
+		return 1
+	}
+	dbOptions := db.Options{
+		DriverName:        cfg.Database.DriverName,
+		MaxOpenConns:      cfg.Database.MaxOpenConns,
+		MaxIdleConns:      cfg.Database.MaxIdleConns,
+		ConnMaxLifetime:   cfg.Database.ConnMaxLifetime,
+		ConnMaxIdleTime:   cfg.Database.ConnMaxIdleTime,
+		ConnectAttempts:   cfg.Database.ConnectAttempts,
+		ConnectBackoff:    cfg.Database.ConnectBackoff,
+		MaxConnectBackoff: cfg.Database.MaxConnectBackoff,
+	}
+	dbInstance, err := db.NewDatabase(dialect, cfg.Database.Addr, location, dbOptions, logInstance)
 	if err != nil {
-		logInstance.ErrorLogger.Error("Failed to connect to MySQL", "error", err)
-		os.Exit(1)
+		logInstance.ErrorLogger.Error("Failed to connect to the database", "error", err)
+		return 1
 	}
 	defer dbInstance.Close()
 
+	// Lookups go to the read replica when one is configured
+	var replicaInstance *sql.DB
+	if cfg.Database.ReplicaAddr != "" {
+		replicaInstance, err = db.NewDatabase(dialect, cfg.Database.ReplicaAddr, location, dbOptions, logInstance)
+		if err != nil {
+			logInstance.ErrorLogger.Error("Failed to connect to the read replica", "error", err)
+			return 1
+		}
+		defer replicaInstance.Close()
+	}
+
+	// Pause consumption while the database is unhealthy
+	breaker := db.NewBreaker(dbInstance, cfg.Database.HealthInterval, cfg.Database.FailureThreshold, logInstance)
+	breaker.Start()
+	defer breaker.Stop()
+	db.PublishStats(dbInstance, replicaInstance, breaker)
+
 	logInstance.InfoLogger.Info("Database connection successfully established.")
 
+	// Without the unique index, concurrent first messages from a phone create
+	// duplicate clients and per-client limits stop holding
+	unique, err := repository.HasUniqueIndex(context.Background(), dbInstance, "clients", "phone")
+	if err != nil {
+		logInstance.ErrorLogger.Error("Failed to check the clients phone index", "error", err)
+		return 1
+	}
+	if !unique {
+		logInstance.ErrorLogger.Error("clients.phone has no unique index; run cmd/mergeclients, then the 004_clients_phone_unique.sql migration of the dialect",
+			"migrations", "migrations/"+dialect.Name())
+		return 1
+	}
+
 	// Initialize the WebSocket server
-	wsServer := websocket.NewWebSocketServer(logInstance)
+	privacy, err := websocket.NewPrivacy(cfg.WebSocket.Policies, cfg.WebSocket.PseudonymKey, cfg.WebSocket.OperatorTokens)
+	if err != nil {
+		logInstance.ErrorLogger.Error("Invalid WebSocket privacy configuration", "error", err)
+		return 1
+	}
+	wsServer := websocket.NewWebSocketServer(logInstance, privacy)
+	defer wsServer.Shutdown() // after the service stops broadcasting
 	logInstance.InfoLogger.Info("WebSocket server initialized.")
 
 	// Initialize RabbitMQ publisher
 	rabbitmqPublisher, err := publisher.NewRabbitmqPublisher(cfg, logInstance)
 	if err != nil {
 		logInstance.ErrorLogger.Error("Failed to create RabbitMQ publisher client", "error", err)
-		os.Exit(1)
+		return 1
 	}
 	defer rabbitmqPublisher.Close()
 
 	// Initialize the service with the database, publisher, and WebSocket server
-	serviceInstance := service.NewService(dbInstance, rabbitmqPublisher, wsServer, logInstance)
+	serviceInstance, err := service.NewService(cfg, dbInstance, replicaInstance, rabbitmqPublisher, wsServer, logInstance)
+	if err != nil {
+		logInstance.ErrorLogger.Error("Failed to initialize service", "error", err)
+		return 1
+	}
+
+	unknownTypes, err := serviceInstance.CheckAccountTypes(context.Background())
+	if err != nil {
+		logInstance.ErrorLogger.Error("Failed to check account types", "error", err)
+	} else if len(unknownTypes) > 0 {
+		logInstance.ErrorLogger.Error("Accounts use types without a registered strategy", "account_types", unknownTypes)
+	}
+
+	if err := serviceInstance.Start(); err != nil {
+		logInstance.ErrorLogger.Error("Failed to start service", "error", err)
+		return 1
+	}
+	defer serviceInstance.Stop()
+
+	// Apply reloadable settings on SIGHUP or when the config file changes
+	reloader := config.NewReloader(*configPath, cfg, logInstance)
+	reloader.Subscribe(func(cfg *config.Config) {
+		if err := logInstance.SetLevel(cfg.LogLevel); err != nil {
+			logInstance.ErrorLogger.Error("Failed to set log level", "error", err)
+		}
+	})
+	reloader.Subscribe(serviceInstance.Reload)
+	reloader.Start()
+	defer reloader.Stop()
+
+	// Initialize the operator API
+	lotteryDraws := service.NewLotteryDraws(&repository.LotteryRepository{DB: dbInstance}, wsServer, logInstance)
+	wallModeration := service.NewWallModeration(&repository.WallRepository{DB: dbInstance}, wsServer, logInstance)
+	quarantine := service.NewQuarantine(&repository.QuarantineRepository{DB: dbInstance}, serviceInstance, logInstance)
+	shopOrders := service.NewShopOrders(&repository.ShopRepository{DB: dbInstance}, wsServer, logInstance)
+	adminHandler := admin.NewHandler(lotteryDraws, wallModeration, quarantine, shopOrders, cfg.WebSocket.OperatorTokens, logInstance)
 
 	// Initialize RabbitMQ consumer
 	rabbitmqConsumer, err := consumer.NewRabbitMQConsumer(
@@ -63,12 +176,15 @@ func main() {
 		cfg.RabbitMQ.Consumer.ExchangeName,
 		cfg.RabbitMQ.Consumer.QueueName,
 		cfg.RabbitMQ.Consumer.RoutingKey,
+		cfg.RabbitMQ.ControlExchange,
+		cfg.RabbitMQ.Prefetch,
 		logInstance,
 		serviceInstance,
+		breaker,
 	)
 	if err != nil {
 		logInstance.ErrorLogger.Error("Failed to initialize RabbitMQ consumer client", "error", err)
-		os.Exit(1)
+		return 1
 	}
 	defer rabbitmqConsumer.Close()
 
@@ -76,9 +192,20 @@ func main() {
 
 	go wsServer.HandleMessages()
 
-	http.HandleFunc("/ws/quiz", wsServer.HandleConnections)
-	http.HandleFunc("/ws/voting", wsServer.HandleConnections)
-	http.HandleFunc("/ws/shop", wsServer.HandleConnections)
+	// A mux of our own keeps /debug/vars, registered on the default mux by
+	// expvar, off the public port; metrics are served behind the operator API
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws/quiz", wsServer.HandleConnections)
+	mux.HandleFunc("/ws/voting", wsServer.HandleConnections)
+	mux.HandleFunc("/ws/shop", wsServer.HandleConnections)
+	mux.HandleFunc("/ws/auction", wsServer.HandleConnections)
+	mux.HandleFunc("/ws/lottery", wsServer.HandleConnections)
+	mux.HandleFunc("/ws/survey", wsServer.HandleConnections)
+	mux.HandleFunc("/ws/wall", wsServer.HandleConnections)
+	mux.Handle("/admin/", adminHandler)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
 	go func() {
 		logInstance.InfoLogger.Info("Starting to consume messages from RabbitMQ")
@@ -86,44 +213,27 @@ func main() {
 	}()
 
 	logInstance.InfoLogger.Info("Starting WebSocket server")
-	if err := http.ListenAndServe(cfg.WebSocket.Addr, nil); err != nil {
-		logInstance.ErrorLogger.Error("Failed to start server", "error", err)
-		os.Exit(1)
-	}
-
-	// Handle graceful shutdown
-	handleGracefulShutdown(rabbitmqConsumer, rabbitmqPublisher, wsServer, logInstance)
-}
-
-func handleGracefulShutdown(rabbitmqConsumer *consumer.RabbitMQConsumer, rabbitmqPublisher publisher.MessagePublisher, wsServer websocket.Handler, logInstance *logger.Loggers) {
-	sigs := make(chan os.Signal, 1)
-	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
-
-	<-sigs
-
-	logInstance.InfoLogger.Info("Received shutdown signal, initiating graceful shutdown...")
-
-	var wg sync.WaitGroup
-
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		rabbitmqConsumer.Close()
-	}()
-
-	wg.Add(1)
+	server := &http.Server{Addr: cfg.WebSocket.Addr, Handler: mux}
+	serveErr := make(chan error, 1)
 	go func() {
-		defer wg.Done()
-		rabbitmqPublisher.Close()
+		serveErr <- server.ListenAndServe()
 	}()
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		wsServer.Shutdown()
-	}()
+	select {
+	case err := <-serveErr:
+		logInstance.ErrorLogger.Error("Failed to start server", "error", err)
+		return 1
+	case <-ctx.Done():
+	}
 
-	wg.Wait()
+	logInstance.InfoLogger.Info("Received shutdown signal, initiating graceful shutdown...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logInstance.ErrorLogger.Error("Failed to shut down server", "error", err)
+	}
 
-	logInstance.InfoLogger.Info("Graceful shutdown complete.")
+	// The deferred calls stop consuming, write buffered votes and close the
+	// publisher, the WebSocket connections and the database, in that order
+	return 0
 }
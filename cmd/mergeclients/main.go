@@ -0,0 +1,134 @@
+// Command mergeclients normalizes the phone numbers of existing clients to
+// E.164 and merges clients that turn out to be the same subscriber. Answers,
+// votes and other records of the duplicates are reassigned to the client
+// already stored with the normalized number, so client IDs cached by a
+// running processor stay valid, or else to the oldest client. Run it once
+// after deploying phone normalization and before the
+// 004_clients_phone_unique.sql migration of the database's dialect, which
+// the processor requires; -dry-run only reports what would change.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"answers-processor/config"
+	"answers-processor/internal/repository"
+	db "answers-processor/pkg/database"
+	"answers-processor/pkg/logger"
+	"answers-processor/pkg/phone"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "report merges without changing the database")
+	configPath := flag.String("config", "", "path to the YAML config file, defaults to $CONFIG_PATH or config.yaml")
+	flag.Parse()
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+
+	logInstance, err := logger.SetupLogger(cfg.Env)
+	if err != nil {
+		log.Fatalf("Failed to set up logger: %v", err)
+	}
+
+	dialect, err := db.LookupDialect(cfg.Database.Driver)
+	if err != nil {
+		logInstance.ErrorLogger.Error("Invalid database configuration", "error", err)
+		os.Exit(1)
+	}
+	// Merges can touch many rows; they are not subject to the query timeout
+	repository.Init(logInstance, 0, dialect)
+
+	location, err := time.LoadLocation(cfg.Dates.Timezone)
+	if err != nil {
+		logInstance.ErrorLogger.Error("Invalid business timezone", "timezone", cfg.Dates.Timezone, "error", err)
+		os.Exit(1)
+	}
+	dbInstance, err := db.NewDatabase(dialect, cfg.Database.Addr, location, db.Options{DriverName: cfg.Database.DriverName}, logInstance)
+	if err != nil {
+		logInstance.ErrorLogger.Error("Failed to connect to the database", "error", err)
+		os.Exit(1)
+	}
+	defer dbInstance.Close()
+
+	phones, err := phone.NewNormalizer(cfg.Phone.DefaultCountry)
+	if err != nil {
+		logInstance.ErrorLogger.Error("Invalid phone configuration", "error", err)
+		os.Exit(1)
+	}
+
+	ctx := context.Background()
+	repo := &repository.ClientRepository{DB: dbInstance}
+
+	clients, err := repo.GetClients(ctx)
+	if err != nil {
+		logInstance.ErrorLogger.Error("Failed to load clients", "error", err)
+		os.Exit(1)
+	}
+
+	// Group clients by normalized phone; clients are ordered by ID
+	groups := make(map[string][]repository.Client)
+	var order []string
+	for _, client := range clients {
+		normalized, err := phones.Normalize(client.Phone)
+		if err != nil {
+			logInstance.ErrorLogger.Error("Skipping client with invalid phone", "client_id", client.ID, "phone", client.Phone, "error", err)
+			continue
+		}
+		if _, ok := groups[normalized]; !ok {
+			order = append(order, normalized)
+		}
+		groups[normalized] = append(groups[normalized], client)
+	}
+
+	var merged, renamed int
+	for _, normalized := range order {
+		group := groups[normalized]
+		keepIndex := 0
+		for i, client := range group {
+			if client.Phone == normalized {
+				keepIndex = i
+				break
+			}
+		}
+		keep := group[keepIndex]
+
+		if len(group) == 1 {
+			if keep.Phone == normalized {
+				continue
+			}
+			renamed++
+			logInstance.InfoLogger.Info("Normalizing client phone", "client_id", keep.ID, "phone", keep.Phone, "normalized", normalized)
+			if !*dryRun {
+				if err := repo.UpdateClientPhone(ctx, keep.ID, normalized); err != nil {
+					logInstance.ErrorLogger.Error("Failed to update client phone", "client_id", keep.ID, "error", err)
+					os.Exit(1)
+				}
+			}
+			continue
+		}
+
+		duplicateIDs := make([]int64, 0, len(group)-1)
+		for i, client := range group {
+			if i != keepIndex {
+				duplicateIDs = append(duplicateIDs, client.ID)
+			}
+		}
+		merged += len(duplicateIDs)
+		logInstance.InfoLogger.Info("Merging clients", "client_id", keep.ID, "normalized", normalized, "duplicate_ids", duplicateIDs)
+		if !*dryRun {
+			if err := repo.MergeClients(ctx, keep.ID, normalized, duplicateIDs); err != nil {
+				logInstance.ErrorLogger.Error("Failed to merge clients", "client_id", keep.ID, "error", err)
+				os.Exit(1)
+			}
+		}
+	}
+
+	logInstance.InfoLogger.Info("Client merge finished", "clients", len(clients), "merged", merged, "normalized", renamed, "dry_run", *dryRun)
+}
@@ -1,57 +1,199 @@
 package config
 
 import (
-	"log"
+	"fmt"
+	"os"
+	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
 )
 
 type Config struct {
-	Env       string    `yaml:"env"`
-	Database  Database  `yaml:"database"`
-	RabbitMQ  RabbitMQ  `yaml:"rabbitmq"`
-	SMPP      SMPP      `yaml:"smpp"`
-	WebSocket WebSocket `yaml:"websocket"`
+	Env       string    `yaml:"env" env:"ENV"`
+	LogLevel  string    `yaml:"log_level" env:"LOG_LEVEL" env-default:"info"` // debug, info, warn or error
+	Database  Database  `yaml:"database" env-prefix:"DATABASE_"`
+	RabbitMQ  RabbitMQ  `yaml:"rabbitmq" env-prefix:"RABBITMQ_"`
+	SMPP      SMPP      `yaml:"smpp" env-prefix:"SMPP_"`
+	WebSocket WebSocket `yaml:"websocket" env-prefix:"WEBSOCKET_"`
+	Voting    Voting    `yaml:"voting" env-prefix:"VOTING_"`
+	Auction   Auction   `yaml:"auction" env-prefix:"AUCTION_"`
+	Shop      Shop      `yaml:"shop" env-prefix:"SHOP_"`
+	Lottery   Lottery   `yaml:"lottery" env-prefix:"LOTTERY_"`
+	Wall      Wall      `yaml:"wall" env-prefix:"WALL_"`
+	Content   Content   `yaml:"content" env-prefix:"CONTENT_"`
+	Pipeline  Pipeline  `yaml:"pipeline" env-prefix:"PIPELINE_"`
+	Dates     Dates     `yaml:"dates" env-prefix:"DATES_"`
+	Phone     Phone     `yaml:"phone" env-prefix:"PHONE_"`
+	Campaigns Campaigns `yaml:"campaigns" env-prefix:"CAMPAIGNS_"`
+	Features  Features  `yaml:"features" env-prefix:"FEATURES_"`
+	Reload    Reload    `yaml:"reload" env-prefix:"RELOAD_"`
 }
 
 type Database struct {
-	Addr string `yaml:"address"`
+	Driver       string        `yaml:"driver" env:"DRIVER" env-default:"mysql"` // mysql, postgres or sqlite
+	DriverName   string        `yaml:"driver_name" env:"DRIVER_NAME"`           // database/sql driver, defaults to the one of Driver
+	Addr         string        `yaml:"address" env:"ADDRESS"`
+	ReplicaAddr  string        `yaml:"replica_address" env:"REPLICA_ADDRESS"`              // optional read replica for lookups
+	QueryTimeout time.Duration `yaml:"query_timeout" env:"QUERY_TIMEOUT" env-default:"5s"` // per repository call, 0 disables
+
+	MaxOpenConns    int           `yaml:"max_open_conns" env:"MAX_OPEN_CONNS" env-default:"20"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" env:"MAX_IDLE_CONNS" env-default:"10"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env:"CONN_MAX_LIFETIME" env-default:"5m"` // below the server's wait_timeout; also moves connections over after a failover
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" env:"CONN_MAX_IDLE_TIME" env-default:"1m"`
+
+	ConnectAttempts   int           `yaml:"connect_attempts" env:"CONNECT_ATTEMPTS" env-default:"10"` // at startup
+	ConnectBackoff    time.Duration `yaml:"connect_backoff" env:"CONNECT_BACKOFF" env-default:"1s"`
+	MaxConnectBackoff time.Duration `yaml:"max_connect_backoff" env:"MAX_CONNECT_BACKOFF" env-default:"30s"`
+
+	ReplicaConsistentReads bool `yaml:"replica_consistent_reads" env:"REPLICA_CONSISTENT_READS"` // send has-scored and has-voted checks to the replica as well
+
+	HealthInterval   time.Duration `yaml:"health_interval" env:"HEALTH_INTERVAL" env-default:"5s"`    // 0 disables the circuit breaker
+	FailureThreshold int           `yaml:"failure_threshold" env:"FAILURE_THRESHOLD" env-default:"3"` // failed health checks before consumption pauses
 }
 
 type RabbitMQ struct {
-	URL       string      `yaml:"url"`
-	Consumer  RabbitMQKey `yaml:"consumer"`
-	Publisher RabbitMQKey `yaml:"publisher"`
+	URL       string      `yaml:"url" env:"URL"`
+	Consumer  RabbitMQKey `yaml:"consumer" env-prefix:"CONSUMER_"`
+	Publisher RabbitMQKey `yaml:"publisher" env-prefix:"PUBLISHER_"`
+	Prefetch  int         `yaml:"prefetch" env:"PREFETCH" env-default:"50"` // unacknowledged messages the consumer holds at most
+
+	// ControlExchange is a fanout exchange every instance binds a queue of
+	// its own to, so control messages reach all replicas. Empty disables it.
+	ControlExchange string `yaml:"control_exchange" env:"CONTROL_EXCHANGE"`
 }
 
 type RabbitMQKey struct {
-	ExchangeName string `yaml:"exchange_name"`
-	QueueName    string `yaml:"queue_name"`
-	RoutingKey   string `yaml:"routing_key"`
+	ExchangeName string `yaml:"exchange_name" env:"EXCHANGE_NAME"`
+	QueueName    string `yaml:"queue_name" env:"QUEUE_NAME"`
+	RoutingKey   string `yaml:"routing_key" env:"ROUTING_KEY"`
 }
 
 type SMPP struct {
-	Addr string `yaml:"address"`
-	User string `yaml:"user"`
-	Pass string `yaml:"password"`
+	Addr string `yaml:"address" env:"ADDRESS"`
+	User string `yaml:"user" env:"USER"`
+	Pass string `yaml:"password" env:"PASSWORD"`
 }
 
 type WebSocket struct {
-	Addr string `yaml:"address"`
+	Addr           string            `yaml:"address" env:"ADDRESS"`
+	Policies       map[string]string `yaml:"policies" env:"POLICIES"` // endpoint path -> masked, hashed or full
+	PseudonymKey   string            `yaml:"pseudonym_key" env:"PSEUDONYM_KEY"`
+	OperatorTokens []string          `yaml:"operator_tokens" env:"OPERATOR_TOKENS"`
+}
+
+type Voting struct {
+	ResultsInterval time.Duration `yaml:"results_interval" env:"RESULTS_INTERVAL" env-default:"500ms"`
+	BatchWindow     time.Duration `yaml:"batch_window" env:"BATCH_WINDOW" env-default:"0"` // buffer votes this long before writing them together; 0 writes each vote at once
+	BatchSize       int           `yaml:"batch_size" env:"BATCH_SIZE" env-default:"500"`   // flush earlier once this many votes are buffered
+}
+
+type Auction struct {
+	BidIncrement int64 `yaml:"bid_increment" env:"BID_INCREMENT" env-default:"1"`
+}
+
+type Shop struct {
+	ReservationTTL   time.Duration `yaml:"reservation_ttl" env:"RESERVATION_TTL"` // 0 confirms orders at once; otherwise they must be confirmed through the operator API in time
+	ExpiryInterval   time.Duration `yaml:"expiry_interval" env:"EXPIRY_INTERVAL" env-default:"1m"`
+	MaxOrderQuantity int64         `yaml:"max_order_quantity" env:"MAX_ORDER_QUANTITY" env-default:"10"`
+}
+
+type Lottery struct {
+	WrongCodeReply        string `yaml:"wrong_code_reply" env:"WRONG_CODE_REPLY" env-default:"Nadogry kod"`
+	SuggestionReply       string `yaml:"suggestion_reply" env:"SUGGESTION_REPLY" env-default:"Nadogry kod. {suggestion} kody ugratjak boldunyzmy?"`
+	MaxSuggestionDistance int    `yaml:"max_suggestion_distance" env:"MAX_SUGGESTION_DISTANCE" env-default:"2"`
+	MaxWrongCodeReplies   int    `yaml:"max_wrong_code_replies" env:"MAX_WRONG_CODE_REPLIES" env-default:"3"` // 0 disables wrong code replies
+}
+
+type Wall struct {
+	BlockedWords []string `yaml:"blocked_words" env:"BLOCKED_WORDS"`
+	Reply        string   `yaml:"reply" env:"REPLY"` // sent to the sender when set
+}
+
+type Content struct {
+	ScheduleInterval time.Duration `yaml:"schedule_interval" env:"SCHEDULE_INTERVAL" env-default:"1m"`
 }
 
-func LoadConfig() *Config {
-	configPath := "config.yaml"
+// Pipeline lists the middleware stages run around every strategy, outermost first.
+type Pipeline struct {
+	Stages         []string      `yaml:"stages" env:"STAGES" env-default:"recover,timing,resolve"` // recover, logging, timing, dedup, blocklist, ratelimit, resolve
+	MessageTimeout time.Duration `yaml:"message_timeout" env:"MESSAGE_TIMEOUT" env-default:"30s"`  // deadline for processing one message, 0 disables
+	SlowThreshold  time.Duration `yaml:"slow_threshold" env:"SLOW_THRESHOLD" env-default:"1s"`
+	DedupWindow    time.Duration `yaml:"dedup_window" env:"DEDUP_WINDOW" env-default:"10m"`
+	Blocklist      []string      `yaml:"blocklist" env:"BLOCKLIST"`
+	RateLimit      int           `yaml:"rate_limit" env:"RATE_LIMIT" env-default:"10"` // messages per client per rate_window, 0 disables
+	RateWindow     time.Duration `yaml:"rate_window" env:"RATE_WINDOW" env-default:"1m"`
+}
+
+// Dates controls how SMS dates are read. Window checks such as daily vote
+// limits use the business timezone, which is also the timezone of DATETIME
+// columns.
+type Dates struct {
+	Timezone      string        `yaml:"timezone" env:"TIMEZONE" env-default:"Local"`                    // e.g. Asia/Ashgabat
+	Layouts       []string      `yaml:"layouts" env:"LAYOUTS"`                                          // extra Go layouts tried first
+	MissingPolicy string        `yaml:"missing_policy" env:"MISSING_POLICY" env-default:"receive_time"` // receive_time or reject
+	SkewPolicy    string        `yaml:"skew_policy" env:"SKEW_POLICY" env-default:"clamp"`              // receive_time, reject or clamp
+	MaxFutureSkew time.Duration `yaml:"max_future_skew" env:"MAX_FUTURE_SKEW" env-default:"5m"`         // 0 disables the check
+	MaxPastSkew   time.Duration `yaml:"max_past_skew" env:"MAX_PAST_SKEW" env-default:"0"`              // 0 disables the check
+}
+
+type Phone struct {
+	DefaultCountry string        `yaml:"default_country" env:"DEFAULT_COUNTRY" env-default:"TM"` // ISO code used for numbers without a calling code
+	CacheSize      int           `yaml:"cache_size" env:"CACHE_SIZE" env-default:"100000"`       // phone to client ID entries kept in memory, 0 disables
+	CacheTTL       time.Duration `yaml:"cache_ttl" env:"CACHE_TTL" env-default:"10m"`
+}
+
+type Campaigns struct {
+	RefreshInterval time.Duration `yaml:"refresh_interval" env:"REFRESH_INTERVAL" env-default:"1m"` // 0 disables the campaign cache
+	Lookback        time.Duration `yaml:"lookback" env:"LOOKBACK" env-default:"1h"`                 // how far back ended campaigns are kept for late messages
+}
+
+// Features are switches operators flip during a show.
+type Features struct {
+	DisabledTypes []string `yaml:"disabled_types" env:"DISABLED_TYPES"` // account types whose messages are ignored
+}
 
-	if configPath == "" {
-		log.Fatalf("config path is not set or config file does not exist")
+// Reload controls how the settings that can change without a restart are
+// reloaded: the log level, pipeline rate limits and blocklist, lottery and
+// wall replies, wall blocked words and features. They are reloaded on SIGHUP
+// and when the config file changes.
+type Reload struct {
+	WatchInterval time.Duration `yaml:"watch_interval" env:"WATCH_INTERVAL" env-default:"10s"` // how often the config file is checked, 0 disables
+}
+
+const defaultConfigPath = "config.yaml"
+
+// ResolvePath returns the config file to read: path, else $CONFIG_PATH, else
+// config.yaml if it exists. An empty result means the configuration comes
+// from the environment alone.
+func ResolvePath(path string) string {
+	if path == "" {
+		path = os.Getenv("CONFIG_PATH")
+	}
+	if path == "" {
+		if _, err := os.Stat(defaultConfigPath); err == nil {
+			path = defaultConfigPath
+		}
 	}
+	return path
+}
 
-	var cfg Config
+// LoadConfig reads the config file chosen by ResolvePath. Environment
+// variables override the file, e.g. DATABASE_ADDRESS or RABBITMQ_URL, and
+// defaults fill in what neither sets. The result is validated.
+func LoadConfig(path string) (*Config, error) {
+	path = ResolvePath(path)
 
-	if err := cleanenv.ReadConfig(configPath, &cfg); err != nil {
-		log.Fatalf("Cannot read config: %v", err)
+	var cfg Config
+	if path != "" {
+		if err := cleanenv.ReadConfig(path, &cfg); err != nil {
+			return nil, fmt.Errorf("cannot read config %s: %w", path, err)
+		}
+	} else if err := cleanenv.ReadEnv(&cfg); err != nil {
+		return nil, fmt.Errorf("cannot read config from the environment: %w", err)
 	}
 
-	return &cfg
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
 }
@@ -0,0 +1,146 @@
+package config
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+
+	"answers-processor/pkg/logger"
+)
+
+// Reloader rereads the configuration on SIGHUP and when the config file
+// changes, and hands it to the subscribers. A file that fails to load or
+// validate changes nothing. Only the settings listed on Reload are applied;
+// other changes are reported as needing a restart.
+type Reloader struct {
+	path        string
+	interval    time.Duration
+	logInstance *logger.Loggers
+
+	mu          sync.Mutex // serializes reloads
+	initial     *Config
+	modTime     time.Time
+	subscribers []func(*Config)
+
+	ctx    context.Context // cancelled by Stop
+	cancel context.CancelFunc
+}
+
+// NewReloader watches the config file chosen by ResolvePath for cfg, the
+// configuration the service was started with.
+func NewReloader(path string, cfg *Config, logInstance *logger.Loggers) *Reloader {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &Reloader{
+		path:        ResolvePath(path),
+		interval:    cfg.Reload.WatchInterval,
+		logInstance: logInstance,
+		initial:     cfg,
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+	if info, err := os.Stat(r.path); err == nil {
+		r.modTime = info.ModTime()
+	}
+	return r
+}
+
+// Subscribe registers apply to receive every reloaded configuration.
+// Subscribers are called in order of registration.
+func (r *Reloader) Subscribe(apply func(*Config)) {
+	r.mu.Lock()
+	r.subscribers = append(r.subscribers, apply)
+	r.mu.Unlock()
+}
+
+func (r *Reloader) Start() {
+	go r.run()
+}
+
+func (r *Reloader) Stop() {
+	r.cancel()
+}
+
+func (r *Reloader) run() {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	var tick <-chan time.Time
+	if r.interval > 0 && r.path != "" {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-hangup:
+			r.logInstance.InfoLogger.Info("Received SIGHUP, reloading configuration", "path", r.path)
+			r.Reload()
+		case <-tick:
+			if r.fileChanged() {
+				r.logInstance.InfoLogger.Info("Config file changed, reloading configuration", "path", r.path)
+				r.Reload()
+			}
+		case <-r.ctx.Done():
+			return
+		}
+	}
+}
+
+func (r *Reloader) fileChanged() bool {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if info.ModTime().Equal(r.modTime) {
+		return false
+	}
+	r.modTime = info.ModTime()
+	return true
+}
+
+// Reload loads and validates the configuration and applies it.
+func (r *Reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cfg, err := LoadConfig(r.path)
+	if err != nil {
+		r.logInstance.ErrorLogger.Error("Failed to reload configuration, keeping the current one", "path", r.path, "error", err)
+		return err
+	}
+
+	if !reflect.DeepEqual(restartOnly(*cfg), restartOnly(*r.initial)) {
+		r.logInstance.ErrorLogger.Error("Configuration has changes that need a restart; only reloadable settings were applied", "path", r.path)
+	}
+
+	for _, apply := range r.subscribers {
+		apply(cfg)
+	}
+	r.logInstance.InfoLogger.Info("Configuration reloaded", "path", r.path)
+	return nil
+}
+
+// restartOnly clears the reloadable settings of c.
+func restartOnly(c Config) Config {
+	c.LogLevel = ""
+	c.Pipeline.RateLimit = 0
+	c.Pipeline.RateWindow = 0
+	c.Pipeline.Blocklist = nil
+	c.Lottery.WrongCodeReply = ""
+	c.Lottery.SuggestionReply = ""
+	c.Lottery.MaxSuggestionDistance = 0
+	c.Lottery.MaxWrongCodeReplies = 0
+	c.Wall.Reply = ""
+	c.Wall.BlockedWords = nil
+	c.Features = Features{}
+	return c
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+
+	"answers-processor/pkg/logger"
+)
+
+// syncBuffer collects log output written by the reloader.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestReload(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		wantErr     bool
+		wantApplied bool
+		wantRestart bool // the restart warning is logged
+		rateLimit   int  // of the applied configuration
+	}{
+		{"invalid file", validYAML + "log_level: loud\n", true, false, false, 0},
+		{"unreadable file", "database: [", true, false, false, 0},
+		{"reloadable settings", validYAML + "log_level: debug\npipeline:\n  rate_limit: 3\n", false, true, false, 3},
+		{"restart-only setting", validYAML + "log_level: debug\nvoting:\n  batch_size: 50\n", false, true, true, 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := writeConfig(t, dir, "config.yaml", validYAML)
+			initial, err := LoadConfig(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var logs syncBuffer
+			handler := slog.NewTextHandler(&logs, nil)
+			r := NewReloader(path, initial, &logger.Loggers{InfoLogger: slog.New(handler), ErrorLogger: slog.New(handler)})
+
+			var applied []*Config
+			var order []string
+			r.Subscribe(func(cfg *Config) {
+				applied = append(applied, cfg)
+				order = append(order, "first")
+			})
+			r.Subscribe(func(cfg *Config) { order = append(order, "second") })
+
+			writeConfig(t, dir, "config.yaml", tt.content)
+			err = r.Reload()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Reload: %v; want error %v", err, tt.wantErr)
+			}
+
+			if !tt.wantApplied {
+				if len(applied) != 0 {
+					t.Errorf("subscribers received %d configurations; want none", len(applied))
+				}
+				if initial.LogLevel != "info" {
+					t.Errorf("initial log level changed to %q", initial.LogLevel)
+				}
+			} else {
+				if len(applied) != 1 || strings.Join(order, ",") != "first,second" {
+					t.Fatalf("subscribers called %v; want first,second once", order)
+				}
+				if applied[0].LogLevel != "debug" || applied[0].Pipeline.RateLimit != tt.rateLimit {
+					t.Errorf("applied log level, rate limit = %q, %d; want debug, %d", applied[0].LogLevel, applied[0].Pipeline.RateLimit, tt.rateLimit)
+				}
+			}
+
+			restart := strings.Contains(logs.String(), "need a restart")
+			if restart != tt.wantRestart {
+				t.Errorf("restart warning logged = %v; want %v\n%s", restart, tt.wantRestart, logs.String())
+			}
+		})
+	}
+}
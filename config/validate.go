@@ -0,0 +1,147 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"answers-processor/pkg/dates"
+	"answers-processor/pkg/phone"
+)
+
+// Validate checks the configuration and reports every problem it finds, one
+// per line, so a deployment can be fixed in one go.
+func (c *Config) Validate() error {
+	var v validator
+
+	v.oneOf("log_level", strings.ToLower(c.LogLevel), "debug", "info", "warn", "error")
+
+	v.oneOf("database.driver", c.Database.Driver, "mysql", "postgres", "sqlite")
+	v.required("database.address", c.Database.Addr)
+	v.nonNegative("database.query_timeout", c.Database.QueryTimeout)
+	v.nonNegativeInt("database.max_open_conns", c.Database.MaxOpenConns)
+	v.nonNegativeInt("database.max_idle_conns", c.Database.MaxIdleConns)
+	v.nonNegative("database.conn_max_lifetime", c.Database.ConnMaxLifetime)
+	v.nonNegative("database.conn_max_idle_time", c.Database.ConnMaxIdleTime)
+	v.nonNegativeInt("database.connect_attempts", c.Database.ConnectAttempts)
+	v.nonNegative("database.connect_backoff", c.Database.ConnectBackoff)
+	v.nonNegative("database.max_connect_backoff", c.Database.MaxConnectBackoff)
+	v.nonNegative("database.health_interval", c.Database.HealthInterval)
+	if c.Database.HealthInterval > 0 && c.Database.FailureThreshold < 1 {
+		v.addf("database.failure_threshold", "must be at least 1")
+	}
+
+	if v.required("rabbitmq.url", c.RabbitMQ.URL) {
+		if u, err := url.Parse(c.RabbitMQ.URL); err != nil || (u.Scheme != "amqp" && u.Scheme != "amqps") || u.Host == "" {
+			v.addf("rabbitmq.url", "must be an amqp:// or amqps:// URL")
+		}
+	}
+	v.required("rabbitmq.consumer.exchange_name", c.RabbitMQ.Consumer.ExchangeName)
+	v.required("rabbitmq.consumer.queue_name", c.RabbitMQ.Consumer.QueueName)
+	v.required("rabbitmq.publisher.exchange_name", c.RabbitMQ.Publisher.ExchangeName)
+	v.required("rabbitmq.publisher.queue_name", c.RabbitMQ.Publisher.QueueName)
+	v.nonNegativeInt("rabbitmq.prefetch", c.RabbitMQ.Prefetch)
+
+	if v.required("websocket.address", c.WebSocket.Addr) {
+		v.address("websocket.address", c.WebSocket.Addr)
+	}
+	paths := make([]string, 0, len(c.WebSocket.Policies))
+	for path := range c.WebSocket.Policies {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		v.oneOf("websocket.policies."+path, c.WebSocket.Policies[path], "masked", "hashed", "full")
+	}
+
+	v.nonNegative("voting.results_interval", c.Voting.ResultsInterval)
+	v.nonNegative("voting.batch_window", c.Voting.BatchWindow)
+	if c.Voting.BatchWindow > 0 && c.Voting.BatchSize < 1 {
+		v.addf("voting.batch_size", "must be at least 1 when batching votes")
+	}
+
+	v.nonNegative("shop.reservation_ttl", c.Shop.ReservationTTL)
+	v.nonNegative("shop.expiry_interval", c.Shop.ExpiryInterval)
+	v.nonNegativeInt("lottery.max_suggestion_distance", c.Lottery.MaxSuggestionDistance)
+	v.nonNegativeInt("lottery.max_wrong_code_replies", c.Lottery.MaxWrongCodeReplies)
+	v.nonNegative("content.schedule_interval", c.Content.ScheduleInterval)
+
+	v.nonNegative("pipeline.message_timeout", c.Pipeline.MessageTimeout)
+	v.nonNegativeInt("pipeline.rate_limit", c.Pipeline.RateLimit)
+	if c.Pipeline.RateLimit > 0 && c.Pipeline.RateWindow <= 0 {
+		v.addf("pipeline.rate_window", "must be positive when rate_limit is set")
+	}
+
+	if _, err := time.LoadLocation(c.Dates.Timezone); err != nil {
+		v.addf("dates.timezone", "unknown timezone %q", c.Dates.Timezone)
+	}
+	v.oneOf("dates.missing_policy", c.Dates.MissingPolicy, dates.PolicyReceiveTime, dates.PolicyReject)
+	v.oneOf("dates.skew_policy", c.Dates.SkewPolicy, dates.PolicyReceiveTime, dates.PolicyReject, dates.PolicyClamp)
+	v.nonNegative("dates.max_future_skew", c.Dates.MaxFutureSkew)
+	v.nonNegative("dates.max_past_skew", c.Dates.MaxPastSkew)
+
+	if _, ok := phone.Countries[strings.ToUpper(c.Phone.DefaultCountry)]; !ok {
+		v.addf("phone.default_country", "unsupported country %q", c.Phone.DefaultCountry)
+	}
+	v.nonNegativeInt("phone.cache_size", c.Phone.CacheSize)
+
+	v.nonNegative("campaigns.refresh_interval", c.Campaigns.RefreshInterval)
+	v.nonNegative("campaigns.lookback", c.Campaigns.Lookback)
+
+	v.nonNegative("reload.watch_interval", c.Reload.WatchInterval)
+
+	return errors.Join(v.errs...)
+}
+
+type validator struct {
+	errs []error
+}
+
+func (v *validator) addf(field, format string, args ...any) {
+	v.errs = append(v.errs, fmt.Errorf("%s: "+format, append([]any{field}, args...)...))
+}
+
+// required reports whether value is set.
+func (v *validator) required(field, value string) bool {
+	if strings.TrimSpace(value) == "" {
+		v.addf(field, "is required")
+		return false
+	}
+	return true
+}
+
+func (v *validator) oneOf(field, value string, allowed ...string) {
+	if !slices.Contains(allowed, value) {
+		v.addf(field, "must be one of %s, got %q", strings.Join(allowed, ", "), value)
+	}
+}
+
+func (v *validator) nonNegative(field string, value time.Duration) {
+	if value < 0 {
+		v.addf(field, "must not be negative")
+	}
+}
+
+func (v *validator) nonNegativeInt(field string, value int) {
+	if value < 0 {
+		v.addf(field, "must not be negative")
+	}
+}
+
+// address checks a host:port listen address; the host may be empty.
+func (v *validator) address(field, value string) {
+	_, port, err := net.SplitHostPort(value)
+	if err != nil {
+		v.addf(field, "must be host:port, got %q", value)
+		return
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		v.addf(field, "invalid port %q", port)
+	}
+}
@@ -0,0 +1,219 @@
+package campaigns
+
+import (
+	"answers-processor/internal/repository"
+	db "answers-processor/pkg/database"
+	"answers-processor/pkg/logger"
+	"context"
+	"database/sql"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Cache keeps account types and the campaigns and quiz questions of every
+// short number in memory. Lookups pick the campaign whose window contains the
+// message date, exactly like the SQL queries, so a cached campaign is never
+// used outside its window. Anything the cache cannot answer, such as a
+// campaign created since the last refresh or a date older than the loaded
+// range, is read from the database. Edits to existing campaigns become
+// visible on the next refresh or after Invalidate.
+type Cache struct {
+	db          *sql.DB // the replica when there is one
+	primary     *sql.DB
+	votings     *repository.VotingRepository
+	lotteries   *repository.LotteryRepository
+	questions   *repository.QuizRepository
+	interval    time.Duration
+	lookback    time.Duration
+	logInstance *logger.Loggers
+
+	current atomic.Pointer[snapshot]
+	loadMu  sync.Mutex // serializes refreshes
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+type snapshot struct {
+	from      time.Time // campaigns ending before from are not loaded
+	accounts  map[string]string
+	votings   map[string][]repository.Voting
+	lotteries map[string][]repository.Lottery
+	questions map[string][]repository.Question
+}
+
+// NewCache returns a cache refreshed every interval. A zero interval disables
+// caching and every lookup goes to the database, or to replica when it is not
+// nil.
+func NewCache(db, replica *sql.DB, interval, lookback time.Duration, logInstance *logger.Loggers) *Cache {
+	ctx, cancel := context.WithCancel(context.Background())
+	accounts := db
+	if replica != nil {
+		accounts = replica
+	}
+	return &Cache{
+		db:          accounts,
+		primary:     db,
+		votings:     &repository.VotingRepository{DB: db, Replica: replica},
+		lotteries:   &repository.LotteryRepository{DB: db, Replica: replica},
+		questions:   &repository.QuizRepository{DB: db, Replica: replica},
+		interval:    interval,
+		lookback:    lookback,
+		logInstance: logInstance,
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+}
+
+// Start loads the cache and refreshes it in the background.
+func (c *Cache) Start() error {
+	if c.interval <= 0 {
+		return nil
+	}
+	if err := c.Refresh(c.ctx); err != nil {
+		return err
+	}
+	go c.run()
+	return nil
+}
+
+func (c *Cache) Stop() {
+	c.cancel()
+}
+
+func (c *Cache) run() {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.Refresh(c.ctx); err != nil {
+				c.logInstance.ErrorLogger.Error("Failed to refresh campaign cache", "error", err)
+			}
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+// Refresh reloads all accounts and campaigns, from the replica when there is
+// one; campaign tables are small enough to reload as a whole.
+func (c *Cache) Refresh(ctx context.Context) error {
+	return c.load(ctx, c.db)
+}
+
+// Invalidate reloads the cache now, e.g. after a control message announced a
+// campaign change. It reads from the primary, which a replica may still lag
+// behind right after the change.
+func (c *Cache) Invalidate(ctx context.Context) error {
+	return c.load(ctx, c.primary)
+}
+
+func (c *Cache) load(ctx context.Context, db *sql.DB) error {
+	if c.interval <= 0 {
+		return nil
+	}
+
+	c.loadMu.Lock()
+	defer c.loadMu.Unlock()
+
+	from := time.Now().Add(-c.lookback)
+
+	accounts, err := repository.GetAccounts(ctx, db)
+	if err != nil {
+		return err
+	}
+	votings, err := (&repository.VotingRepository{DB: db}).GetVotingsEndingAfter(ctx, from)
+	if err != nil {
+		return err
+	}
+	lotteries, err := (&repository.LotteryRepository{DB: db}).GetLotteriesEndingAfter(ctx, from)
+	if err != nil {
+		return err
+	}
+	questions, err := (&repository.QuizRepository{DB: db}).GetQuestionsEndingAfter(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	next := &snapshot{
+		from:      from,
+		accounts:  accounts,
+		votings:   make(map[string][]repository.Voting),
+		lotteries: make(map[string][]repository.Lottery),
+		questions: make(map[string][]repository.Question),
+	}
+	for _, voting := range votings {
+		next.votings[voting.ShortNumber] = append(next.votings[voting.ShortNumber], voting)
+	}
+	for _, lottery := range lotteries {
+		next.lotteries[lottery.ShortNumber] = append(next.lotteries[lottery.ShortNumber], lottery)
+	}
+	for _, question := range questions {
+		next.questions[question.ShortNumber] = append(next.questions[question.ShortNumber], question)
+	}
+	c.current.Store(next)
+
+	c.logInstance.InfoLogger.Info("Campaign cache refreshed", "accounts", len(accounts), "votings", len(votings), "lotteries", len(lotteries), "questions", len(questions))
+	return nil
+}
+
+func (c *Cache) AccountType(ctx context.Context, shortNumber string) (string, error) {
+	if s := c.current.Load(); s != nil {
+		if accountType, ok := s.accounts[shortNumber]; ok {
+			return accountType, nil
+		}
+	}
+	accountType, err := repository.GetAccountType(ctx, c.db, shortNumber)
+	return accountType, db.Retryable(err)
+}
+
+// Voting returns the voting active on shortNumber at date, with its items.
+// The voting may be shared with other callers and must not be modified.
+func (c *Cache) Voting(ctx context.Context, shortNumber string, date time.Time) (*repository.Voting, error) {
+	if s := c.current.Load(); s != nil && !date.Before(s.from) {
+		for i := range s.votings[shortNumber] {
+			voting := &s.votings[shortNumber][i]
+			if inWindow(date, voting.StartsAt, voting.EndsAt) {
+				return voting, nil
+			}
+		}
+	}
+	voting, err := c.votings.GetVoting(ctx, shortNumber, date)
+	return voting, db.Retryable(err)
+}
+
+// Lottery returns the lottery active on shortNumber at date.
+func (c *Cache) Lottery(ctx context.Context, shortNumber string, date time.Time) (*repository.Lottery, error) {
+	if s := c.current.Load(); s != nil && !date.Before(s.from) {
+		for i := range s.lotteries[shortNumber] {
+			lottery := s.lotteries[shortNumber][i]
+			if inWindow(date, lottery.StartsAt, lottery.EndsAt) {
+				return &lottery, nil
+			}
+		}
+	}
+	lottery, err := c.lotteries.GetLotteryByShortNumber(ctx, shortNumber, date)
+	return lottery, db.Retryable(err)
+}
+
+// Question returns the quiz question active on shortNumber at date. Whether a
+// client has already answered it is not cached; see QuizRepository.GetScoringInfo.
+func (c *Cache) Question(ctx context.Context, shortNumber string, date time.Time) (*repository.Question, error) {
+	if s := c.current.Load(); s != nil && !date.Before(s.from) {
+		for i := range s.questions[shortNumber] {
+			question := s.questions[shortNumber][i]
+			if inWindow(date, question.StartsAt, question.EndsAt) {
+				return &question, nil
+			}
+		}
+	}
+	question, err := c.questions.GetQuestion(ctx, shortNumber, date)
+	return question, db.Retryable(err)
+}
+
+// inWindow mirrors "starts_at <= ? AND ends_at >= ?".
+func inWindow(date, startsAt, endsAt time.Time) bool {
+	return !startsAt.After(date) && !endsAt.Before(date)
+}
@@ -0,0 +1,158 @@
+package campaigns
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"answers-processor/internal/repository"
+	db "answers-processor/pkg/database"
+	"answers-processor/pkg/logger"
+
+	_ "modernc.org/sqlite"
+)
+
+const sqliteSchema = `
+CREATE TABLE accounts (id INTEGER PRIMARY KEY, short_number TEXT NOT NULL, type TEXT NOT NULL);
+CREATE TABLE votings (
+    id INTEGER PRIMARY KEY, account_id INTEGER NOT NULL, status TEXT NOT NULL,
+    starts_at DATETIME NOT NULL, ends_at DATETIME NOT NULL
+);
+CREATE TABLE voting_items (id INTEGER PRIMARY KEY, voting_id INTEGER NOT NULL, title TEXT NOT NULL, vote_code TEXT NOT NULL);
+CREATE TABLE lotteries (
+    id INTEGER PRIMARY KEY, account_id INTEGER NOT NULL, sms_code TEXT NOT NULL, sms_answer TEXT NOT NULL,
+    entry_policy TEXT, daily_entry_limit INTEGER, start_time DATETIME NOT NULL, end_time DATETIME NOT NULL
+);
+CREATE TABLE quizzes (id INTEGER PRIMARY KEY, account_id INTEGER NOT NULL);
+CREATE TABLE questions (
+    id INTEGER PRIMARY KEY, quiz_id INTEGER NOT NULL, answer TEXT NOT NULL, score INTEGER NOT NULL,
+    starts_at DATETIME NOT NULL, ends_at DATETIME NOT NULL
+);
+INSERT INTO accounts (id, short_number, type) VALUES (1, '0123', 'lottery');
+`
+
+// openSQLite returns a fresh SQLite database with the campaign tables and
+// points the repository package at the sqlite dialect until the test ends.
+func openSQLite(t *testing.T) (*sql.DB, *logger.Loggers) {
+	t.Helper()
+
+	logInstance, err := logger.SetupLogger("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repository.Init(logInstance, 0, db.Dialects["sqlite"])
+	t.Cleanup(func() {
+		repository.Init(nil, 0, db.Dialects["mysql"])
+	})
+
+	database, err := db.Dialects["sqlite"].Open("sqlite", filepath.Join(t.TempDir(), "test.db"), time.Local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	if _, err := database.Exec(sqliteSchema); err != nil {
+		t.Fatal(err)
+	}
+	return database, logInstance
+}
+
+func TestInWindow(t *testing.T) {
+	startsAt := time.Date(2024, time.March, 15, 9, 0, 0, 0, time.UTC)
+	endsAt := time.Date(2024, time.March, 15, 18, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		date time.Time
+		want bool
+	}{
+		{"before the start", startsAt.Add(-time.Second), false},
+		{"at the start", startsAt, true},
+		{"inside", startsAt.Add(time.Hour), true},
+		{"at the end", endsAt, true},
+		{"after the end", endsAt.Add(time.Second), false},
+		{"same instant in another location", startsAt.In(time.FixedZone("TMT", 5*60*60)), true},
+	}
+
+	for _, tt := range tests {
+		if got := inWindow(tt.date, startsAt, endsAt); got != tt.want {
+			t.Errorf("%s: inWindow(%v) = %v; want %v", tt.name, tt.date, got, tt.want)
+		}
+	}
+}
+
+func TestCacheLottery(t *testing.T) {
+	database, logInstance := openSQLite(t)
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Second)
+
+	insertLottery := func(id int64, accountID int64, code string, startsAt, endsAt time.Time) {
+		t.Helper()
+		_, err := database.Exec("INSERT INTO lotteries (id, account_id, sms_code, sms_answer, start_time, end_time) VALUES (?, ?, ?, '', ?, ?)",
+			id, accountID, code, startsAt, endsAt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Lottery 2 ended before the lookback, so only lottery 1 is loaded
+	insertLottery(1, 1, "BAHAR", now.Add(-2*time.Hour), now.Add(2*time.Hour))
+	insertLottery(2, 1, "GYS", now.Add(-72*time.Hour), now.Add(-48*time.Hour))
+
+	cache := NewCache(database, nil, time.Hour, 24*time.Hour, logInstance)
+	if err := cache.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Changed since the refresh: lottery 1 is edited and lottery 3 is created
+	// on a new short number
+	if _, err := database.Exec("UPDATE lotteries SET sms_code = 'TOMUS' WHERE id = 1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.Exec("INSERT INTO accounts (id, short_number, type) VALUES (2, '0456', 'lottery')"); err != nil {
+		t.Fatal(err)
+	}
+	insertLottery(3, 2, "GUZ", now.Add(-time.Hour), now.Add(time.Hour))
+
+	tests := []struct {
+		name        string
+		invalidate  bool // before the lookup
+		shortNumber string
+		date        time.Time
+		wantID      int64
+		wantCode    string
+	}{
+		{"cached", false, "0123", now, 1, "BAHAR"},
+		{"cached at the window end", false, "0123", now.Add(2 * time.Hour), 1, "BAHAR"},
+		{"before the lookback", false, "0123", now.Add(-60 * time.Hour), 2, "GYS"},
+		{"created after the refresh", false, "0456", now, 3, "GUZ"},
+		{"edited, after invalidate", true, "0123", now, 1, "TOMUS"},
+		{"created, after invalidate", false, "0456", now, 3, "GUZ"},
+	}
+
+	for _, tt := range tests {
+		if tt.invalidate {
+			if err := cache.Invalidate(ctx); err != nil {
+				t.Fatal(err)
+			}
+		}
+		lottery, err := cache.Lottery(ctx, tt.shortNumber, tt.date)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if lottery.ID != tt.wantID || lottery.Code != tt.wantCode {
+			t.Errorf("%s: Lottery = %d %q; want %d %q", tt.name, lottery.ID, lottery.Code, tt.wantID, tt.wantCode)
+		}
+	}
+
+	// Invalidate loaded the lottery created after the first refresh
+	if lotteries := cache.current.Load().lotteries["0456"]; len(lotteries) != 1 || lotteries[0].ID != 3 {
+		t.Errorf("lotteries of 0456 after invalidate = %+v; want lottery 3", lotteries)
+	}
+	accountType, err := cache.AccountType(ctx, "0456")
+	if err != nil || accountType != "lottery" {
+		t.Errorf("AccountType(0456) = %q, %v; want lottery", accountType, err)
+	}
+}
@@ -0,0 +1,192 @@
+package admin
+
+import (
+	websocket "answers-processor/internal/delivery"
+	"answers-processor/internal/repository"
+	"answers-processor/internal/service"
+	"answers-processor/pkg/logger"
+	"answers-processor/pkg/utils"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Handler serves the operator HTTP API and the expvar metrics at
+// /admin/debug/vars. Every request must carry one of the operator tokens.
+type Handler struct {
+	mux            *http.ServeMux
+	operatorTokens []string
+	draws          *service.LotteryDraws
+	wall           *service.WallModeration
+	quarantine     *service.Quarantine
+	shop           *service.ShopOrders
+	Log            *logger.Loggers
+}
+
+func NewHandler(draws *service.LotteryDraws, wall *service.WallModeration, quarantine *service.Quarantine, shop *service.ShopOrders, operatorTokens []string, logInstance *logger.Loggers) *Handler {
+	h := &Handler{
+		mux:            http.NewServeMux(),
+		operatorTokens: operatorTokens,
+		draws:          draws,
+		wall:           wall,
+		quarantine:     quarantine,
+		shop:           shop,
+		Log:            logInstance,
+	}
+
+	h.mux.HandleFunc("/admin/lottery/commit", h.commitDraw)
+	h.mux.HandleFunc("/admin/lottery/draw", h.performDraw)
+	h.mux.HandleFunc("/admin/wall/messages", h.listWallMessages)
+	h.mux.HandleFunc("/admin/wall/approve", h.approveWallMessage)
+	h.mux.HandleFunc("/admin/wall/reject", h.rejectWallMessage)
+	h.mux.HandleFunc("/admin/quarantine/messages", h.listQuarantinedMessages)
+	h.mux.HandleFunc("/admin/quarantine/replay", h.replayQuarantinedMessage)
+	h.mux.HandleFunc("/admin/shop/confirm", h.confirmShopOrder)
+	h.mux.Handle("/admin/debug/vars", expvar.Handler())
+
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !websocket.OperatorAuthorized(r, h.operatorTokens) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	h.mux.ServeHTTP(w, r)
+}
+
+type drawResponse struct {
+	DrawID             int64            `json:"draw_id"`
+	LotteryID          int64            `json:"lottery_id"`
+	SeedHash           string           `json:"seed_hash"`
+	Seed               string           `json:"seed,omitempty"`
+	LastEntryID        int64            `json:"last_entry_id"`
+	EntriesDigest      string           `json:"entries_digest"`
+	ExcludedLotteryIDs []int64          `json:"excluded_lottery_ids,omitempty"`
+	Entries            int              `json:"entries,omitempty"`
+	Winners            []winnerResponse `json:"winners,omitempty"`
+}
+
+type winnerResponse struct {
+	Position int    `json:"position"`
+	EntryID  int64  `json:"entry_id"`
+	ClientID int64  `json:"client_id"`
+	Src      string `json:"src"`
+}
+
+// commitDraw handles POST /admin/lottery/commit?lottery_id=&exclude_lotteries=.
+// exclude_lotteries is a comma-separated list of lottery IDs whose winners
+// cannot win this draw. The response carries the seed, which the operator
+// keeps secret until the draw.
+func (h *Handler) commitDraw(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	lotteryID, err := strconv.ParseInt(r.URL.Query().Get("lottery_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid lottery_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var excluded []int64
+	for _, value := range strings.Split(r.URL.Query().Get("exclude_lotteries"), ",") {
+		if value = strings.TrimSpace(value); value == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid exclude_lotteries parameter", http.StatusBadRequest)
+			return
+		}
+		excluded = append(excluded, id)
+	}
+
+	draw, err := h.draws.Commit(r.Context(), lotteryID, excluded)
+	if err != nil {
+		h.fail(w, "Failed to commit lottery draw", err)
+		return
+	}
+
+	h.respond(w, drawResponse{
+		DrawID:             draw.ID,
+		LotteryID:          draw.LotteryID,
+		SeedHash:           draw.SeedHash,
+		Seed:               draw.Seed,
+		LastEntryID:        draw.LastEntryID,
+		EntriesDigest:      draw.EntriesDigest,
+		ExcludedLotteryIDs: draw.ExcludedLotteryIDs,
+	})
+}
+
+// performDraw handles POST /admin/lottery/draw?draw_id=&seed=&winners=.
+func (h *Handler) performDraw(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	drawID, err := strconv.ParseInt(query.Get("draw_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid draw_id parameter", http.StatusBadRequest)
+		return
+	}
+	count, err := strconv.Atoi(query.Get("winners"))
+	if err != nil || count <= 0 {
+		http.Error(w, "Invalid winners parameter", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.draws.Draw(r.Context(), drawID, query.Get("seed"), count)
+	if err != nil {
+		h.fail(w, "Failed to perform lottery draw", err)
+		return
+	}
+
+	response := drawResponse{
+		DrawID:             result.Draw.ID,
+		LotteryID:          result.Draw.LotteryID,
+		SeedHash:           result.Draw.SeedHash,
+		Seed:               result.Draw.Seed,
+		LastEntryID:        result.Draw.LastEntryID,
+		EntriesDigest:      result.Draw.EntriesDigest,
+		ExcludedLotteryIDs: result.Draw.ExcludedLotteryIDs,
+		Entries:            result.Entries,
+	}
+	for _, winner := range result.Winners {
+		response.Winners = append(response.Winners, winnerResponse{
+			Position: winner.Position,
+			EntryID:  winner.Entry.ID,
+			ClientID: winner.Entry.ClientID,
+			Src:      utils.StarMiddleDigits(winner.Entry.Phone),
+		})
+	}
+	h.respond(w, response)
+}
+
+func (h *Handler) respond(w http.ResponseWriter, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		h.Log.ErrorLogger.Error("Failed to write admin response", "error", err)
+	}
+}
+
+func (h *Handler) fail(w http.ResponseWriter, message string, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "Not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrSeedMismatch):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, repository.ErrDrawCompleted), errors.Is(err, repository.ErrDrawCommitted), errors.Is(err, service.ErrLotteryNotEnded), errors.Is(err, service.ErrEntriesChanged), errors.Is(err, repository.ErrAlreadyModerated), errors.Is(err, repository.ErrAlreadyReplayed), errors.Is(err, repository.ErrOrderNotReserved):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		h.Log.ErrorLogger.Error(message, "error", err)
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,87 @@
+package admin
+
+import (
+	"answers-processor/internal/repository"
+	"answers-processor/pkg/utils"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultQuarantineLimit = 50
+	maxQuarantineLimit     = 500
+)
+
+type quarantinedMessageResponse struct {
+	ID            int64  `json:"id"`
+	Dst           string `json:"dst"`
+	Src           string `json:"src"`
+	Message       string `json:"message"`
+	Date          string `json:"date"`
+	Panic         string `json:"panic"`
+	Stack         string `json:"stack,omitempty"`
+	QuarantinedAt string `json:"quarantined_at"`
+}
+
+func newQuarantinedMessageResponse(message *repository.QuarantinedMessage) quarantinedMessageResponse {
+	return quarantinedMessageResponse{
+		ID:            message.ID,
+		Dst:           message.Destination,
+		Src:           utils.StarMiddleDigits(message.Source),
+		Message:       message.Text,
+		Date:          message.Date,
+		Panic:         message.Panic,
+		Stack:         message.Stack,
+		QuarantinedAt: message.QuarantinedAt.Format("2006-01-02T15:04:05"),
+	}
+}
+
+// listQuarantinedMessages handles GET /admin/quarantine/messages?limit=.
+func (h *Handler) listQuarantinedMessages(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit := defaultQuarantineLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > maxQuarantineLimit {
+			http.Error(w, "Invalid limit parameter", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	messages, err := h.quarantine.Messages(r.Context(), limit)
+	if err != nil {
+		h.fail(w, "Failed to list quarantined messages", err)
+		return
+	}
+
+	response := make([]quarantinedMessageResponse, 0, len(messages))
+	for i := range messages {
+		response = append(response, newQuarantinedMessageResponse(&messages[i]))
+	}
+	h.respond(w, response)
+}
+
+// replayQuarantinedMessage handles POST /admin/quarantine/replay?id=.
+func (h *Handler) replayQuarantinedMessage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid id parameter", http.StatusBadRequest)
+		return
+	}
+
+	message, err := h.quarantine.Replay(r.Context(), id)
+	if err != nil {
+		h.fail(w, "Failed to replay quarantined message", err)
+		return
+	}
+	h.respond(w, newQuarantinedMessageResponse(message))
+}
@@ -0,0 +1,48 @@
+package admin
+
+import (
+	"answers-processor/internal/repository"
+	"answers-processor/pkg/utils"
+	"net/http"
+	"strconv"
+)
+
+type shopOrderResponse struct {
+	ID       int64  `json:"id"`
+	LotID    int64  `json:"lot_id"`
+	Dst      string `json:"dst"`
+	Src      string `json:"src"`
+	Quantity int64  `json:"quantity"`
+	Variant  string `json:"variant,omitempty"`
+	Status   string `json:"status"`
+}
+
+// confirmShopOrder handles POST /admin/shop/confirm?order_id=.
+func (h *Handler) confirmShopOrder(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	orderID, err := strconv.ParseInt(r.URL.Query().Get("order_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid order_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	order, err := h.shop.Confirm(r.Context(), orderID)
+	if err != nil {
+		h.fail(w, "Failed to confirm shop order", err)
+		return
+	}
+
+	h.respond(w, shopOrderResponse{
+		ID:       order.ID,
+		LotID:    order.LotID,
+		Dst:      order.ShortNumber,
+		Src:      utils.StarMiddleDigits(order.Phone),
+		Quantity: order.Quantity,
+		Variant:  order.Variant,
+		Status:   repository.OrderStatusConfirmed,
+	})
+}
@@ -0,0 +1,118 @@
+package admin
+
+import (
+	"answers-processor/internal/repository"
+	"answers-processor/pkg/utils"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultWallLimit = 50
+	maxWallLimit     = 500
+)
+
+type wallMessageResponse struct {
+	ID      int64  `json:"id"`
+	Dst     string `json:"dst"`
+	Src     string `json:"src"`
+	Message string `json:"message"`
+	Date    string `json:"date"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+func newWallMessageResponse(message *repository.WallMessage) wallMessageResponse {
+	return wallMessageResponse{
+		ID:      message.ID,
+		Dst:     message.ShortNumber,
+		Src:     utils.StarMiddleDigits(message.Phone),
+		Message: message.Message,
+		Date:    message.Date.Format("2006-01-02T15:04:05"),
+		Status:  message.Status,
+		Reason:  message.Reason,
+	}
+}
+
+// listWallMessages handles GET /admin/wall/messages?dst=&status=&limit=.
+func (h *Handler) listWallMessages(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	dst := query.Get("dst")
+	if dst == "" {
+		http.Error(w, "Missing dst parameter", http.StatusBadRequest)
+		return
+	}
+	status := query.Get("status")
+	if status == "" {
+		status = repository.WallStatusPending
+	}
+	limit := defaultWallLimit
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > maxWallLimit {
+			http.Error(w, "Invalid limit parameter", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	messages, err := h.wall.Queue(r.Context(), dst, status, limit)
+	if err != nil {
+		h.fail(w, "Failed to list wall messages", err)
+		return
+	}
+
+	response := make([]wallMessageResponse, 0, len(messages))
+	for i := range messages {
+		response = append(response, newWallMessageResponse(&messages[i]))
+	}
+	h.respond(w, response)
+}
+
+// approveWallMessage handles POST /admin/wall/approve?id=.
+func (h *Handler) approveWallMessage(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.wallMessageID(w, r)
+	if !ok {
+		return
+	}
+
+	message, err := h.wall.Approve(r.Context(), id)
+	if err != nil {
+		h.fail(w, "Failed to approve wall message", err)
+		return
+	}
+	h.respond(w, newWallMessageResponse(message))
+}
+
+// rejectWallMessage handles POST /admin/wall/reject?id=&reason=.
+func (h *Handler) rejectWallMessage(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.wallMessageID(w, r)
+	if !ok {
+		return
+	}
+
+	message, err := h.wall.Reject(r.Context(), id, r.URL.Query().Get("reason"))
+	if err != nil {
+		h.fail(w, "Failed to reject wall message", err)
+		return
+	}
+	h.respond(w, newWallMessageResponse(message))
+}
+
+func (h *Handler) wallMessageID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return 0, false
+	}
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid id parameter", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
@@ -1,5 +1,8 @@
 package delivery
 
+// Broadcaster sends payloads to the WebSocket clients of a destination.
+// Payloads are JSON-marshalled by the server, which renders any
+// domain.Subscriber in them according to each client's privacy policy.
 type Broadcaster interface {
-	Broadcast(destination string, message []byte)
+	Broadcast(destination string, payload any)
 }
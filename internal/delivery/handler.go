@@ -7,4 +7,5 @@ type Handler interface {
 	HandleMessages()
 	Shutdown()
 	Broadcaster
+	SnapshotRegistry
 }
@@ -0,0 +1,186 @@
+package delivery
+
+import (
+	"answers-processor/internal/domain"
+	"answers-processor/pkg/utils"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+type PrivacyPolicy string
+
+const (
+	PolicyMasked PrivacyPolicy = "masked" // middle digits starred
+	PolicyHashed PrivacyPolicy = "hashed" // stable keyed pseudonym
+	PolicyFull   PrivacyPolicy = "full"   // raw phone, operator sockets only
+)
+
+var subscriberType = reflect.TypeOf(domain.Subscriber{})
+
+// Privacy decides how subscribers are rendered for each WebSocket connection
+// and renders outbound payloads accordingly.
+type Privacy struct {
+	policies       map[string]PrivacyPolicy // endpoint path -> policy
+	pseudonymKey   []byte
+	operatorTokens []string
+}
+
+func NewPrivacy(policies map[string]string, pseudonymKey string, operatorTokens []string) (*Privacy, error) {
+	p := &Privacy{
+		policies:       make(map[string]PrivacyPolicy, len(policies)),
+		pseudonymKey:   []byte(pseudonymKey),
+		operatorTokens: operatorTokens,
+	}
+
+	for path, name := range policies {
+		policy := PrivacyPolicy(strings.ToLower(strings.TrimSpace(name)))
+		switch policy {
+		case PolicyMasked, PolicyFull:
+		case PolicyHashed:
+			if pseudonymKey == "" {
+				return nil, fmt.Errorf("endpoint %s uses the hashed policy but no pseudonym key is configured", path)
+			}
+		default:
+			return nil, fmt.Errorf("unknown privacy policy %q for endpoint %s", name, path)
+		}
+		p.policies[path] = policy
+	}
+
+	return p, nil
+}
+
+var errOperatorRequired = errors.New("endpoint requires an authenticated operator")
+
+// PolicyFor returns the policy for a connection request. Authenticated
+// operators always get full payloads; endpoints configured as full refuse
+// everybody else.
+func (p *Privacy) PolicyFor(r *http.Request) (PrivacyPolicy, error) {
+	if p.isOperator(r) {
+		return PolicyFull, nil
+	}
+
+	policy, ok := p.policies[r.URL.Path]
+	if !ok {
+		return PolicyMasked, nil
+	}
+	if policy == PolicyFull {
+		return "", errOperatorRequired
+	}
+	return policy, nil
+}
+
+func (p *Privacy) isOperator(r *http.Request) bool {
+	return OperatorAuthorized(r, p.operatorTokens)
+}
+
+// OperatorAuthorized reports whether the request carries one of the operator
+// tokens, either as a bearer token or in the token query parameter.
+func OperatorAuthorized(r *http.Request, operatorTokens []string) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" {
+		token = r.URL.Query().Get("token")
+	}
+	if token == "" {
+		return false
+	}
+
+	for _, operatorToken := range operatorTokens {
+		if operatorToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(operatorToken)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// Render marshals payload with every domain.Subscriber in it rendered for policy.
+// The payload itself is left untouched.
+func (p *Privacy) Render(payload any, policy PrivacyPolicy) ([]byte, error) {
+	if _, ok := payload.([]byte); ok {
+		return nil, errors.New("raw payloads bypass privacy rendering")
+	}
+
+	value := reflect.ValueOf(payload)
+	if !value.IsValid() {
+		return nil, errors.New("nil payload")
+	}
+
+	redacted := reflect.New(value.Type()).Elem()
+	redacted.Set(p.redact(value, policy))
+
+	return json.MarshalIndent(redacted.Interface(), "", "    ")
+}
+
+// redact returns a copy of v with subscribers rendered. Slices, maps and
+// pointers are copied so the caller's payload is never modified.
+func (p *Privacy) redact(v reflect.Value, policy PrivacyPolicy) reflect.Value {
+	switch v.Kind() {
+	case reflect.Struct:
+		if v.Type() == subscriberType {
+			subscriber := v.Interface().(domain.Subscriber)
+			return reflect.ValueOf(subscriber.Rendered(p.display(subscriber, policy)))
+		}
+		out := reflect.New(v.Type()).Elem()
+		out.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if out.Field(i).CanSet() {
+				out.Field(i).Set(p.redact(v.Field(i), policy))
+			}
+		}
+		return out
+	case reflect.Pointer:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.New(v.Type().Elem())
+		out.Elem().Set(p.redact(v.Elem(), policy))
+		return out
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(p.redact(v.Index(i), policy))
+		}
+		return out
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			out.SetMapIndex(iter.Key(), p.redact(iter.Value(), policy))
+		}
+		return out
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.New(v.Type()).Elem()
+		out.Set(p.redact(v.Elem(), policy))
+		return out
+	}
+	return v
+}
+
+func (p *Privacy) display(subscriber domain.Subscriber, policy PrivacyPolicy) string {
+	switch policy {
+	case PolicyFull:
+		return subscriber.Phone
+	case PolicyHashed:
+		mac := hmac.New(sha256.New, p.pseudonymKey)
+		mac.Write([]byte(subscriber.Phone))
+		return "anon-" + hex.EncodeToString(mac.Sum(nil))[:12]
+	default:
+		return utils.StarMiddleDigits(subscriber.Phone)
+	}
+}
@@ -0,0 +1,14 @@
+package delivery
+
+import "context"
+
+// SnapshotProvider supplies the current state for a destination so that a
+// freshly connected client does not have to wait for the next broadcast. A nil
+// payload means there is nothing to send.
+type SnapshotProvider interface {
+	Snapshot(ctx context.Context, destination string) (any, error)
+}
+
+type SnapshotRegistry interface {
+	AddSnapshotProvider(provider SnapshotProvider)
+}
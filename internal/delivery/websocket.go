@@ -2,6 +2,7 @@ package delivery
 
 import (
 	"answers-processor/pkg/logger"
+	"context"
 	"net/http"
 	"sync"
 
@@ -9,22 +10,29 @@ import (
 )
 
 type WebSocketServer struct {
-	clients   map[*websocket.Conn]string
+	clients   map[*websocket.Conn]client
 	broadcast chan BroadcastMessage
 	upgrader  websocket.Upgrader
 	mu        sync.Mutex
 	Log       *logger.Loggers
+	snapshots []SnapshotProvider
+	privacy   *Privacy
+}
+
+type client struct {
+	dst    string
+	policy PrivacyPolicy
 }
 
 type BroadcastMessage struct {
 	Dst     string
-	Message []byte
+	Payload any
 }
 
 // NewWebSocketServer creates a new WebSocketServer instance.
-func NewWebSocketServer(logInstance *logger.Loggers) Handler {
+func NewWebSocketServer(logInstance *logger.Loggers, privacy *Privacy) Handler {
 	return &WebSocketServer{
-		clients:   make(map[*websocket.Conn]string),
+		clients:   make(map[*websocket.Conn]client),
 		broadcast: make(chan BroadcastMessage),
 		upgrader: websocket.Upgrader{
 			ReadBufferSize:  1024,
@@ -33,7 +41,8 @@ func NewWebSocketServer(logInstance *logger.Loggers) Handler {
 				return true
 			},
 		},
-		Log: logInstance,
+		Log:     logInstance,
+		privacy: privacy,
 	}
 }
 
@@ -45,21 +54,64 @@ func (server *WebSocketServer) HandleConnections(w http.ResponseWriter, r *http.
 		return
 	}
 
+	policy, err := server.privacy.PolicyFor(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
 	ws, err := server.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		server.Log.ErrorLogger.Error("Failed to upgrade connection", "error", err)
 		return
 	}
 
+	// Send the snapshot before registering the client so it never races a broadcast write
+	server.sendSnapshot(r.Context(), ws, dst, policy)
+
 	server.mu.Lock()
-	server.clients[ws] = dst
+	server.clients[ws] = client{dst: dst, policy: policy}
 	server.mu.Unlock()
 
-	server.Log.InfoLogger.Info("Client connected", "dst", dst)
+	server.Log.InfoLogger.Info("Client connected", "dst", dst, "policy", policy)
 
 	go server.readPump(ws, dst)
 }
 
+// sendSnapshot writes the first non-empty snapshot available for dst to the connection.
+func (server *WebSocketServer) sendSnapshot(ctx context.Context, conn *websocket.Conn, dst string, policy PrivacyPolicy) {
+	server.mu.Lock()
+	providers := append([]SnapshotProvider(nil), server.snapshots...)
+	server.mu.Unlock()
+
+	for _, provider := range providers {
+		snapshot, err := provider.Snapshot(ctx, dst)
+		if err != nil {
+			server.Log.ErrorLogger.Error("Failed to build snapshot", "dst", dst, "error", err)
+			continue
+		}
+		if snapshot == nil {
+			continue
+		}
+		msg, err := server.privacy.Render(snapshot, policy)
+		if err != nil {
+			server.Log.ErrorLogger.Error("Failed to render snapshot", "dst", dst, "error", err)
+			return
+		}
+		if err := conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+			server.Log.ErrorLogger.Error("Failed to write snapshot to client", "dst", dst, "error", err)
+		}
+		return
+	}
+}
+
+// AddSnapshotProvider registers a provider consulted when a client connects.
+func (server *WebSocketServer) AddSnapshotProvider(provider SnapshotProvider) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	server.snapshots = append(server.snapshots, provider)
+}
+
 // readPump reads messages from the WebSocket connection.
 func (server *WebSocketServer) readPump(conn *websocket.Conn, dst string) {
 	defer server.cleanupConnection(conn, dst)
@@ -85,32 +137,39 @@ func (server *WebSocketServer) cleanupConnection(conn *websocket.Conn, dst strin
 // HandleMessages listens for messages on the broadcast channel and sends them to clients.
 func (server *WebSocketServer) HandleMessages() {
 	for broadcastMessage := range server.broadcast {
-		var clientsToNotify []*websocket.Conn
+		clientsToNotify := make(map[PrivacyPolicy][]*websocket.Conn)
 		// Collect clients to notify while holding the lock
 		server.mu.Lock()
-		for client, dst := range server.clients {
-			if dst == broadcastMessage.Dst {
-				clientsToNotify = append(clientsToNotify, client)
+		for conn, c := range server.clients {
+			if c.dst == broadcastMessage.Dst {
+				clientsToNotify[c.policy] = append(clientsToNotify[c.policy], conn)
 			}
 		}
 		server.mu.Unlock()
-		// Send messages to clients outside the critical section
-		for _, client := range clientsToNotify {
-			go func(c *websocket.Conn) {
-				if err := c.WriteMessage(websocket.TextMessage, broadcastMessage.Message); err != nil {
-					server.Log.ErrorLogger.Error("Failed to write message to client, closing connection", "dst", broadcastMessage.Dst, "error", err)
-					server.cleanupConnection(c, broadcastMessage.Dst)
-				}
-			}(client)
+		// Render once per policy and send outside the critical section
+		for policy, conns := range clientsToNotify {
+			msg, err := server.privacy.Render(broadcastMessage.Payload, policy)
+			if err != nil {
+				server.Log.ErrorLogger.Error("Failed to render broadcast message", "dst", broadcastMessage.Dst, "policy", policy, "error", err)
+				continue
+			}
+			for _, conn := range conns {
+				go func(c *websocket.Conn, dst string) {
+					if err := c.WriteMessage(websocket.TextMessage, msg); err != nil {
+						server.Log.ErrorLogger.Error("Failed to write message to client, closing connection", "dst", dst, "error", err)
+						server.cleanupConnection(c, dst)
+					}
+				}(conn, broadcastMessage.Dst)
+			}
 		}
-
 	}
 }
 
-// Broadcast sends a message to the broadcast channel.
-func (server *WebSocketServer) Broadcast(dst string, message []byte) {
+// Broadcast sends a payload to the broadcast channel. It is rendered per
+// client privacy policy before being written.
+func (server *WebSocketServer) Broadcast(dst string, payload any) {
 	go func() {
-		server.broadcast <- BroadcastMessage{Dst: dst, Message: message}
+		server.broadcast <- BroadcastMessage{Dst: dst, Payload: payload}
 	}()
 }
 
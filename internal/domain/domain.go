@@ -8,31 +8,46 @@ type SMSMessage struct {
 	Parts       int    `json:"parts"`
 }
 
+// ControlMessage steers the processor instead of an SMS; it is recognized by
+// its control field. Publish it on the control exchange to reach every
+// instance; one published on the SMS queue reaches only one of them.
+type ControlMessage struct {
+	Control     string `json:"control"`
+	Destination string `json:"dst,omitempty"`
+}
+
+// Control message kinds.
+const (
+	ControlInvalidateCampaigns = "invalidate_campaigns"
+)
+
 type CorrectAnswerMessage struct {
-	Answer                 string `json:"answer"`
-	Score                  int    `json:"score"`
-	Date                   string `json:"date"`
-	SerialNumber           int    `json:"serial_number"`
-	SerialNumberForCorrect int    `json:"serial_number_for_correct"`
-	StarredSrc             string `json:"starred_src"`
-	QuizID                 int64  `json:"quiz_id"`
-	QuestionID             int64  `json:"question_id"`
+	Answer                 string     `json:"answer"`
+	Score                  int        `json:"score"`
+	Date                   string     `json:"date"`
+	SerialNumber           int        `json:"serial_number"`
+	SerialNumberForCorrect int        `json:"serial_number_for_correct"`
+	StarredSrc             Subscriber `json:"starred_src"`
+	QuizID                 int64      `json:"quiz_id"`
+	QuestionID             int64      `json:"question_id"`
 }
 
 type VotingMessage struct {
 	VotingID     int64  `json:"voting_id"`
 	VotingItemID int64  `json:"voting_item_id"`
-	ClientID     int64  `json:"client_id"`
 	Message      string `json:"message"`
 	Date         string `json:"date"`
 }
 
 type ShoppingMessage struct {
-	LotID    int64  `json:"lot_id"`
-	ClientID int64  `json:"client_id"`
-	Message  string `json:"message"`
-	Date     string `json:"date"`
-	Src      string `json:"src"`
+	LotID    int64      `json:"lot_id"`
+	Message  string     `json:"message"`
+	Date     string     `json:"date"`
+	Src      Subscriber `json:"src"`
+	OrderID  int64      `json:"order_id,omitempty"`
+	Quantity int64      `json:"quantity,omitempty"`
+	Variant  string     `json:"variant,omitempty"`
+	Status   string     `json:"status"`
 }
 
 type RelayMessage struct {
@@ -42,7 +57,71 @@ type RelayMessage struct {
 }
 
 type LotteryMessage struct {
-	LotteryID int64  `json:"lottery_id"`
-	Date      string `json:"date"`
-	Src       string `json:"src"`
+	LotteryID    int64      `json:"lottery_id"`
+	Date         string     `json:"date"`
+	Src          Subscriber `json:"src"`
+	TicketNumber int64      `json:"ticket_number"`
+}
+
+type VotingResultsMessage struct {
+	Type       string             `json:"type"`
+	VotingID   int64              `json:"voting_id"`
+	TotalVotes int64              `json:"total_votes"`
+	Items      []VotingItemResult `json:"items"`
+	Date       string             `json:"date"`
+}
+
+type VotingItemResult struct {
+	VotingItemID int64   `json:"voting_item_id"`
+	Title        string  `json:"title"`
+	VoteCode     string  `json:"vote_code"`
+	VotesCount   int64   `json:"votes_count"`
+	Percentage   float64 `json:"percentage"`
+}
+
+type AuctionMessage struct {
+	Type       string     `json:"type"`
+	LotID      int64      `json:"lot_id"`
+	HighestBid int64      `json:"highest_bid"`
+	Src        Subscriber `json:"src"`
+	Date       string     `json:"date"`
+	EndsAt     string     `json:"ends_at"`
+}
+
+type LotteryWinnerMessage struct {
+	Type          string     `json:"type"`
+	LotteryID     int64      `json:"lottery_id"`
+	DrawID        int64      `json:"draw_id"`
+	Position      int        `json:"position"`
+	Src           Subscriber `json:"src"`
+	SeedHash      string     `json:"seed_hash"`
+	Seed          string     `json:"seed"`
+	EntriesDigest string     `json:"entries_digest"`
+	Date          string     `json:"date"`
+}
+
+type SurveyResultsMessage struct {
+	Type      string                 `json:"type"`
+	SurveyID  int64                  `json:"survey_id"`
+	Completed int64                  `json:"completed"`
+	Questions []SurveyQuestionResult `json:"questions"`
+	Date      string                 `json:"date"`
+}
+
+type SurveyQuestionResult struct {
+	QuestionID int64            `json:"question_id"`
+	Position   int              `json:"position"`
+	Text       string           `json:"text"`
+	AnswerType string           `json:"answer_type"`
+	Responses  int64            `json:"responses"`
+	Answers    map[string]int64 `json:"answers,omitempty"`
+	Average    *float64         `json:"average,omitempty"`
+}
+
+type WallMessage struct {
+	Type      string     `json:"type"`
+	MessageID int64      `json:"message_id"`
+	Message   string     `json:"message"`
+	Src       Subscriber `json:"src"`
+	Date      string     `json:"date"`
 }
@@ -0,0 +1,34 @@
+package domain
+
+import (
+	"answers-processor/pkg/utils"
+	"encoding/json"
+)
+
+// Subscriber identifies the sender of an SMS in outbound WebSocket payloads.
+// The phone number is never written as is: the WebSocket layer renders it per
+// connection policy, and a Subscriber that was not rendered marshals masked.
+type Subscriber struct {
+	Phone    string
+	ClientID int64
+	display  string
+	rendered bool
+}
+
+func NewSubscriber(phone string, clientID int64) Subscriber {
+	return Subscriber{Phone: phone, ClientID: clientID}
+}
+
+// Rendered returns a copy of the subscriber that marshals as display.
+func (s Subscriber) Rendered(display string) Subscriber {
+	s.display = display
+	s.rendered = true
+	return s
+}
+
+func (s Subscriber) MarshalJSON() ([]byte, error) {
+	if !s.rendered {
+		return json.Marshal(utils.StarMiddleDigits(s.Phone))
+	}
+	return json.Marshal(s.display)
+}
@@ -1,18 +1,24 @@
 package consumer
 
 import (
+	"context"
 	"encoding/json"
 	"sync"
 	"time"
 
 	"answers-processor/internal/domain"
 	"answers-processor/internal/service"
+	db "answers-processor/pkg/database"
 	"answers-processor/pkg/logger"
 
 	"github.com/streadway/amqp"
 )
 
-const reconnectDelay = 5 * time.Second
+const (
+	reconnectDelay     = 5 * time.Second
+	consumerTag        = "answers-processor"
+	controlConsumerTag = "answers-processor-control"
+)
 
 type RabbitMQConsumer struct {
 	conn            *amqp.Connection
@@ -21,24 +27,39 @@ type RabbitMQConsumer struct {
 	exchange        string
 	queue           string
 	routingKey      string
+	controlExchange string // fanout exchange for control messages, optional
+	controlQueue    string // this instance's queue bound to controlExchange
+	prefetch        int
 	logInstance     *logger.Loggers
+	breaker         *db.Breaker // consumption pauses while it is open
 	mu              sync.Mutex
 	isShuttingDown  bool
 	handler         func(amqp.Delivery)
+	controlHandler  func(amqp.Delivery)
 	reconnecting    bool
 	notifyConnClose chan *amqp.Error
 	notifyChanClose chan *amqp.Error
 	done            chan struct{}
+	ctx             context.Context // cancelled on Close to abandon in-flight work
+	cancel          context.CancelFunc
 }
 
-func NewRabbitMQConsumer(url, exchange, queue, routingKey string, logInstance *logger.Loggers, service *service.Service) (*RabbitMQConsumer, error) {
+// NewRabbitMQConsumer connects to the queue. Messages are acknowledged once
+// processed, and at most prefetch of them are delivered unacknowledged.
+func NewRabbitMQConsumer(url, exchange, queue, routingKey, controlExchange string, prefetch int, logInstance *logger.Loggers, service *service.Service, breaker *db.Breaker) (*RabbitMQConsumer, error) {
+	ctx, cancel := context.WithCancel(context.Background())
 	client := &RabbitMQConsumer{
-		url:         url,
-		exchange:    exchange,
-		queue:       queue,
-		routingKey:  routingKey,
-		logInstance: logInstance,
-		done:        make(chan struct{}),
+		url:             url,
+		exchange:        exchange,
+		queue:           queue,
+		routingKey:      routingKey,
+		controlExchange: controlExchange,
+		prefetch:        prefetch,
+		logInstance:     logInstance,
+		breaker:         breaker,
+		done:            make(chan struct{}),
+		ctx:             ctx,
+		cancel:          cancel,
 	}
 
 	if err := client.connect(); err != nil {
@@ -74,6 +95,22 @@ func (c *RabbitMQConsumer) connect() error {
 		return err
 	}
 
+	if err := c.channel.Qos(c.prefetch, 0, false); err != nil {
+		c.cleanupConnection()
+		if !c.isShuttingDown {
+			c.logInstance.ErrorLogger.Error("Failed to set the prefetch count", "error", err)
+		}
+		return err
+	}
+
+	if err := c.declareControlQueue(); err != nil {
+		c.cleanupConnection()
+		if !c.isShuttingDown {
+			c.logInstance.ErrorLogger.Error("Failed to declare the control queue", "error", err)
+		}
+		return err
+	}
+
 	// Re-establish notification channels for monitoring
 	c.resetNotifyChannels()
 
@@ -83,6 +120,29 @@ func (c *RabbitMQConsumer) connect() error {
 	return nil
 }
 
+// declareControlQueue binds a server-named queue to the control exchange. The
+// queue is exclusive to this connection and deleted with it, so every instance
+// receives each control message once.
+func (c *RabbitMQConsumer) declareControlQueue() error {
+	if c.controlExchange == "" {
+		return nil
+	}
+
+	err := c.channel.ExchangeDeclare(c.controlExchange, amqp.ExchangeFanout, true, false, false, false, nil)
+	if err != nil {
+		return err
+	}
+	queue, err := c.channel.QueueDeclare("", false, true, true, false, nil)
+	if err != nil {
+		return err
+	}
+	if err := c.channel.QueueBind(queue.Name, "", c.controlExchange, false, nil); err != nil {
+		return err
+	}
+	c.controlQueue = queue.Name
+	return nil
+}
+
 func (c *RabbitMQConsumer) resetNotifyChannels() {
 	c.notifyConnClose = make(chan *amqp.Error, 1)
 	c.notifyChanClose = make(chan *amqp.Error, 1)
@@ -91,23 +151,100 @@ func (c *RabbitMQConsumer) resetNotifyChannels() {
 }
 
 func (c *RabbitMQConsumer) ConsumeMessages(service *service.Service) {
+	c.controlHandler = func(msg amqp.Delivery) {
+		var control domain.ControlMessage
+		if err := json.Unmarshal(msg.Body, &control); err != nil || control.Control == "" {
+			c.logInstance.ErrorLogger.Error("Failed to unmarshal control message", "error", err)
+			return
+		}
+		service.HandleControl(c.ctx, control)
+	}
 	c.handler = func(msg amqp.Delivery) {
+		var control domain.ControlMessage
+		if err := json.Unmarshal(msg.Body, &control); err == nil && control.Control != "" {
+			service.HandleControl(c.ctx, control)
+			c.ack(msg)
+			return
+		}
+
 		var smsMessage domain.SMSMessage
 		if err := json.Unmarshal(msg.Body, &smsMessage); err != nil {
 			c.logInstance.ErrorLogger.Error("Failed to unmarshal message", "error", err)
+			// Dead-lettered when the queue has a dead letter exchange
+			if err := msg.Reject(false); err != nil {
+				c.logInstance.ErrorLogger.Error("Failed to reject message", "error", err)
+			}
 			return
 		}
 
-		service.ProcessMessage(smsMessage)
+		// Messages that failed before anything was written, because of the
+		// database or because processing was abandoned on shutdown, go back to
+		// the queue. The circuit breaker pauses consumption while the database
+		// stays down, so they are not retried in a loop.
+		if err := service.ProcessMessage(c.ctx, smsMessage); err != nil {
+			if err := msg.Nack(false, true); err != nil {
+				c.logInstance.ErrorLogger.Error("Failed to requeue message", "error", err)
+			}
+			return
+		}
+		c.ack(msg)
 	}
+	go c.consumeControl(c.controlHandler)
 	c.consumeMessages(c.handler)
 }
 
+func (c *RabbitMQConsumer) ack(msg amqp.Delivery) {
+	if err := msg.Ack(false); err != nil {
+		c.logInstance.ErrorLogger.Error("Failed to acknowledge message", "error", err)
+	}
+}
+
+// consumeControl handles control messages until the channel closes. They are
+// not held back by the circuit breaker: a cache invalidation that fails is
+// logged, and the next refresh catches up.
+func (c *RabbitMQConsumer) consumeControl(handler func(amqp.Delivery)) {
+	if c.controlQueue == "" {
+		return
+	}
+
+	msgs, err := c.channel.Consume(
+		c.controlQueue,
+		controlConsumerTag,
+		true,
+		true,
+		false,
+		false,
+		nil,
+	)
+	if err != nil {
+		c.logInstance.ErrorLogger.Error("Failed to start consuming control messages", "error", err)
+		return
+	}
+
+	for {
+		select {
+		case msg, ok := <-msgs:
+			if !ok {
+				// The connection monitor reconnects and restarts consumption
+				return
+			}
+			handler(msg)
+		case <-c.done:
+			return
+		}
+	}
+}
+
 func (c *RabbitMQConsumer) consumeMessages(handler func(amqp.Delivery)) {
+	// Messages stay queued while the database is unhealthy
+	if err := c.breaker.Wait(c.ctx); err != nil {
+		return
+	}
+
 	msgs, err := c.channel.Consume(
 		c.queue,
-		"",
-		true,
+		consumerTag,
+		false,
 		false,
 		false,
 		false,
@@ -119,6 +256,7 @@ func (c *RabbitMQConsumer) consumeMessages(handler func(amqp.Delivery)) {
 		return
 	}
 
+	tripped := c.breaker.Tripped()
 	for {
 		select {
 		case msg, ok := <-msgs:
@@ -128,12 +266,33 @@ func (c *RabbitMQConsumer) consumeMessages(handler func(amqp.Delivery)) {
 				return
 			}
 			handler(msg)
+		case <-tripped:
+			c.pause(msgs, handler)
+			return
 		case <-c.done:
 			return
 		}
 	}
 }
 
+// pause cancels the consumer until the database is healthy again. Messages
+// delivered before the cancel took effect are handled once it is.
+func (c *RabbitMQConsumer) pause(msgs <-chan amqp.Delivery, handler func(amqp.Delivery)) {
+	if err := c.channel.Cancel(consumerTag, false); err != nil {
+		c.logInstance.ErrorLogger.Error("Failed to pause consuming messages", "error", err)
+		c.reconnect()
+		return
+	}
+
+	for msg := range msgs {
+		if err := c.breaker.Wait(c.ctx); err != nil {
+			return
+		}
+		handler(msg)
+	}
+	go c.consumeMessages(handler)
+}
+
 func (c *RabbitMQConsumer) monitorConnection() {
 	for {
 		select {
@@ -181,7 +340,8 @@ func (c *RabbitMQConsumer) reconnect() {
 			if err := c.connect(); err == nil {
 				c.logInstance.InfoLogger.Info("Successfully reconnected RabbitMQ consumer.")
 				go c.consumeMessages(c.handler) // Ensure consuming resumes after reconnection
-				go c.monitorConnection()        // Restart monitoring after reconnect
+				go c.consumeControl(c.controlHandler)
+				go c.monitorConnection() // Restart monitoring after reconnect
 				return
 			}
 
@@ -195,6 +355,7 @@ func (c *RabbitMQConsumer) Close() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	c.isShuttingDown = true
+	c.cancel()
 
 	select {
 	case <-c.done:
@@ -4,6 +4,7 @@ import (
 	"answers-processor/config"
 	"answers-processor/internal/domain"
 	"answers-processor/pkg/logger"
+	"context"
 	"encoding/json"
 	"fmt"
 	"sync"
@@ -129,7 +130,8 @@ func (c *RabbitmqPublisher) setupChannel() error {
 
 // Logic
 
-func (c *RabbitmqPublisher) SendMessage(src, dest, text string) error {
+// SendMessage publishes the message, retrying until it succeeds or ctx is done.
+func (c *RabbitmqPublisher) SendMessage(ctx context.Context, src, dest, text string) error {
 	message := domain.RelayMessage{
 		Src: src,
 		Dst: dest,
@@ -158,8 +160,12 @@ func (c *RabbitmqPublisher) SendMessage(src, dest, text string) error {
 
 		if err != nil {
 			c.Logger.ErrorLogger.Error("Failed to publish message", "error", err)
-			time.Sleep(RetryDelay)
-			continue
+			select {
+			case <-time.After(RetryDelay):
+				continue
+			case <-ctx.Done():
+				return fmt.Errorf("failed to publish message: %w", ctx.Err())
+			}
 		}
 
 		return nil
@@ -1,6 +1,8 @@
 package publisher
 
+import "context"
+
 type MessagePublisher interface {
-	SendMessage(destination, source, message string) error
+	SendMessage(ctx context.Context, destination, source, message string) error
 	Close()
 }
@@ -0,0 +1,66 @@
+package pipeline
+
+import (
+	"answers-processor/internal/domain"
+	"context"
+	"fmt"
+	"time"
+)
+
+// Result statuses set by the handler or by stages that stop processing.
+const (
+	StatusProcessed      = "processed"
+	StatusFailed         = "failed"
+	StatusDuplicate      = "duplicate"
+	StatusBlocked        = "blocked"
+	StatusRateLimited    = "rate_limited"
+	StatusUnknownAccount = "unknown_account"
+	StatusDisabled       = "disabled"
+)
+
+// Context carries one incoming SMS through the middleware chain. The client
+// and account type are looked up by the resolve stage: stages after it can
+// key on them, while stages before it drop messages without database work.
+type Context struct {
+	Ctx         context.Context // carries the per-message deadline
+	Message     domain.SMSMessage
+	ParsedDate  time.Time
+	ClientID    int64
+	Phone       string // client phone in E.164 form
+	AccountType string
+	ShortNumber string
+	Result      Result
+}
+
+// Result records the outcome of processing a message.
+type Result struct {
+	Status   string
+	Err      error
+	Duration time.Duration
+}
+
+// PanicError reports a panic recovered while processing a message.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic while processing message: %v", e.Value)
+}
+
+// Handler processes a message. The innermost handler runs the strategy.
+type Handler func(pc *Context) error
+
+// Middleware wraps a handler with a cross-cutting concern. Stages that decide
+// a message must not be processed set pc.Result.Status and return without
+// calling next.
+type Middleware func(next Handler) Handler
+
+// Chain wraps handler so that the first middleware is the outermost.
+func Chain(handler Handler, middlewares ...Middleware) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
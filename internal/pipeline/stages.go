@@ -0,0 +1,255 @@
+package pipeline
+
+import (
+	"answers-processor/config"
+	db "answers-processor/pkg/database"
+	"answers-processor/pkg/logger"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Stage names usable in pipeline.stages.
+const (
+	StageRecover   = "recover"
+	StageLogging   = "logging"
+	StageTiming    = "timing"
+	StageDedup     = "dedup"
+	StageBlocklist = "blocklist"
+	StageRateLimit = "ratelimit"
+	StageResolve   = "resolve"
+)
+
+// Settings are the stage settings that can be reloaded while the service
+// runs. Apply must not run concurrently with message processing; the service
+// applies reloads between messages.
+type Settings struct {
+	rateLimit  int
+	rateWindow time.Duration
+	blocked    map[string]bool
+}
+
+func NewSettings(cfg config.Pipeline) *Settings {
+	s := &Settings{}
+	s.Apply(cfg)
+	return s
+}
+
+func (s *Settings) Apply(cfg config.Pipeline) {
+	s.rateLimit, s.rateWindow = cfg.RateLimit, cfg.RateWindow
+	s.blocked = make(map[string]bool, len(cfg.Blocklist))
+	for _, phone := range cfg.Blocklist {
+		s.blocked[strings.TrimSpace(phone)] = true
+	}
+}
+
+// Build returns the configured stages in order. resolve looks up the client
+// and account type; it runs innermost unless the resolve stage is listed.
+// Unknown stage names are reported together.
+func Build(cfg config.Pipeline, settings *Settings, resolve Middleware, logInstance *logger.Loggers) ([]Middleware, error) {
+	var middlewares []Middleware
+	var unknown []string
+	resolved := false
+
+	for _, name := range cfg.Stages {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case StageResolve:
+			if !resolved {
+				middlewares = append(middlewares, resolve)
+				resolved = true
+			}
+		case StageRecover:
+			middlewares = append(middlewares, Recover())
+		case StageLogging:
+			middlewares = append(middlewares, Logging(logInstance))
+		case StageTiming:
+			middlewares = append(middlewares, Timing(cfg.SlowThreshold, logInstance))
+		case StageDedup:
+			middlewares = append(middlewares, Dedup(cfg.DedupWindow))
+		case StageBlocklist:
+			middlewares = append(middlewares, Blocklist(settings))
+		case StageRateLimit:
+			middlewares = append(middlewares, RateLimit(settings))
+		case "":
+		default:
+			unknown = append(unknown, name)
+		}
+	}
+
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("unknown pipeline stages: %s", strings.Join(unknown, ", "))
+	}
+	if !resolved {
+		middlewares = append(middlewares, resolve)
+	}
+	return middlewares, nil
+}
+
+// Recover turns a panic in later stages or the strategy into a *PanicError
+// so that the service can quarantine the message.
+func Recover() Middleware {
+	return func(next Handler) Handler {
+		return func(pc *Context) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					pc.Result.Status = StatusFailed
+					err = &PanicError{Value: r, Stack: debug.Stack()}
+				}
+			}()
+			return next(pc)
+		}
+	}
+}
+
+// Logging logs the outcome of every message that did not fail; failures are
+// logged by the service.
+func Logging(logInstance *logger.Loggers) Middleware {
+	return func(next Handler) Handler {
+		return func(pc *Context) error {
+			err := next(pc)
+			if err == nil {
+				logInstance.InfoLogger.Info("Message handled",
+					"dst", pc.Message.Destination, "account_type", pc.AccountType, "client_id", pc.ClientID, "status", pc.Result.Status)
+			}
+			return err
+		}
+	}
+}
+
+// Timing records how long the rest of the chain took and logs slow messages.
+func Timing(slowThreshold time.Duration, logInstance *logger.Loggers) Middleware {
+	return func(next Handler) Handler {
+		return func(pc *Context) error {
+			start := time.Now()
+			err := next(pc)
+			pc.Result.Duration = time.Since(start)
+			if slowThreshold > 0 && pc.Result.Duration > slowThreshold {
+				logInstance.InfoLogger.Info("Slow message processing",
+					"dst", pc.Message.Destination, "account_type", pc.AccountType, "duration", pc.Result.Duration)
+			}
+			return err
+		}
+	}
+}
+
+// Dedup drops messages identical to one seen within window, e.g. redelivered
+// by the SMS gateway. A message that panics or fails before anything was
+// written is forgotten again, so a retry or a quarantine replay is processed.
+func Dedup(window time.Duration) Middleware {
+	var mu sync.Mutex
+	seen := make(map[[sha256.Size]byte]time.Time)
+	lastPrune := time.Now()
+
+	return func(next Handler) Handler {
+		return func(pc *Context) error {
+			key := sha256.Sum256([]byte(pc.Message.Source + "\x00" + pc.Message.Destination + "\x00" + pc.Message.Text + "\x00" + pc.Message.Date))
+			now := time.Now()
+
+			mu.Lock()
+			if now.Sub(lastPrune) > window {
+				for k, at := range seen {
+					if now.Sub(at) > window {
+						delete(seen, k)
+					}
+				}
+				lastPrune = now
+			}
+			at, duplicate := seen[key]
+			duplicate = duplicate && now.Sub(at) <= window
+			if !duplicate {
+				seen[key] = now
+			}
+			mu.Unlock()
+
+			if duplicate {
+				pc.Result.Status = StatusDuplicate
+				return nil
+			}
+
+			handled := false
+			defer func() {
+				if !handled {
+					mu.Lock()
+					delete(seen, key)
+					mu.Unlock()
+				}
+			}()
+			err := next(pc)
+			handled = !errors.Is(err, db.ErrRetryable)
+			return err
+		}
+	}
+}
+
+// Blocklist drops messages from the phone numbers blocked in settings, given
+// either as received or in E.164 form.
+func Blocklist(settings *Settings) Middleware {
+	return func(next Handler) Handler {
+		return func(pc *Context) error {
+			if settings.blocked[pc.Message.Source] || settings.blocked[pc.Phone] {
+				pc.Result.Status = StatusBlocked
+				return nil
+			}
+			return next(pc)
+		}
+	}
+}
+
+// RateLimit allows each client at most the rate limit of settings messages
+// per rate window. Before the resolve stage clients are told apart by phone
+// number.
+func RateLimit(settings *Settings) Middleware {
+	type counter struct {
+		start time.Time
+		count int
+	}
+	type key struct {
+		clientID int64
+		phone    string
+	}
+	var mu sync.Mutex
+	counters := make(map[key]*counter)
+	lastPrune := time.Now()
+
+	return func(next Handler) Handler {
+		return func(pc *Context) error {
+			limit, window := settings.rateLimit, settings.rateWindow
+			if limit <= 0 || window <= 0 {
+				return next(pc)
+			}
+			now := time.Now()
+
+			mu.Lock()
+			if now.Sub(lastPrune) > window {
+				for k, c := range counters {
+					if now.Sub(c.start) > window {
+						delete(counters, k)
+					}
+				}
+				lastPrune = now
+			}
+			k := key{clientID: pc.ClientID}
+			if pc.ClientID == 0 {
+				k.phone = pc.Phone
+			}
+			c, ok := counters[k]
+			if !ok || now.Sub(c.start) > window {
+				c = &counter{start: now}
+				counters[k] = c
+			}
+			c.count++
+			limited := c.count > limit
+			mu.Unlock()
+
+			if limited {
+				pc.Result.Status = StatusRateLimited
+				return nil
+			}
+			return next(pc)
+		}
+	}
+}
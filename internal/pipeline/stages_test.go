@@ -0,0 +1,205 @@
+package pipeline
+
+import (
+	"answers-processor/config"
+	"answers-processor/internal/domain"
+	db "answers-processor/pkg/database"
+	"answers-processor/pkg/logger"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStagesStopBeforeHandler(t *testing.T) {
+	settings := NewSettings(config.Pipeline{
+		RateLimit:  2,
+		RateWindow: time.Minute,
+		Blocklist:  []string{"+99365000000", "865111111"},
+	})
+	middlewares := []Middleware{Dedup(time.Minute), Blocklist(settings), RateLimit(settings)}
+
+	tests := []struct {
+		name   string
+		phone  string
+		source string
+		text   string
+		want   string
+	}{
+		{"allowed", "+99365123456", "865123456", "1", StatusProcessed},
+		{"duplicate", "+99365123456", "865123456", "1", StatusDuplicate},
+		{"second message", "+99365123456", "865123456", "2", StatusProcessed},
+		{"over the limit", "+99365123456", "865123456", "3", StatusRateLimited},
+		{"limit is per phone", "+99365654321", "865654321", "3", StatusProcessed},
+		{"blocked in E.164", "+99365000000", "865000000", "1", StatusBlocked},
+		{"blocked as received", "+99365111111", "865111111", "1", StatusBlocked},
+	}
+
+	var handled int
+	handler := Chain(func(pc *Context) error {
+		handled++
+		pc.Result.Status = StatusProcessed
+		return nil
+	}, middlewares...)
+
+	for _, tt := range tests {
+		before := handled
+		pc := &Context{
+			Message: domain.SMSMessage{Source: tt.source, Destination: "0800", Text: tt.text, Date: "2024-01-01T10:00:00"},
+			Phone:   tt.phone,
+		}
+		if err := handler(pc); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if pc.Result.Status != tt.want {
+			t.Errorf("%s: status = %q, want %q", tt.name, pc.Result.Status, tt.want)
+		}
+		if reached := handled > before; reached != (tt.want == StatusProcessed) {
+			t.Errorf("%s: handler reached = %v", tt.name, reached)
+		}
+	}
+}
+
+func TestSettingsApply(t *testing.T) {
+	settings := NewSettings(config.Pipeline{Blocklist: []string{"+99365000000"}})
+	handler := Chain(func(pc *Context) error {
+		pc.Result.Status = StatusProcessed
+		return nil
+	}, Blocklist(settings))
+
+	pc := &Context{Phone: "+99365000000"}
+	handler(pc)
+	if pc.Result.Status != StatusBlocked {
+		t.Fatalf("status = %q, want %q", pc.Result.Status, StatusBlocked)
+	}
+
+	settings.Apply(config.Pipeline{})
+	pc = &Context{Phone: "+99365000000"}
+	handler(pc)
+	if pc.Result.Status != StatusProcessed {
+		t.Fatalf("status after reload = %q, want %q", pc.Result.Status, StatusProcessed)
+	}
+}
+
+func TestDedupForgetsFailedMessages(t *testing.T) {
+	fail := true
+	handler := Chain(func(pc *Context) error {
+		if fail {
+			panic("strategy bug")
+		}
+		pc.Result.Status = StatusProcessed
+		return nil
+	}, Recover(), Dedup(time.Minute))
+
+	message := domain.SMSMessage{Source: "865123456", Destination: "0800", Text: "1", Date: "2024-01-01T10:00:00"}
+
+	pc := &Context{Message: message}
+	if _, ok := handler(pc).(*PanicError); !ok {
+		t.Fatalf("expected a *PanicError, got status %q", pc.Result.Status)
+	}
+
+	// A replay after the panic is not a duplicate
+	fail = false
+	pc = &Context{Message: message}
+	if err := handler(pc); err != nil || pc.Result.Status != StatusProcessed {
+		t.Fatalf("replay: status = %q, err = %v", pc.Result.Status, err)
+	}
+
+	pc = &Context{Message: message}
+	if handler(pc); pc.Result.Status != StatusDuplicate {
+		t.Fatalf("redelivery: status = %q, want %q", pc.Result.Status, StatusDuplicate)
+	}
+}
+
+func TestDedupFailedMessages(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string // status of the redelivery
+	}{
+		{"failed before writing", db.Retryable(driver.ErrBadConn), StatusProcessed},
+		{"failed after writing", errors.New("Failed to send message notification"), StatusDuplicate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fail := true
+			handler := Chain(func(pc *Context) error {
+				if fail {
+					return tt.err
+				}
+				pc.Result.Status = StatusProcessed
+				return nil
+			}, Dedup(time.Minute))
+
+			message := domain.SMSMessage{Source: "865123456", Destination: "0800", Text: "1", Date: "2024-01-01T10:00:00"}
+			if err := handler(&Context{Message: message}); err != tt.err {
+				t.Fatalf("first delivery: err = %v, want %v", err, tt.err)
+			}
+
+			fail = false
+			pc := &Context{Message: message}
+			if handler(pc); pc.Result.Status != tt.want {
+				t.Errorf("redelivery: status = %q, want %q", pc.Result.Status, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildResolveStage(t *testing.T) {
+	settings := NewSettings(config.Pipeline{RateLimit: 1, RateWindow: time.Minute})
+	logInstance, err := logger.SetupLogger("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Both phones belong to client 7, e.g. numbers merged by cmd/mergeclients
+	tests := []struct {
+		name       string
+		stages     []string
+		wantSecond string // status of the second message
+	}{
+		{"rate limit after resolve", []string{"resolve", "ratelimit"}, StatusRateLimited},
+		{"rate limit before resolve", []string{"ratelimit", "resolve"}, StatusProcessed},
+		{"resolve not listed", []string{"ratelimit"}, StatusProcessed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolved := 0
+			resolve := func(next Handler) Handler {
+				return func(pc *Context) error {
+					resolved++
+					pc.ClientID = 7
+					return next(pc)
+				}
+			}
+			middlewares, err := Build(config.Pipeline{Stages: tt.stages}, settings, resolve, logInstance)
+			if err != nil {
+				t.Fatal(err)
+			}
+			handler := Chain(func(pc *Context) error {
+				if pc.ClientID != 7 {
+					t.Errorf("handler ran without the client being resolved")
+				}
+				pc.Result.Status = StatusProcessed
+				return nil
+			}, middlewares...)
+
+			var statuses []string
+			for _, phone := range []string{"+99365000001", "+99365000002"} {
+				pc := &Context{Phone: phone}
+				if err := handler(pc); err != nil {
+					t.Fatal(err)
+				}
+				statuses = append(statuses, pc.Result.Status)
+			}
+			if statuses[0] != StatusProcessed || statuses[1] != tt.wantSecond {
+				t.Errorf("statuses = %v; want %q, %q", statuses, StatusProcessed, tt.wantSecond)
+			}
+			if resolved == 0 {
+				t.Errorf("resolve did not run")
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrBidTooLow = errors.New("bid is lower than the minimum accepted amount")
+
+type AuctionLot struct {
+	ID           int64
+	Description  string
+	StartPrice   int64
+	BidIncrement int64 // 0 when the lot uses the configured default
+	EndsAt       time.Time
+}
+
+type AuctionBid struct {
+	ClientID int64
+	Phone    string // as delivered by the SMS gateway
+	Amount   int64
+}
+
+type AuctionRepository struct {
+	DB      *sql.DB
+	Replica *sql.DB // optional, serves lookups
+}
+
+func (ar *AuctionRepository) GetAuctionLotByShortNumber(ctx context.Context, shortNumber string, currentDateTime time.Time) (*AuctionLot, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	query := `
+        SELECT l.id, l.description, COALESCE(l.start_price, 0), COALESCE(l.bid_increment, 0), l.ends_at
+        FROM lots l
+        JOIN accounts a ON l.account_id = a.id
+        WHERE a.short_number = ? AND l.starts_at <= ? AND l.ends_at >= ?
+    `
+	var lot AuctionLot
+	err := lookupDB(ar.DB, ar.Replica).QueryRowContext(ctx, rewrite(query), shortNumber, currentDateTime, currentDateTime).Scan(
+		&lot.ID, &lot.Description, &lot.StartPrice, &lot.BidIncrement, &lot.EndsAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &lot, nil
+}
+
+// GetHighestBid returns the leading bid of the lot, or nil when nobody has bid yet.
+func (ar *AuctionRepository) GetHighestBid(ctx context.Context, lotID int64) (*AuctionBid, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	return highestBid(ctx, ar.DB, lotID)
+}
+
+// PlaceBid records the bid if it is at least minimum above the current
+// highest bid (or at least the start price for the first bid). The lot row is
+// locked for the duration of the transaction so concurrent bids are ordered.
+// It returns the bid that was leading before this one, or nil if there was none.
+func (ar *AuctionRepository) PlaceBid(ctx context.Context, lot *AuctionLot, clientID, amount, increment int64, msg string, dt time.Time) (*AuctionBid, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := ar.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var lockedID int64
+	if err = tx.QueryRowContext(ctx, rewrite("SELECT id FROM lots WHERE id = ? FOR UPDATE"), lot.ID).Scan(&lockedID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	previous, err := highestBid(ctx, tx, lot.ID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if amount < MinimumBid(lot, previous, increment) {
+		tx.Rollback()
+		return previous, ErrBidTooLow
+	}
+
+	_, err = tx.ExecContext(ctx,
+		rewrite("INSERT INTO lot_bids (lot_id, client_id, amount, msg, dt) VALUES (?, ?, ?, ?, ?)"),
+		lot.ID, clientID, amount, msg, dt,
+	)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return previous, tx.Commit()
+}
+
+// MinimumBid returns the lowest amount that would currently be accepted for the lot.
+func MinimumBid(lot *AuctionLot, highest *AuctionBid, increment int64) int64 {
+	if lot.BidIncrement > 0 {
+		increment = lot.BidIncrement
+	}
+	if highest == nil {
+		return lot.StartPrice
+	}
+	return highest.Amount + increment
+}
+
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func highestBid(ctx context.Context, q queryRower, lotID int64) (*AuctionBid, error) {
+	var bid AuctionBid
+	err := q.QueryRowContext(ctx, rewrite(`
+        SELECT b.client_id, COALESCE(c.gateway_phone, c.phone), b.amount
+        FROM lot_bids b
+        JOIN clients c ON b.client_id = c.id
+        WHERE b.lot_id = ?
+        ORDER BY b.amount DESC, b.id ASC
+        LIMIT 1
+    `), lotID).Scan(&bid.ClientID, &bid.Phone, &bid.Amount)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &bid, nil
+}
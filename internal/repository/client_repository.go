@@ -0,0 +1,163 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// clientTables lists every table referencing clients.id.
+var clientTables = []string{
+	"answers",
+	"voting_sms_messages",
+	"lot_sms_messages",
+	"lot_orders",
+	"lot_bids",
+	"lottery_sms_messages",
+	"lottery_unmatched_messages",
+	"lottery_draw_winners",
+	"survey_sessions",
+	"survey_answers",
+	"wall_messages",
+}
+
+type Client struct {
+	ID    int64
+	Phone string
+}
+
+type ClientRepository struct {
+	DB *sql.DB
+}
+
+func (cr *ClientRepository) GetClients(ctx context.Context) ([]Client, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := cr.DB.QueryContext(ctx, rewrite("SELECT id, phone FROM clients ORDER BY id"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var clients []Client
+	for rows.Next() {
+		var client Client
+		if err := rows.Scan(&client.ID, &client.Phone); err != nil {
+			return nil, err
+		}
+		clients = append(clients, client)
+	}
+	return clients, rows.Err()
+}
+
+// MergeClients moves everything recorded for duplicateIDs to keepID, deletes
+// the duplicates and stores phone on the kept client, all in one transaction.
+// Subscriptions are unique per topic and client, so only one subscription per
+// topic is moved over; one the kept client already has wins, otherwise the
+// oldest.
+func (cr *ClientRepository) MergeClients(ctx context.Context, keepID int64, phone string, duplicateIDs []int64) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	if len(duplicateIDs) == 0 {
+		return nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(duplicateIDs)), ", ")
+	args := make([]any, 0, len(duplicateIDs)+1)
+	args = append(args, keepID)
+	for _, id := range duplicateIDs {
+		args = append(args, id)
+	}
+
+	tx, err := cr.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range clientTables {
+		if _, err := tx.ExecContext(ctx, rewrite("UPDATE "+table+" SET client_id = ? WHERE client_id IN ("+placeholders+")"), args...); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err := mergeSubscriptions(ctx, tx, keepID, args); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, rewrite("DELETE FROM clients WHERE id IN ("+placeholders+")"), args[1:]...); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, rewrite(updateClientPhone), phone, time.Now(), keepID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// updateClientPhone keeps the phone as stored so far as the gateway form,
+// unless one is recorded already. gateway_phone is assigned first: MySQL
+// evaluates assignments left to right.
+const updateClientPhone = "UPDATE clients SET gateway_phone = COALESCE(gateway_phone, phone), phone = ?, updated_at = ? WHERE id = ?"
+
+// UpdateClientPhone stores phone for a client that has no duplicates.
+func (cr *ClientRepository) UpdateClientPhone(ctx context.Context, id int64, phone string) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	_, err := cr.DB.ExecContext(ctx, rewrite(updateClientPhone), phone, time.Now(), id)
+	return err
+}
+
+// mergeSubscriptions moves the subscriptions of the clients in ids, which
+// include keepID, to keepID and deletes those whose topic is already taken.
+func mergeSubscriptions(ctx context.Context, tx *sql.Tx, keepID int64, ids []any) error {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	rows, err := tx.QueryContext(ctx, rewrite("SELECT id, topic_id, client_id FROM subscriptions WHERE client_id IN ("+placeholders+") ORDER BY id"), ids...)
+	if err != nil {
+		return err
+	}
+
+	type subscription struct{ id, topicID, clientID int64 }
+	var subscriptions []subscription
+	for rows.Next() {
+		var s subscription
+		if err := rows.Scan(&s.id, &s.topicID, &s.clientID); err != nil {
+			rows.Close()
+			return err
+		}
+		subscriptions = append(subscriptions, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	taken := make(map[int64]bool)
+	for _, s := range subscriptions {
+		if s.clientID == keepID {
+			taken[s.topicID] = true
+		}
+	}
+	for _, s := range subscriptions {
+		if s.clientID == keepID {
+			continue
+		}
+		query := "UPDATE subscriptions SET client_id = ? WHERE id = ?"
+		args := []any{keepID, s.id}
+		if taken[s.topicID] {
+			query, args = "DELETE FROM subscriptions WHERE id = ?", []any{s.id}
+		}
+		if _, err := tx.ExecContext(ctx, rewrite(query), args...); err != nil {
+			return err
+		}
+		taken[s.topicID] = true
+	}
+	return nil
+}
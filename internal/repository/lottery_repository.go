@@ -1,35 +1,424 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 )
 
 type LotteryRepository struct {
-	DB *sql.DB
+	DB      *sql.DB
+	Replica *sql.DB // optional, serves lookups
 }
 
-func (lr *LotteryRepository) GetLotteryByShortNumber(shortNumber string, currentDateTime time.Time) (int64, string, string, error) {
-	var id int64
-	var code, answer string
+// Lottery entry policies, stored in lotteries.entry_policy.
+const (
+	EntryPolicyOne    = "one"    // a single entry per client
+	EntryPolicyDaily  = "daily"  // up to daily_entry_limit entries per client per day
+	EntryPolicyTicket = "ticket" // every SMS is an extra ticket
+)
+
+type Lottery struct {
+	ID              int64
+	ShortNumber     string
+	StartsAt        time.Time
+	EndsAt          time.Time
+	Code            string
+	Answer          string
+	EntryPolicy     string
+	DailyEntryLimit int
+}
+
+// ErrEntryLimitReached is returned by InsertLotteryMessageAndUpdate when the
+// client may not enter again. The ticket number of the client's latest entry
+// is returned alongside it.
+var ErrEntryLimitReached = errors.New("lottery entry limit reached")
+
+func (lr *LotteryRepository) GetLotteryByShortNumber(ctx context.Context, shortNumber string, currentDateTime time.Time) (*Lottery, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
 	query := `
-        SELECT l.id, l.sms_code, l.sms_answer
+        SELECT l.id, l.sms_code, l.sms_answer, COALESCE(l.entry_policy, ?), COALESCE(l.daily_entry_limit, 1), l.start_time, l.end_time
         FROM lotteries l
         JOIN accounts a ON l.account_id = a.id
         WHERE a.short_number = ? AND l.start_time <= ? AND l.end_time >= ?
     `
-	err := lr.DB.QueryRow(query, shortNumber, currentDateTime, currentDateTime).Scan(&id, &code, &answer)
+	lottery := Lottery{ShortNumber: shortNumber}
+	err := lookupDB(lr.DB, lr.Replica).QueryRowContext(ctx, rewrite(query), EntryPolicyTicket, shortNumber, currentDateTime, currentDateTime).Scan(
+		&lottery.ID, &lottery.Code, &lottery.Answer, &lottery.EntryPolicy, &lottery.DailyEntryLimit, &lottery.StartsAt, &lottery.EndsAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &lottery, nil
+}
+
+// GetLotteriesEndingAfter returns all lotteries that end at or after from.
+func (lr *LotteryRepository) GetLotteriesEndingAfter(ctx context.Context, from time.Time) ([]Lottery, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := lookupDB(lr.DB, lr.Replica).QueryContext(ctx, rewrite(`
+        SELECT l.id, a.short_number, l.sms_code, l.sms_answer, COALESCE(l.entry_policy, ?), COALESCE(l.daily_entry_limit, 1), l.start_time, l.end_time
+        FROM lotteries l
+        JOIN accounts a ON l.account_id = a.id
+        WHERE l.end_time >= ?
+        ORDER BY l.id
+    `), EntryPolicyTicket, from)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lotteries []Lottery
+	for rows.Next() {
+		var lottery Lottery
+		if err := rows.Scan(&lottery.ID, &lottery.ShortNumber, &lottery.Code, &lottery.Answer, &lottery.EntryPolicy, &lottery.DailyEntryLimit, &lottery.StartsAt, &lottery.EndsAt); err != nil {
+			return nil, err
+		}
+		lotteries = append(lotteries, lottery)
+	}
+	return lotteries, rows.Err()
+}
+
+// InsertLotteryMessageAndUpdate records an entry according to the lottery's
+// entry policy and returns its ticket number. Ticket numbers are sequential
+// per lottery; the lottery row is locked so concurrent entries cannot share one.
+func (lr *LotteryRepository) InsertLotteryMessageAndUpdate(ctx context.Context, lottery *Lottery, message string, parsedDate time.Time, clientID int64) (int64, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := lr.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	var lockedID int64
+	if err = tx.QueryRowContext(ctx, rewrite("SELECT id FROM lotteries WHERE id = ? FOR UPDATE"), lottery.ID).Scan(&lockedID); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	var entries int
+	var lastTicket int64
+	switch lottery.EntryPolicy {
+	case EntryPolicyOne:
+		err = tx.QueryRowContext(ctx,
+			rewrite("SELECT COUNT(*), COALESCE(MAX(ticket_number), 0) FROM lottery_sms_messages WHERE lottery_id = ? AND client_id = ?"),
+			lottery.ID, clientID,
+		).Scan(&entries, &lastTicket)
+		if err == nil && entries > 0 {
+			err = ErrEntryLimitReached
+		}
+	case EntryPolicyDaily:
+		startOfDay := time.Date(parsedDate.Year(), parsedDate.Month(), parsedDate.Day(), 0, 0, 0, 0, parsedDate.Location())
+		endOfDay := startOfDay.Add(24 * time.Hour)
+		err = tx.QueryRowContext(ctx,
+			rewrite("SELECT COUNT(*), COALESCE(MAX(ticket_number), 0) FROM lottery_sms_messages WHERE lottery_id = ? AND client_id = ? AND dt >= ? AND dt < ?"),
+			lottery.ID, clientID, startOfDay, endOfDay,
+		).Scan(&entries, &lastTicket)
+		if err == nil && entries >= lottery.DailyEntryLimit {
+			err = ErrEntryLimitReached
+		}
+	}
+	if err != nil {
+		tx.Rollback()
+		return lastTicket, err
+	}
+
+	var ticket int64
+	err = tx.QueryRowContext(ctx,
+		rewrite("SELECT COALESCE(MAX(ticket_number), 0) + 1 FROM lottery_sms_messages WHERE lottery_id = ?"),
+		lottery.ID,
+	).Scan(&ticket)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		rewrite("INSERT INTO lottery_sms_messages (lottery_id, msg, dt, client_id, ticket_number) VALUES (?, ?, ?, ?, ?)"),
+		lottery.ID, message, parsedDate, clientID, ticket,
+	)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	return ticket, tx.Commit()
+}
+
+// LotteryDraw is a committed draw. The entries it is made from, the lotteries
+// whose winners are excluded and the seed hash are fixed when it is committed;
+// the seed itself is only stored once the draw is performed.
+type LotteryDraw struct {
+	ID                 int64
+	LotteryID          int64
+	SeedHash           string
+	Seed               string
+	LastEntryID        int64 // entries with a higher ID arrived after the commit
+	EntriesDigest      string
+	ExcludedLotteryIDs []int64
+	CommittedAt        time.Time
+	DrawnAt            sql.NullTime
+}
+
+type LotteryEntry struct {
+	ID       int64
+	ClientID int64
+	Phone    string
+}
+
+type LotteryWinner struct {
+	Position int
+	Entry    LotteryEntry
+}
+
+var (
+	ErrDrawCompleted = errors.New("lottery draw has already been completed")
+	ErrDrawCommitted = errors.New("lottery already has a committed draw")
+)
+
+func (lr *LotteryRepository) GetLotteryShortNumber(ctx context.Context, lotteryID int64) (string, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var shortNumber string
+	err := lr.DB.QueryRowContext(ctx,
+		rewrite("SELECT a.short_number FROM lotteries l JOIN accounts a ON l.account_id = a.id WHERE l.id = ?"),
+		lotteryID,
+	).Scan(&shortNumber)
+	if err != nil {
+		return "", err
+	}
+	return shortNumber, nil
+}
+
+func (lr *LotteryRepository) GetLotteryEndTime(ctx context.Context, lotteryID int64) (time.Time, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var endTime time.Time
+	err := lr.DB.QueryRowContext(ctx, rewrite("SELECT end_time FROM lotteries WHERE id = ?"), lotteryID).Scan(&endTime)
+	return endTime, err
+}
+
+// CreateDraw stores the commitment for a future draw. A lottery has at most
+// one draw, so a seed cannot be replaced by committing again; ErrDrawCommitted
+// is returned when one exists.
+func (lr *LotteryRepository) CreateDraw(ctx context.Context, draw *LotteryDraw) (int64, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := lr.DB.BeginTx(ctx, nil)
 	if err != nil {
-		return 0, "", "", err
+		return 0, err
 	}
-	return id, code, answer, nil
+
+	// Lock the lottery so that concurrent commits are serialized
+	var lotteryID int64
+	if err := tx.QueryRowContext(ctx, rewrite("SELECT id FROM lotteries WHERE id = ? FOR UPDATE"), draw.LotteryID).Scan(&lotteryID); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	var existing int
+	if err := tx.QueryRowContext(ctx, rewrite("SELECT COUNT(*) FROM lottery_draws WHERE lottery_id = ?"), draw.LotteryID).Scan(&existing); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if existing > 0 {
+		tx.Rollback()
+		return 0, ErrDrawCommitted
+	}
+
+	drawID, err := insertID(ctx, tx,
+		"INSERT INTO lottery_draws (lottery_id, seed_hash, last_entry_id, entries_digest, excluded_lottery_ids, committed_at) VALUES (?, ?, ?, ?, ?, ?)",
+		draw.LotteryID, draw.SeedHash, draw.LastEntryID, draw.EntriesDigest, formatIDs(draw.ExcludedLotteryIDs), draw.CommittedAt,
+	)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	return drawID, tx.Commit()
+}
+
+func (lr *LotteryRepository) GetDraw(ctx context.Context, drawID int64) (*LotteryDraw, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var draw LotteryDraw
+	var seed, excluded sql.NullString
+	err := lr.DB.QueryRowContext(ctx,
+		rewrite("SELECT id, lottery_id, seed_hash, seed, last_entry_id, entries_digest, excluded_lottery_ids, committed_at, drawn_at FROM lottery_draws WHERE id = ?"),
+		drawID,
+	).Scan(&draw.ID, &draw.LotteryID, &draw.SeedHash, &seed, &draw.LastEntryID, &draw.EntriesDigest, &excluded, &draw.CommittedAt, &draw.DrawnAt)
+	if err != nil {
+		return nil, err
+	}
+	draw.Seed = seed.String
+	if draw.ExcludedLotteryIDs, err = parseIDs(excluded.String); err != nil {
+		return nil, fmt.Errorf("invalid excluded_lottery_ids of draw %d: %w", drawID, err)
+	}
+	return &draw, nil
+}
+
+// GetLotteryEntries returns the entries of the lottery up to and including
+// lastEntryID in a stable order.
+func (lr *LotteryRepository) GetLotteryEntries(ctx context.Context, lotteryID, lastEntryID int64) ([]LotteryEntry, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := lr.DB.QueryContext(ctx, rewrite(`
+        SELECT m.id, m.client_id, c.phone
+        FROM lottery_sms_messages m
+        JOIN clients c ON m.client_id = c.id
+        WHERE m.lottery_id = ? AND m.id <= ?
+        ORDER BY m.id
+    `), lotteryID, lastEntryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []LotteryEntry
+	for rows.Next() {
+		var entry LotteryEntry
+		if err := rows.Scan(&entry.ID, &entry.ClientID, &entry.Phone); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// GetWinnerClientIDs returns the clients that won a draw of one of the
+// lotteries performed before drawnBefore.
+func (lr *LotteryRepository) GetWinnerClientIDs(ctx context.Context, lotteryIDs []int64, drawnBefore time.Time) (map[int64]bool, error) {
+	winners := make(map[int64]bool)
+	if len(lotteryIDs) == 0 {
+		return winners, nil
+	}
+
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	args := make([]any, 0, len(lotteryIDs)+1)
+	for _, id := range lotteryIDs {
+		args = append(args, id)
+	}
+	args = append(args, drawnBefore)
+
+	rows, err := lr.DB.QueryContext(ctx, rewrite(`
+        SELECT DISTINCT w.client_id
+        FROM lottery_draw_winners w
+        JOIN lottery_draws d ON w.draw_id = d.id
+        WHERE w.lottery_id IN (?`+strings.Repeat(", ?", len(lotteryIDs)-1)+`) AND d.drawn_at <= ?
+    `), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var clientID int64
+		if err := rows.Scan(&clientID); err != nil {
+			return nil, err
+		}
+		winners[clientID] = true
+	}
+	return winners, rows.Err()
+}
+
+// SaveDrawResults marks the draw as performed with its revealed seed and
+// stores its winners. A draw can only be completed once.
+func (lr *LotteryRepository) SaveDrawResults(ctx context.Context, draw *LotteryDraw, seed string, winners []LotteryWinner, drawnAt time.Time) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := lr.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx,
+		rewrite("UPDATE lottery_draws SET seed = ?, drawn_at = ? WHERE id = ? AND drawn_at IS NULL"),
+		seed, drawnAt, draw.ID,
+	)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		tx.Rollback()
+		return err
+	} else if affected == 0 {
+		tx.Rollback()
+		return ErrDrawCompleted
+	}
+
+	for _, winner := range winners {
+		_, err = tx.ExecContext(ctx,
+			rewrite("INSERT INTO lottery_draw_winners (draw_id, lottery_id, lottery_sms_message_id, client_id, position) VALUES (?, ?, ?, ?, ?)"),
+			draw.ID, draw.LotteryID, winner.Entry.ID, winner.Entry.ClientID, winner.Position,
+		)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func formatIDs(ids []int64) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.FormatInt(id, 10)
+	}
+	return strings.Join(parts, ",")
+}
+
+func parseIDs(value string) ([]int64, error) {
+	var ids []int64
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
 }
 
-func (lr *LotteryRepository) InsertLotteryMessageAndUpdate(id int64, message string, parsedDate time.Time, clientID int64) error {
+// RecordUnmatchedEntry stores an SMS whose text did not match the lottery code
+// and returns how many unmatched entries the client has sent to the lottery.
+func (lr *LotteryRepository) RecordUnmatchedEntry(ctx context.Context, lotteryID int64, message string, parsedDate time.Time, clientID int64) (int, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
 
-	_, err := lr.DB.Exec(
-		"INSERT INTO lottery_sms_messages (lottery_id, msg, dt, client_id) VALUES (?, ?, ?, ?)",
-		id, message, parsedDate, clientID,
+	_, err := lr.DB.ExecContext(ctx,
+		rewrite("INSERT INTO lottery_unmatched_messages (lottery_id, msg, dt, client_id) VALUES (?, ?, ?, ?)"),
+		lotteryID, message, parsedDate, clientID,
 	)
-	return err
+	if err != nil {
+		return 0, err
+	}
+
+	var attempts int
+	err = lr.DB.QueryRowContext(ctx,
+		rewrite("SELECT COUNT(*) FROM lottery_unmatched_messages WHERE lottery_id = ? AND client_id = ?"),
+		lotteryID, clientID,
+	).Scan(&attempts)
+	if err != nil {
+		return 0, err
+	}
+	return attempts, nil
 }
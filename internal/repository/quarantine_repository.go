@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrAlreadyReplayed = errors.New("quarantined message has already been replayed")
+
+// QuarantinedMessage is an SMS whose processing panicked. It is kept as
+// received so it can be replayed once the cause is fixed.
+type QuarantinedMessage struct {
+	ID            int64
+	Source        string
+	Destination   string
+	Text          string
+	Date          string
+	Panic         string
+	Stack         string
+	QuarantinedAt time.Time
+	ReplayedAt    sql.NullTime
+}
+
+type QuarantineRepository struct {
+	DB *sql.DB
+}
+
+func (qr *QuarantineRepository) InsertQuarantinedMessage(ctx context.Context, message *QuarantinedMessage) (int64, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	return insertID(ctx, qr.DB,
+		"INSERT INTO quarantined_messages (src, dst, msg, date, panic, stack, quarantined_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		message.Source, message.Destination, message.Text, message.Date, message.Panic, message.Stack, message.QuarantinedAt,
+	)
+}
+
+// GetQuarantinedMessages returns messages that have not been replayed yet, oldest first.
+func (qr *QuarantineRepository) GetQuarantinedMessages(ctx context.Context, limit int) ([]QuarantinedMessage, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := qr.DB.QueryContext(ctx, rewrite(`
+        SELECT id, src, dst, msg, date, panic, stack, quarantined_at, replayed_at
+        FROM quarantined_messages
+        WHERE replayed_at IS NULL
+        ORDER BY id
+        LIMIT ?
+    `), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []QuarantinedMessage
+	for rows.Next() {
+		var message QuarantinedMessage
+		if err := rows.Scan(&message.ID, &message.Source, &message.Destination, &message.Text, &message.Date, &message.Panic, &message.Stack, &message.QuarantinedAt, &message.ReplayedAt); err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+	return messages, rows.Err()
+}
+
+// ClaimForReplay marks the message as replayed and returns it. A message can
+// only be claimed once; later claims return ErrAlreadyReplayed.
+func (qr *QuarantineRepository) ClaimForReplay(ctx context.Context, id int64, replayedAt time.Time) (*QuarantinedMessage, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	result, err := qr.DB.ExecContext(ctx,
+		rewrite("UPDATE quarantined_messages SET replayed_at = ? WHERE id = ? AND replayed_at IS NULL"),
+		replayedAt, id,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var message QuarantinedMessage
+	err = qr.DB.QueryRowContext(ctx,
+		rewrite("SELECT id, src, dst, msg, date, panic, stack, quarantined_at, replayed_at FROM quarantined_messages WHERE id = ?"),
+		id,
+	).Scan(&message.ID, &message.Source, &message.Destination, &message.Text, &message.Date, &message.Panic, &message.Stack, &message.QuarantinedAt, &message.ReplayedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if affected, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if affected == 0 {
+		return &message, ErrAlreadyReplayed
+	}
+	return &message, nil
+}
+
+// ReleaseReplay clears the replay mark set by ClaimForReplay, so that a replay
+// that failed for a reason a retry may fix can be claimed again.
+func (qr *QuarantineRepository) ReleaseReplay(ctx context.Context, id int64) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	_, err := qr.DB.ExecContext(ctx, rewrite("UPDATE quarantined_messages SET replayed_at = NULL WHERE id = ?"), id)
+	return err
+}
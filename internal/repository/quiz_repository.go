@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 
 	// "errors"
@@ -8,80 +9,148 @@ import (
 	"time"
 )
 
-type QuestionScoringInfo struct {
-	ID                         int64  // Question ID
-	QuizID                     int64  // Quiz ID
-	Answer                     string // Question answer
-	Score                      int    // Question score
-	HasScored                  bool   // Whether the client has scored or not
+// Question is a quiz question, as held by the campaign cache.
+type Question struct {
+	ID          int64  // Question ID
+	QuizID      int64  // Quiz ID
+	ShortNumber string // Short number of the quiz account
+	Answer      string // Question answer
+	Score       int    // Question score
+	StartsAt    time.Time
+	EndsAt      time.Time
+}
+
+// ScoringInfo is what scoring an answer needs beyond the question. It changes
+// with every answer and is never cached.
+type ScoringInfo struct {
+	HasScored                  bool // Whether the client has scored or not
 	HasMistake                 bool
 	NextSerialNumber           int // The next serial number for the answer
 	NextSerialNumberForCorrect int // The next serial number for correct answers
 }
 
 type QuizRepository struct {
-	DB *sql.DB
+	DB      *sql.DB
+	Replica *sql.DB // optional, serves lookups
 }
 
-func (qr *QuizRepository) GetQuestionAndScoringInfo(shortNumber string, currentDateTime time.Time, clientID int64) (*QuestionScoringInfo, error) {
+// GetQuestion returns the question active on shortNumber at currentDateTime.
+func (qr *QuizRepository) GetQuestion(ctx context.Context, shortNumber string, currentDateTime time.Time) (*Question, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
 	query := `
-		SELECT 
-			q.id, 
-			q.quiz_id, 
-			q.answer, 
-			q.score,
-			IFNULL((
-				SELECT COUNT(*) 
-				FROM answers 
-				WHERE question_id = q.id AND client_id = ? AND score > 0
-			), 0) AS has_scored,
-			IFNULL((SELECT COUNT(*) FROM answers WHERE question_id = ? AND client_id = ? AND score = 0
-			), 0) AS has_mistake,
-			IFNULL((
-				SELECT MAX(serial_number) + 1 
-				FROM answers 
-				WHERE question_id = q.id
-			), 1) AS next_serial_number,
-			IFNULL((
-				SELECT MAX(serial_number_for_correct) + 1 
-				FROM answers 
-				WHERE question_id = q.id AND score > 0
-			), 1) AS next_serial_number_for_correct
+		SELECT q.id, q.quiz_id, q.answer, q.score, q.starts_at, q.ends_at
 		FROM questions q
 		JOIN quizzes z ON q.quiz_id = z.id
 		JOIN accounts a ON z.account_id = a.id
 		WHERE a.short_number = ? AND q.starts_at <= ? AND q.ends_at >= ?
+		ORDER BY q.id
 		LIMIT 1
 	`
 
-	var result QuestionScoringInfo
+	question := Question{ShortNumber: shortNumber}
+	err := lookupDB(qr.DB, qr.Replica).QueryRowContext(ctx, rewrite(query), shortNumber, currentDateTime, currentDateTime).Scan(
+		&question.ID, &question.QuizID, &question.Answer, &question.Score, &question.StartsAt, &question.EndsAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &question, nil
+}
+
+// GetQuestionsEndingAfter returns all questions that end at or after from.
+func (qr *QuizRepository) GetQuestionsEndingAfter(ctx context.Context, from time.Time) ([]Question, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := lookupDB(qr.DB, qr.Replica).QueryContext(ctx, rewrite(`
+		SELECT q.id, q.quiz_id, a.short_number, q.answer, q.score, q.starts_at, q.ends_at
+		FROM questions q
+		JOIN quizzes z ON q.quiz_id = z.id
+		JOIN accounts a ON z.account_id = a.id
+		WHERE q.ends_at >= ?
+		ORDER BY q.id
+	`), from)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var questions []Question
+	for rows.Next() {
+		var question Question
+		if err := rows.Scan(&question.ID, &question.QuizID, &question.ShortNumber, &question.Answer, &question.Score, &question.StartsAt, &question.EndsAt); err != nil {
+			return nil, err
+		}
+		questions = append(questions, question)
+	}
+	return questions, rows.Err()
+}
+
+// GetScoringInfo returns whether clientID has already answered questionID and
+// the serial numbers the next answer gets.
+func (qr *QuizRepository) GetScoringInfo(ctx context.Context, questionID, clientID int64) (*ScoringInfo, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT
+			COALESCE((
+				SELECT COUNT(*)
+				FROM answers
+				WHERE question_id = ? AND client_id = ? AND score > 0
+			), 0) AS has_scored,
+			COALESCE((
+				SELECT COUNT(*)
+				FROM answers
+				WHERE question_id = ? AND client_id = ? AND score = 0
+			), 0) AS has_mistake,
+			COALESCE((
+				SELECT MAX(serial_number) + 1
+				FROM answers
+				WHERE question_id = ?
+			), 1) AS next_serial_number,
+			COALESCE((
+				SELECT MAX(serial_number_for_correct) + 1
+				FROM answers
+				WHERE question_id = ? AND score > 0
+			), 1) AS next_serial_number_for_correct
+	`
+
+	var result ScoringInfo
 	var hasScoredInt, hasMistakeInt int
 
-	err := qr.DB.QueryRow(query, clientID, clientID, shortNumber, currentDateTime, currentDateTime).Scan(
-		&result.ID, &result.QuizID, &result.Answer, &result.Score, &hasScoredInt, &hasMistakeInt, &result.NextSerialNumber, &result.NextSerialNumberForCorrect,
+	err := consistentDB(qr.DB, qr.Replica).QueryRowContext(ctx, rewrite(query), questionID, clientID, questionID, clientID, questionID, questionID).Scan(
+		&hasScoredInt, &hasMistakeInt, &result.NextSerialNumber, &result.NextSerialNumberForCorrect,
 	)
-
 	if err != nil {
 		return nil, err
 	}
 
-	// Convert hasScored integer to boolean
 	result.HasScored = hasScoredInt > 0
+	result.HasMistake = hasMistakeInt > 0
 
 	return &result, nil
 }
 
-func (qr *QuizRepository) InsertAnswer(questionID int64, msg string, dt time.Time, clientID int64, score int, serialNumber int, serialNumberForCorrect int) error {
-	_, err := qr.DB.Exec(
-		"INSERT INTO answers (question_id, msg, dt, client_id, score, quiz_id, serial_number, serial_number_for_correct) VALUES (?, ?, ?, ?, ?, (SELECT quiz_id FROM questions WHERE id = ?), ?, ?)",
+func (qr *QuizRepository) InsertAnswer(ctx context.Context, questionID int64, msg string, dt time.Time, clientID int64, score int, serialNumber int, serialNumberForCorrect int) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	_, err := qr.DB.ExecContext(ctx,
+		rewrite("INSERT INTO answers (question_id, msg, dt, client_id, score, quiz_id, serial_number, serial_number_for_correct) VALUES (?, ?, ?, ?, ?, (SELECT quiz_id FROM questions WHERE id = ?), ?, ?)"),
 		questionID, msg, dt, clientID, score, questionID, serialNumber, serialNumberForCorrect,
 	)
 	return err
 }
 
-func (qr *QuizRepository) GetIncorrectAnswerCount(questionID, clientID int64) (int, error) {
+func (qr *QuizRepository) GetIncorrectAnswerCount(ctx context.Context, questionID, clientID int64) (int, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
 	var count int
-	err := qr.DB.QueryRow("SELECT COUNT(*) FROM answers WHERE question_id = ? AND client_id = ? AND score = 0", questionID, clientID).Scan(&count)
+	err := qr.DB.QueryRowContext(ctx, rewrite("SELECT COUNT(*) FROM answers WHERE question_id = ? AND client_id = ? AND score = 0"), questionID, clientID).Scan(&count)
 	if err != nil {
 		return 0, err
 	}
@@ -1,43 +1,177 @@
 package repository
 
 import (
+	db "answers-processor/pkg/database"
 	"answers-processor/pkg/logger"
+	"context"
 	"database/sql"
+	"time"
 )
 
-var loggers *logger.Loggers
+var (
+	loggers      *logger.Loggers
+	queryTimeout time.Duration
+	dialect      db.Dialect = db.Dialects["mysql"]
 
-func Init(logInstance *logger.Loggers) {
+	consistentReadsOnPrimary = true
+)
+
+// Init sets the package logger, the deadline applied to every repository call
+// and the dialect queries are rewritten for. A zero timeout leaves calls
+// bounded only by the caller's context.
+func Init(logInstance *logger.Loggers, timeout time.Duration, queryDialect db.Dialect) {
 	loggers = logInstance
+	queryTimeout = timeout
+	dialect = queryDialect
+}
+
+// SetConsistentReadsOnPrimary chooses where consistency-critical reads go
+// when repositories have a replica. On the primary, a client's has-scored and
+// has-voted checks always see the client's previous message; on the replica
+// they take load off the primary but may miss writes during replication lag.
+func SetConsistentReadsOnPrimary(onPrimary bool) {
+	consistentReadsOnPrimary = onPrimary
+}
+
+// lookupDB returns the database pure lookups are sent to.
+func lookupDB(primary, replica *sql.DB) *sql.DB {
+	if replica != nil {
+		return replica
+	}
+	return primary
+}
+
+// consistentDB returns the database for reads that decide whether a write is
+// allowed, such as has-scored and has-voted checks.
+func consistentDB(primary, replica *sql.DB) *sql.DB {
+	if consistentReadsOnPrimary {
+		return primary
+	}
+	return lookupDB(primary, replica)
+}
+
+// rewrite adapts a query written for MySQL to the configured dialect.
+func rewrite(query string) string {
+	return dialect.Rewrite(query)
+}
+
+type execQueryer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// insertID runs an INSERT written for MySQL and returns the ID of the row.
+func insertID(ctx context.Context, q execQueryer, query string, args ...any) (int64, error) {
+	if dialect.ReturningID() {
+		var id int64
+		err := q.QueryRowContext(ctx, rewrite(query+" RETURNING id"), args...).Scan(&id)
+		return id, err
+	}
+
+	result, err := q.ExecContext(ctx, rewrite(query), args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func withQueryTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if queryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, queryTimeout)
 }
 
-func GetAccountType(db *sql.DB, shortNumber string) (string, error) {
+func GetAccountType(ctx context.Context, db *sql.DB, shortNumber string) (string, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
 	var accountType string
-	err := db.QueryRow("SELECT type FROM accounts WHERE short_number = ?", shortNumber).Scan(&accountType)
+	err := db.QueryRowContext(ctx, rewrite("SELECT type FROM accounts WHERE short_number = ?"), shortNumber).Scan(&accountType)
 	if err != nil {
 		return "", err
 	}
 	return accountType, nil
 }
 
-func InsertClientIfNotExists(db *sql.DB, phoneNumber string) (int64, error) {
-	var id int64
-	err := db.QueryRow("SELECT id FROM clients WHERE phone = ?", phoneNumber).Scan(&id)
-	if err != nil && err != sql.ErrNoRows {
+// UpsertClient returns the ID of the client with phoneNumber, in E.164 form,
+// creating the client if needed. The insert is a single statement, so
+// concurrent first messages from the same phone resolve to one client;
+// clients.phone must be unique, see HasUniqueIndex. gatewayPhone, the number as the SMS gateway
+// delivered it, is stored as well: messages that do not answer an SMS are
+// sent to it.
+func UpsertClient(ctx context.Context, db *sql.DB, phoneNumber, gatewayPhone string) (int64, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	now := time.Now()
+	id, err := insertID(ctx, db,
+		"INSERT INTO clients (phone, gateway_phone, created_at, updated_at) VALUES (?, ?, ?, ?) "+dialect.UpsertKeepID("phone"),
+		phoneNumber, gatewayPhone, now, now,
+	)
+	if err != nil {
 		return 0, err
 	}
-	if id == 0 {
-		result, err := db.Exec("INSERT INTO clients (phone, created_at, updated_at) VALUES (?, NOW(), NOW())", phoneNumber)
-		if err != nil {
-			return 0, err
+
+	_, err = db.ExecContext(ctx,
+		rewrite("UPDATE clients SET gateway_phone = ?, updated_at = ? WHERE id = ? AND (gateway_phone IS NULL OR gateway_phone <> ?)"),
+		gatewayPhone, now, id, gatewayPhone,
+	)
+	return id, err
+}
+
+// HasUniqueIndex reports whether table has a unique index on column alone.
+func HasUniqueIndex(ctx context.Context, db *sql.DB, table, column string) (bool, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var count int
+	err := db.QueryRowContext(ctx, rewrite(dialect.UniqueIndexQuery()), table, column).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// GetAccounts returns the account type of every short number.
+func GetAccounts(ctx context.Context, db *sql.DB) (map[string]string, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, rewrite("SELECT short_number, type FROM accounts"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := make(map[string]string)
+	for rows.Next() {
+		var shortNumber, accountType string
+		if err := rows.Scan(&shortNumber, &accountType); err != nil {
+			return nil, err
 		}
-		id, err = result.LastInsertId()
-		if err != nil {
-			return 0, err
+		accounts[shortNumber] = accountType
+	}
+	return accounts, rows.Err()
+}
+
+func GetAccountTypes(ctx context.Context, db *sql.DB) ([]string, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, rewrite("SELECT DISTINCT type FROM accounts"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var accountTypes []string
+	for rows.Next() {
+		var accountType string
+		if err := rows.Scan(&accountType); err != nil {
+			return nil, err
 		}
-		loggers.InfoLogger.Info("Inserted new client", "phone", phoneNumber)
-	} else {
-		loggers.InfoLogger.Info("Client already exists", "phone", phoneNumber)
+		accountTypes = append(accountTypes, accountType)
 	}
-	return id, nil
+	return accountTypes, rows.Err()
 }
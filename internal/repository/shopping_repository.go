@@ -1,15 +1,53 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"time"
 )
 
+const (
+	OrderStatusReserved  = "reserved"
+	OrderStatusConfirmed = "confirmed"
+	OrderStatusExpired   = "expired"
+)
+
+var ErrOrderNotReserved = errors.New("order is not awaiting confirmation")
+
+type LotOrder struct {
+	Quantity  int64
+	Variant   string
+	ExpiresAt time.Time // zero for orders that do not need confirmation
+}
+
+type ShopOrder struct {
+	ID          int64
+	LotID       int64
+	ClientID    int64
+	Phone       string
+	Quantity    int64
+	Variant     string
+	ShortNumber string
+}
+
+type OutOfStockError struct {
+	Available int64
+}
+
+func (e *OutOfStockError) Error() string {
+	return fmt.Sprintf("not enough stock, %d available", e.Available)
+}
+
 type ShopRepository struct {
 	DB *sql.DB
 }
 
-func (sr *ShopRepository) GetLotDetailsByShortNumber(shortNumber string, currentDateTime time.Time) (int64, string, error) {
+func (sr *ShopRepository) GetLotDetailsByShortNumber(ctx context.Context, shortNumber string, currentDateTime time.Time) (int64, string, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
 	var lotID int64
 	var description string
 	query := `
@@ -18,27 +56,160 @@ func (sr *ShopRepository) GetLotDetailsByShortNumber(shortNumber string, current
         JOIN accounts a ON l.account_id = a.id
         WHERE a.short_number = ? AND l.starts_at <= ? AND l.ends_at >= ?
     `
-	err := sr.DB.QueryRow(query, shortNumber, currentDateTime, currentDateTime).Scan(&lotID, &description)
+	err := sr.DB.QueryRowContext(ctx, rewrite(query), shortNumber, currentDateTime, currentDateTime).Scan(&lotID, &description)
 	if err != nil {
 		return 0, "", err
 	}
 	return lotID, description, nil
 }
 
-func (sr *ShopRepository) InsertLotMessageAndUpdate(lotID int64, msg string, dt time.Time, clientID int64) error {
-	tx, err := sr.DB.Begin()
+// InsertLotMessageAndUpdate stores the lot SMS and, in the same transaction,
+// reserves order.Quantity items from the lot's stock. Lots with a NULL stock
+// are unlimited. When there is not enough stock the message is still stored
+// and an *OutOfStockError is returned.
+func (sr *ShopRepository) InsertLotMessageAndUpdate(ctx context.Context, lotID int64, msg string, dt time.Time, clientID int64, order LotOrder) (int64, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := sr.DB.BeginTx(ctx, nil)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	_, err = tx.Exec(
+	messageID, err := insertID(ctx, tx,
 		"INSERT INTO lot_sms_messages (lot_id, msg, dt, client_id) VALUES (?, ?, ?, ?)",
 		lotID, msg, dt, clientID,
 	)
 	if err != nil {
 		tx.Rollback()
-		return err
+		return 0, err
+	}
+
+	// The lot is locked so that concurrent orders cannot oversell it
+	var stock sql.NullInt64
+	if err := tx.QueryRowContext(ctx, rewrite("SELECT stock FROM lots WHERE id = ? FOR UPDATE"), lotID).Scan(&stock); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if stock.Valid {
+		if stock.Int64 < order.Quantity {
+			if err := tx.Commit(); err != nil {
+				return 0, err
+			}
+			return 0, &OutOfStockError{Available: max(stock.Int64, 0)}
+		}
+		if _, err := tx.ExecContext(ctx, rewrite("UPDATE lots SET stock = stock - ? WHERE id = ?"), order.Quantity, lotID); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+
+	var expiresAt any
+	status := OrderStatusConfirmed
+	if !order.ExpiresAt.IsZero() {
+		expiresAt = order.ExpiresAt
+		status = OrderStatusReserved
+	}
+
+	orderID, err := insertID(ctx, tx,
+		"INSERT INTO lot_orders (lot_id, client_id, lot_sms_message_id, quantity, variant, status, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		lotID, clientID, messageID, order.Quantity, order.Variant, status, dt, expiresAt,
+	)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	return orderID, tx.Commit()
+}
+
+// ConfirmOrder confirms a reserved order and returns it. Orders that are not
+// reserved or whose reservation expired before currentDateTime are left
+// untouched and ErrOrderNotReserved is returned.
+func (sr *ShopRepository) ConfirmOrder(ctx context.Context, id int64, currentDateTime time.Time) (*ShopOrder, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	result, err := sr.DB.ExecContext(ctx,
+		rewrite("UPDATE lot_orders SET status = ? WHERE id = ? AND status = ? AND expires_at >= ?"),
+		OrderStatusConfirmed, id, OrderStatusReserved, currentDateTime,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var order ShopOrder
+	err = sr.DB.QueryRowContext(ctx, rewrite(`
+        SELECT o.id, o.lot_id, o.client_id, c.phone, o.quantity, o.variant, a.short_number
+        FROM lot_orders o
+        JOIN clients c ON o.client_id = c.id
+        JOIN lots l ON o.lot_id = l.id
+        JOIN accounts a ON l.account_id = a.id
+        WHERE o.id = ?
+    `), id).Scan(&order.ID, &order.LotID, &order.ClientID, &order.Phone, &order.Quantity, &order.Variant, &order.ShortNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	if affected, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if affected == 0 {
+		return &order, ErrOrderNotReserved
+	}
+	return &order, nil
+}
+
+// ExpireReservations marks reservations that expired before currentDateTime as
+// expired and returns their quantities to the lots' stock.
+func (sr *ShopRepository) ExpireReservations(ctx context.Context, currentDateTime time.Time) ([]ShopOrder, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := sr.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx, rewrite(`
+        SELECT o.id, o.lot_id, o.client_id, c.phone, o.quantity, o.variant, a.short_number
+        FROM lot_orders o
+        JOIN clients c ON o.client_id = c.id
+        JOIN lots l ON o.lot_id = l.id
+        JOIN accounts a ON l.account_id = a.id
+        WHERE o.status = ? AND o.expires_at < ?
+        FOR UPDATE
+    `), OrderStatusReserved, currentDateTime)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	var expired []ShopOrder
+	for rows.Next() {
+		var order ShopOrder
+		if err := rows.Scan(&order.ID, &order.LotID, &order.ClientID, &order.Phone, &order.Quantity, &order.Variant, &order.ShortNumber); err != nil {
+			rows.Close()
+			tx.Rollback()
+			return nil, err
+		}
+		expired = append(expired, order)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	for _, order := range expired {
+		if _, err := tx.ExecContext(ctx, rewrite("UPDATE lot_orders SET status = ? WHERE id = ?"), OrderStatusExpired, order.ID); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if _, err := tx.ExecContext(ctx, rewrite("UPDATE lots SET stock = stock + ? WHERE id = ? AND stock IS NOT NULL"), order.Quantity, order.LotID); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
 	}
 
-	return tx.Commit()
+	return expired, tx.Commit()
 }
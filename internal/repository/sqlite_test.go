@@ -0,0 +1,537 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	db "answers-processor/pkg/database"
+	"answers-processor/pkg/logger"
+
+	_ "modernc.org/sqlite"
+)
+
+// The business timezone of the tests, five hours ahead of UTC like Ashgabat.
+var businessLocation = time.FixedZone("TMT", 5*60*60)
+
+const sqliteSchema = `
+CREATE TABLE accounts (id INTEGER PRIMARY KEY, short_number TEXT NOT NULL, type TEXT NOT NULL);
+CREATE TABLE clients (
+    id INTEGER PRIMARY KEY, phone TEXT NOT NULL UNIQUE, gateway_phone TEXT,
+    created_at DATETIME, updated_at DATETIME
+);
+CREATE TABLE lots (
+    id INTEGER PRIMARY KEY, account_id INTEGER NOT NULL, description TEXT NOT NULL DEFAULT '',
+    stock INTEGER, starts_at DATETIME NOT NULL, ends_at DATETIME NOT NULL
+);
+CREATE TABLE lot_sms_messages (id INTEGER PRIMARY KEY, lot_id INTEGER, msg TEXT, dt DATETIME, client_id INTEGER);
+CREATE TABLE lot_orders (
+    id INTEGER PRIMARY KEY, lot_id INTEGER, client_id INTEGER, lot_sms_message_id INTEGER,
+    quantity INTEGER, variant TEXT, status TEXT, created_at DATETIME, expires_at DATETIME
+);
+CREATE TABLE votings (
+    id INTEGER PRIMARY KEY, account_id INTEGER NOT NULL, status TEXT NOT NULL,
+    starts_at DATETIME NOT NULL, ends_at DATETIME NOT NULL
+);
+CREATE TABLE voting_items (
+    id INTEGER PRIMARY KEY, voting_id INTEGER NOT NULL, title TEXT NOT NULL,
+    vote_code TEXT NOT NULL, votes_count INTEGER NOT NULL DEFAULT 0
+);
+CREATE TABLE voting_sms_messages (
+    id INTEGER PRIMARY KEY, voting_id INTEGER, voting_item_id INTEGER, msg TEXT, dt DATETIME, client_id INTEGER
+);
+CREATE TABLE subscription_topics (id INTEGER PRIMARY KEY, account_id INTEGER NOT NULL, code TEXT, name TEXT);
+CREATE TABLE subscription_contents (
+    id INTEGER PRIMARY KEY, topic_id INTEGER NOT NULL, text TEXT NOT NULL,
+    send_at DATETIME NOT NULL, claimed_until DATETIME, sent_at DATETIME
+);
+CREATE TABLE subscriptions (id INTEGER PRIMARY KEY, topic_id INTEGER NOT NULL, client_id INTEGER NOT NULL, status TEXT NOT NULL);
+CREATE TABLE subscription_deliveries (
+    content_id INTEGER NOT NULL, client_id INTEGER NOT NULL, delivered_at DATETIME NOT NULL,
+    PRIMARY KEY (content_id, client_id)
+);
+CREATE TABLE survey_sessions (
+    id INTEGER PRIMARY KEY, survey_id INTEGER NOT NULL, client_id INTEGER NOT NULL,
+    current_position INTEGER NOT NULL, status TEXT NOT NULL, started_at DATETIME, updated_at DATETIME
+);
+CREATE TABLE survey_answers (
+    id INTEGER PRIMARY KEY, session_id INTEGER NOT NULL, survey_id INTEGER NOT NULL, question_id INTEGER NOT NULL,
+    client_id INTEGER NOT NULL, answer TEXT NOT NULL, dt DATETIME
+);
+CREATE TABLE quarantined_messages (
+    id INTEGER PRIMARY KEY, src TEXT, dst TEXT, msg TEXT, date TEXT, panic TEXT, stack TEXT,
+    quarantined_at DATETIME NOT NULL, replayed_at DATETIME
+);
+INSERT INTO accounts (id, short_number, type) VALUES (1, '0123', 'shop'), (2, '0456', 'voting'), (3, '0789', 'subscription');
+`
+
+// openSQLite returns a fresh SQLite database with the tables the tests use
+// and points the repository at the sqlite dialect until the test ends.
+func openSQLite(t *testing.T) *sql.DB {
+	t.Helper()
+
+	logInstance, err := logger.SetupLogger("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previousLoggers, previousTimeout, previousDialect := loggers, queryTimeout, dialect
+	Init(logInstance, 0, db.Dialects["sqlite"])
+	t.Cleanup(func() {
+		Init(previousLoggers, previousTimeout, previousDialect)
+	})
+
+	database, err := db.Dialects["sqlite"].Open("sqlite", filepath.Join(t.TempDir(), "test.db"), businessLocation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	if _, err := database.Exec(sqliteSchema); err != nil {
+		t.Fatal(err)
+	}
+	return database
+}
+
+// businessTime returns a wall-clock time in the business timezone.
+func businessTime(day, hour, minute int) time.Time {
+	return time.Date(2024, time.March, day, hour, minute, 0, 0, businessLocation)
+}
+
+func TestSQLiteUpsertClient(t *testing.T) {
+	database := openSQLite(t)
+	ctx := context.Background()
+
+	first, err := UpsertClient(ctx, database, "+99365123456", "865123456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := UpsertClient(ctx, database, "+99365123456", "99365123456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := UpsertClient(ctx, database, "+99365000000", "865000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != first || other == first {
+		t.Errorf("UpsertClient IDs = %d, %d, %d; want the first two equal and the third different", first, again, other)
+	}
+
+	var gatewayPhone string
+	if err := database.QueryRow("SELECT gateway_phone FROM clients WHERE id = ?", first).Scan(&gatewayPhone); err != nil {
+		t.Fatal(err)
+	}
+	if gatewayPhone != "99365123456" {
+		t.Errorf("gateway_phone = %q; want the latest form %q", gatewayPhone, "99365123456")
+	}
+}
+
+func TestSQLiteHasUniqueIndex(t *testing.T) {
+	database := openSQLite(t)
+	ctx := context.Background()
+
+	if _, err := database.Exec(`
+        CREATE TABLE pairs (a TEXT, b TEXT, c TEXT);
+        CREATE UNIQUE INDEX pairs_a_b ON pairs (a, b);
+        CREATE INDEX pairs_c ON pairs (c);
+    `); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		table  string
+		column string
+		want   bool
+	}{
+		{"clients", "phone", true},
+		{"clients", "gateway_phone", false},
+		{"pairs", "a", false}, // only unique together with b
+		{"pairs", "c", false}, // not unique
+		{"missing", "phone", false},
+	}
+
+	for _, tt := range tests {
+		got, err := HasUniqueIndex(ctx, database, tt.table, tt.column)
+		if err != nil || got != tt.want {
+			t.Errorf("HasUniqueIndex(%s, %s) = %v, %v; want %v", tt.table, tt.column, got, err, tt.want)
+		}
+	}
+}
+
+func TestSQLiteShopStock(t *testing.T) {
+	tests := []struct {
+		name          string
+		stock         sql.NullInt64
+		quantity      int64
+		wantAvailable int64 // of the *OutOfStockError, -1 when the order succeeds
+		wantStock     sql.NullInt64
+	}{
+		{"unlimited", sql.NullInt64{}, 5, -1, sql.NullInt64{}},
+		{"enough stock", sql.NullInt64{Int64: 3, Valid: true}, 2, -1, sql.NullInt64{Int64: 1, Valid: true}},
+		{"all of the stock", sql.NullInt64{Int64: 2, Valid: true}, 2, -1, sql.NullInt64{Int64: 0, Valid: true}},
+		{"out of stock", sql.NullInt64{Int64: 1, Valid: true}, 2, 1, sql.NullInt64{Int64: 1, Valid: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := openSQLite(t)
+			ctx := context.Background()
+			repo := &ShopRepository{DB: database}
+
+			_, err := database.Exec("INSERT INTO lots (id, account_id, stock, starts_at, ends_at) VALUES (1, 1, ?, ?, ?)",
+				tt.stock, businessTime(1, 0, 0), businessTime(31, 0, 0))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			lotID, _, err := repo.GetLotDetailsByShortNumber(ctx, "0123", businessTime(15, 12, 0))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = repo.InsertLotMessageAndUpdate(ctx, lotID, "buy", businessTime(15, 12, 0), 1, LotOrder{Quantity: tt.quantity})
+
+			var outOfStock *OutOfStockError
+			switch {
+			case tt.wantAvailable < 0 && err != nil:
+				t.Errorf("InsertLotMessageAndUpdate: %v; want success", err)
+			case tt.wantAvailable >= 0 && !errors.As(err, &outOfStock):
+				t.Errorf("InsertLotMessageAndUpdate: %v; want *OutOfStockError", err)
+			case tt.wantAvailable >= 0 && outOfStock.Available != tt.wantAvailable:
+				t.Errorf("available = %d; want %d", outOfStock.Available, tt.wantAvailable)
+			}
+
+			var stock sql.NullInt64
+			if err := database.QueryRow("SELECT stock FROM lots WHERE id = 1").Scan(&stock); err != nil {
+				t.Fatal(err)
+			}
+			if stock != tt.wantStock {
+				t.Errorf("stock = %v; want %v", stock, tt.wantStock)
+			}
+		})
+	}
+}
+
+func TestSQLiteExpireReservations(t *testing.T) {
+	database := openSQLite(t)
+	ctx := context.Background()
+	repo := &ShopRepository{DB: database}
+
+	if _, err := database.Exec("INSERT INTO clients (id, phone) VALUES (1, '+99365123456')"); err != nil {
+		t.Fatal(err)
+	}
+	_, err := database.Exec("INSERT INTO lots (id, account_id, stock, starts_at, ends_at) VALUES (1, 1, 10, ?, ?)",
+		businessTime(1, 0, 0), businessTime(31, 0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiresAt := businessTime(15, 12, 15)
+	if _, err := repo.InsertLotMessageAndUpdate(ctx, 1, "buy 4", businessTime(15, 12, 0), 1, LotOrder{Quantity: 4, ExpiresAt: expiresAt}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Times in another location, such as time.Now() on a UTC host, compare
+	// by instant: 07:14 UTC is before 12:15 in the business timezone
+	expired, err := repo.ExpireReservations(ctx, expiresAt.Add(-time.Minute).UTC())
+	if err != nil || len(expired) != 0 {
+		t.Fatalf("ExpireReservations before expiry = %v, %v; want none", expired, err)
+	}
+	expired, err = repo.ExpireReservations(ctx, expiresAt.Add(time.Minute).UTC())
+	if err != nil || len(expired) != 1 || expired[0].Quantity != 4 {
+		t.Fatalf("ExpireReservations after expiry = %v, %v; want the order of 4", expired, err)
+	}
+
+	var stock int64
+	if err := database.QueryRow("SELECT stock FROM lots WHERE id = 1").Scan(&stock); err != nil {
+		t.Fatal(err)
+	}
+	if stock != 10 {
+		t.Errorf("stock = %d; want the reservation returned, 10", stock)
+	}
+}
+
+func TestSQLiteConfirmOrder(t *testing.T) {
+	expiresAt := businessTime(15, 12, 15)
+
+	tests := []struct {
+		name    string
+		now     time.Time
+		wantErr error
+		want    string // status of the order afterwards
+	}{
+		{"before expiry", expiresAt.Add(-time.Minute).UTC(), nil, OrderStatusConfirmed},
+		{"at expiry", expiresAt, nil, OrderStatusConfirmed},
+		{"after expiry", expiresAt.Add(time.Minute).UTC(), ErrOrderNotReserved, OrderStatusReserved},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := openSQLite(t)
+			ctx := context.Background()
+			repo := &ShopRepository{DB: database}
+
+			if _, err := database.Exec("INSERT INTO clients (id, phone) VALUES (1, '+99365123456')"); err != nil {
+				t.Fatal(err)
+			}
+			_, err := database.Exec("INSERT INTO lots (id, account_id, stock, starts_at, ends_at) VALUES (1, 1, 10, ?, ?)",
+				businessTime(1, 0, 0), businessTime(31, 0, 0))
+			if err != nil {
+				t.Fatal(err)
+			}
+			orderID, err := repo.InsertLotMessageAndUpdate(ctx, 1, "buy 2", businessTime(15, 12, 0), 1, LotOrder{Quantity: 2, ExpiresAt: expiresAt})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			order, err := repo.ConfirmOrder(ctx, orderID, tt.now)
+			if !errors.Is(err, tt.wantErr) || order == nil || order.ID != orderID {
+				t.Errorf("ConfirmOrder = %+v, %v; want order %d, %v", order, err, orderID, tt.wantErr)
+			}
+
+			var status string
+			if err := database.QueryRow("SELECT status FROM lot_orders WHERE id = ?", orderID).Scan(&status); err != nil {
+				t.Fatal(err)
+			}
+			if status != tt.want {
+				t.Errorf("status = %q; want %q", status, tt.want)
+			}
+		})
+	}
+}
+
+func TestSQLiteVoting(t *testing.T) {
+	database := openSQLite(t)
+	ctx := context.Background()
+	repo := &VotingRepository{DB: database}
+
+	_, err := database.Exec("INSERT INTO votings (id, account_id, status, starts_at, ends_at) VALUES (1, 2, 'daily', ?, ?)",
+		businessTime(1, 0, 0), businessTime(31, 23, 59))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.Exec("INSERT INTO voting_items (id, voting_id, title, vote_code) VALUES (1, 1, 'First', ' A1 '), (2, 1, 'Second', 'b2')"); err != nil {
+		t.Fatal(err)
+	}
+
+	voting, err := repo.GetVoting(ctx, "0456", businessTime(15, 12, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !voting.StartsAt.Equal(businessTime(1, 0, 0)) || len(voting.Items) != 2 {
+		t.Errorf("GetVoting = starts %v with %d items; want %v with 2", voting.StartsAt, len(voting.Items), businessTime(1, 0, 0))
+	}
+	// 20:00 UTC on the 31st is already the 1st of April in the business timezone
+	if _, err := repo.GetVoting(ctx, "0456", time.Date(2024, time.March, 31, 20, 0, 0, 0, time.UTC)); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetVoting after the end = %v; want sql.ErrNoRows", err)
+	}
+
+	codes := []struct {
+		voteCode string
+		wantID   int64
+	}{
+		{"a1", 1},
+		{"  A1", 1},
+		{"B2 ", 2},
+		{"c3", 0},
+	}
+	for _, tt := range codes {
+		id, _, err := repo.GetVotingItemDetails(ctx, 1, tt.voteCode)
+		if tt.wantID == 0 && err == nil || tt.wantID != 0 && id != tt.wantID {
+			t.Errorf("GetVotingItemDetails(%q) = %d, %v; want %d", tt.voteCode, id, err, tt.wantID)
+		}
+	}
+
+	if err := repo.InsertVotes(ctx, []Vote{
+		{VotingID: 1, VotingItemID: 1, Message: "A1", Date: businessTime(15, 23, 30), ClientID: 7},
+		{VotingID: 1, VotingItemID: 1, Message: "a1", Date: businessTime(15, 23, 40), ClientID: 8},
+		{VotingID: 1, VotingItemID: 2, Message: "b2", Date: businessTime(15, 23, 50), ClientID: 9},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The daily limit counts the calendar day in the business timezone
+	days := []struct {
+		date time.Time
+		want bool
+	}{
+		{businessTime(15, 0, 0), true},
+		{businessTime(15, 23, 59), true},
+		{businessTime(16, 0, 10), false},
+		{businessTime(14, 23, 59), false},
+	}
+	for _, tt := range days {
+		hasVoted, err := repo.HasClientVoted(ctx, 1, 7, "daily", tt.date)
+		if err != nil || hasVoted != tt.want {
+			t.Errorf("HasClientVoted on %v = %v, %v; want %v", tt.date, hasVoted, err, tt.want)
+		}
+	}
+
+	results, err := repo.GetVotingResults(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].VotesCount != 2 || results[1].VotesCount != 1 {
+		t.Errorf("GetVotingResults = %+v; want 2 and 1 votes", results)
+	}
+}
+
+func TestSQLiteClaimDueContents(t *testing.T) {
+	database := openSQLite(t)
+	ctx := context.Background()
+	repo := &SubscriptionRepository{DB: database}
+
+	if _, err := database.Exec("INSERT INTO subscription_topics (id, account_id, code, name) VALUES (1, 3, 'news', 'News')"); err != nil {
+		t.Fatal(err)
+	}
+	_, err := database.Exec("INSERT INTO subscription_contents (id, topic_id, text, send_at) VALUES (1, 1, 'morning', ?), (2, 1, 'evening', ?)",
+		businessTime(15, 9, 0), businessTime(15, 18, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		now     time.Time
+		sent    int64 // content marked as sent before claiming, if any
+		wantIDs []int64
+	}{
+		{businessTime(15, 8, 59), 0, nil},
+		{businessTime(15, 9, 0).UTC(), 0, []int64{1}},
+		{businessTime(15, 9, 5), 0, nil},         // leased
+		{businessTime(15, 9, 10), 0, []int64{1}}, // lease ran out before the content was sent
+		{businessTime(16, 0, 0), 1, []int64{2}},
+		{businessTime(16, 1, 0), 2, nil},
+	}
+
+	for _, tt := range tests {
+		if tt.sent != 0 {
+			if err := repo.MarkContentSent(ctx, tt.sent, tt.now); err != nil {
+				t.Fatal(err)
+			}
+		}
+		contents, err := repo.ClaimDueContents(ctx, tt.now, tt.now.Add(10*time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []int64
+		for _, content := range contents {
+			ids = append(ids, content.ID)
+			if content.ShortNumber != "0789" {
+				t.Errorf("content %d short number = %q; want %q", content.ID, content.ShortNumber, "0789")
+			}
+		}
+		if len(ids) != len(tt.wantIDs) || len(ids) > 0 && ids[0] != tt.wantIDs[0] {
+			t.Errorf("ClaimDueContents(%v) = %v; want %v", tt.now, ids, tt.wantIDs)
+		}
+	}
+}
+
+func TestSQLitePendingRecipients(t *testing.T) {
+	database := openSQLite(t)
+	ctx := context.Background()
+	repo := &SubscriptionRepository{DB: database}
+
+	_, err := database.Exec(`
+        INSERT INTO clients (id, phone, gateway_phone) VALUES (1, '+99365000001', '865000001'), (2, '+99365000002', NULL), (3, '+99365000003', NULL);
+        INSERT INTO subscriptions (topic_id, client_id, status) VALUES (1, 1, 'active'), (1, 2, 'active'), (1, 3, 'cancelled');
+    `)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recipients, err := repo.GetPendingRecipients(ctx, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recipients) != 2 || recipients[0] != (SubscriptionRecipient{1, "865000001"}) || recipients[1] != (SubscriptionRecipient{2, "+99365000002"}) {
+		t.Errorf("GetPendingRecipients = %+v; want the gateway phone of client 1 and the phone of client 2", recipients)
+	}
+
+	if err := repo.RecordDelivery(ctx, 1, 1, businessTime(15, 9, 0)); err != nil {
+		t.Fatal(err)
+	}
+	recipients, err = repo.GetPendingRecipients(ctx, 1, 1)
+	if err != nil || len(recipients) != 1 || recipients[0].ClientID != 2 {
+		t.Errorf("GetPendingRecipients after delivering to client 1 = %+v, %v; want client 2", recipients, err)
+	}
+	recipients, err = repo.GetPendingRecipients(ctx, 2, 1)
+	if err != nil || len(recipients) != 2 {
+		t.Errorf("GetPendingRecipients of another content = %+v, %v; want both clients", recipients, err)
+	}
+}
+
+func TestSQLiteSurveyAnswerCounts(t *testing.T) {
+	database := openSQLite(t)
+	ctx := context.Background()
+	repo := &SurveyRepository{DB: database}
+
+	// Client 1 let a session expire and retook the survey, client 2 is still
+	// answering and client 3 answered another survey
+	_, err := database.Exec(`
+        INSERT INTO survey_sessions (id, survey_id, client_id, current_position, status) VALUES
+            (1, 1, 1, 2, 'expired'), (2, 1, 1, 3, 'completed'), (3, 1, 2, 2, 'active'), (4, 2, 3, 3, 'completed');
+        INSERT INTO survey_answers (session_id, survey_id, question_id, client_id, answer) VALUES
+            (1, 1, 1, 1, 'Hawa'),
+            (2, 1, 1, 1, 'Yok'), (2, 1, 2, 1, '5'),
+            (3, 1, 1, 2, 'Hawa'),
+            (4, 2, 1, 3, 'Hawa');
+    `)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts, err := repo.GetAnswerCounts(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[SurveyAnswerCount]bool)
+	for _, count := range counts {
+		got[count] = true
+	}
+	want := []SurveyAnswerCount{
+		{QuestionID: 1, Answer: "Hawa", Count: 1},
+		{QuestionID: 1, Answer: "Yok", Count: 1},
+		{QuestionID: 2, Answer: "5", Count: 1},
+	}
+	if len(counts) != len(want) {
+		t.Fatalf("GetAnswerCounts = %+v; want %+v", counts, want)
+	}
+	for _, count := range want {
+		if !got[count] {
+			t.Errorf("GetAnswerCounts = %+v; want %+v", counts, want)
+		}
+	}
+}
+
+func TestSQLiteQuarantineReplay(t *testing.T) {
+	database := openSQLite(t)
+	ctx := context.Background()
+	repo := &QuarantineRepository{DB: database}
+
+	id, err := repo.InsertQuarantinedMessage(ctx, &QuarantinedMessage{Source: "865123456", Destination: "0123", Text: "1", QuarantinedAt: businessTime(15, 9, 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := repo.ClaimForReplay(ctx, id, businessTime(15, 10, 0)); err != nil {
+		t.Fatalf("ClaimForReplay: %v", err)
+	}
+	if _, err := repo.ClaimForReplay(ctx, id, businessTime(15, 10, 1)); !errors.Is(err, ErrAlreadyReplayed) {
+		t.Fatalf("second ClaimForReplay: %v; want ErrAlreadyReplayed", err)
+	}
+	if messages, err := repo.GetQuarantinedMessages(ctx, 10); err != nil || len(messages) != 0 {
+		t.Fatalf("GetQuarantinedMessages while claimed = %v, %v; want none", messages, err)
+	}
+
+	// A failed replay releases the message, which is listed and claimable again
+	if err := repo.ReleaseReplay(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if messages, err := repo.GetQuarantinedMessages(ctx, 10); err != nil || len(messages) != 1 || messages[0].ID != id {
+		t.Fatalf("GetQuarantinedMessages after release = %v, %v; want message %d", messages, err, id)
+	}
+	if _, err := repo.ClaimForReplay(ctx, id, businessTime(15, 11, 0)); err != nil {
+		t.Fatalf("ClaimForReplay after release: %v", err)
+	}
+}
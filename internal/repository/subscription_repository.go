@@ -0,0 +1,237 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Subscription statuses, stored in subscriptions.status.
+const (
+	SubscriptionStatusActive    = "active"
+	SubscriptionStatusCancelled = "cancelled"
+)
+
+type SubscriptionTopic struct {
+	ID   int64
+	Code string
+	Name string
+}
+
+type SubscriptionContent struct {
+	ID          int64
+	TopicID     int64
+	ShortNumber string
+	Text        string
+}
+
+// SubscriptionRecipient is a subscriber scheduled content is sent to.
+type SubscriptionRecipient struct {
+	ClientID int64
+	Phone    string
+}
+
+type SubscriptionRepository struct {
+	DB *sql.DB
+}
+
+func (sr *SubscriptionRepository) GetTopicsByShortNumber(ctx context.Context, shortNumber string) ([]SubscriptionTopic, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := sr.DB.QueryContext(ctx, rewrite(`
+        SELECT t.id, t.code, t.name
+        FROM subscription_topics t
+        JOIN accounts a ON t.account_id = a.id
+        WHERE a.short_number = ?
+        ORDER BY t.id
+    `), shortNumber)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var topics []SubscriptionTopic
+	for rows.Next() {
+		var topic SubscriptionTopic
+		if err := rows.Scan(&topic.ID, &topic.Code, &topic.Name); err != nil {
+			return nil, err
+		}
+		topics = append(topics, topic)
+	}
+	return topics, rows.Err()
+}
+
+// Subscribe activates the client's subscription to the topic. It returns false
+// when the client was already subscribed.
+func (sr *SubscriptionRepository) Subscribe(ctx context.Context, topicID, clientID int64, dt time.Time) (bool, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := sr.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+
+	var id int64
+	var status string
+	err = tx.QueryRowContext(ctx,
+		rewrite("SELECT id, status FROM subscriptions WHERE topic_id = ? AND client_id = ? FOR UPDATE"),
+		topicID, clientID,
+	).Scan(&id, &status)
+	switch {
+	case err == sql.ErrNoRows:
+		_, err = tx.ExecContext(ctx,
+			rewrite("INSERT INTO subscriptions (topic_id, client_id, status, subscribed_at) VALUES (?, ?, ?, ?)"),
+			topicID, clientID, SubscriptionStatusActive, dt,
+		)
+	case err != nil:
+	case status == SubscriptionStatusActive:
+		return false, tx.Commit()
+	default:
+		_, err = tx.ExecContext(ctx,
+			rewrite("UPDATE subscriptions SET status = ?, subscribed_at = ?, unsubscribed_at = NULL WHERE id = ?"),
+			SubscriptionStatusActive, dt, id,
+		)
+	}
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// Unsubscribe cancels the client's active subscriptions to the given topics
+// and returns how many were cancelled.
+func (sr *SubscriptionRepository) Unsubscribe(ctx context.Context, topicIDs []int64, clientID int64, dt time.Time) (int64, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var cancelled int64
+	for _, topicID := range topicIDs {
+		result, err := sr.DB.ExecContext(ctx,
+			rewrite("UPDATE subscriptions SET status = ?, unsubscribed_at = ? WHERE topic_id = ? AND client_id = ? AND status = ?"),
+			SubscriptionStatusCancelled, dt, topicID, clientID, SubscriptionStatusActive,
+		)
+		if err != nil {
+			return cancelled, err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return cancelled, err
+		}
+		cancelled += affected
+	}
+	return cancelled, nil
+}
+
+// ClaimDueContents leases scheduled contents whose send time has come until
+// leaseUntil and returns them. Claiming and reading happen in one transaction
+// so a content is delivered by one process at a time even if several run the
+// scheduler. Contents that are not marked as sent before the lease runs out
+// are claimed again, e.g. after a crash or failed sends.
+func (sr *SubscriptionRepository) ClaimDueContents(ctx context.Context, currentDateTime, leaseUntil time.Time) ([]SubscriptionContent, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := sr.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx, rewrite(`
+        SELECT c.id, c.topic_id, a.short_number, c.text
+        FROM subscription_contents c
+        JOIN subscription_topics t ON c.topic_id = t.id
+        JOIN accounts a ON t.account_id = a.id
+        WHERE c.send_at <= ? AND c.sent_at IS NULL AND (c.claimed_until IS NULL OR c.claimed_until <= ?)
+        ORDER BY c.send_at
+        FOR UPDATE SKIP LOCKED
+    `), currentDateTime, currentDateTime)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	var contents []SubscriptionContent
+	for rows.Next() {
+		var content SubscriptionContent
+		if err := rows.Scan(&content.ID, &content.TopicID, &content.ShortNumber, &content.Text); err != nil {
+			rows.Close()
+			tx.Rollback()
+			return nil, err
+		}
+		contents = append(contents, content)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	for _, content := range contents {
+		if _, err := tx.ExecContext(ctx, rewrite("UPDATE subscription_contents SET claimed_until = ? WHERE id = ?"), leaseUntil, content.ID); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	return contents, tx.Commit()
+}
+
+// MarkContentSent records that the content reached all of its subscribers.
+func (sr *SubscriptionRepository) MarkContentSent(ctx context.Context, contentID int64, dt time.Time) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	_, err := sr.DB.ExecContext(ctx,
+		rewrite("UPDATE subscription_contents SET sent_at = ?, claimed_until = NULL WHERE id = ?"),
+		dt, contentID,
+	)
+	return err
+}
+
+// GetPendingRecipients returns the topic's active subscribers the content has
+// not been delivered to yet, with their phones in the form the SMS gateway
+// delivers them.
+func (sr *SubscriptionRepository) GetPendingRecipients(ctx context.Context, contentID, topicID int64) ([]SubscriptionRecipient, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := sr.DB.QueryContext(ctx, rewrite(`
+        SELECT c.id, COALESCE(c.gateway_phone, c.phone)
+        FROM subscriptions s
+        JOIN clients c ON s.client_id = c.id
+        LEFT JOIN subscription_deliveries d ON d.content_id = ? AND d.client_id = c.id
+        WHERE s.topic_id = ? AND s.status = ? AND d.client_id IS NULL
+        ORDER BY c.id
+    `), contentID, topicID, SubscriptionStatusActive)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var recipients []SubscriptionRecipient
+	for rows.Next() {
+		var recipient SubscriptionRecipient
+		if err := rows.Scan(&recipient.ClientID, &recipient.Phone); err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, recipient)
+	}
+	return recipients, rows.Err()
+}
+
+// RecordDelivery records that the content was sent to the client, so a later
+// claim of the content skips them.
+func (sr *SubscriptionRepository) RecordDelivery(ctx context.Context, contentID, clientID int64, dt time.Time) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	_, err := sr.DB.ExecContext(ctx,
+		rewrite("INSERT INTO subscription_deliveries (content_id, client_id, delivered_at) VALUES (?, ?, ?)"),
+		contentID, clientID, dt,
+	)
+	return err
+}
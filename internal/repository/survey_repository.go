@@ -0,0 +1,266 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Survey session statuses, stored in survey_sessions.status.
+const (
+	SessionStatusActive    = "active"
+	SessionStatusCompleted = "completed"
+	SessionStatusExpired   = "expired"
+)
+
+// Survey answer types, stored in survey_questions.answer_type.
+const (
+	AnswerTypeText   = "text"
+	AnswerTypeNumber = "number"
+	AnswerTypeChoice = "choice"
+)
+
+type Survey struct {
+	ID                int64
+	CompletionMessage string
+	SessionTimeout    time.Duration // 0 when sessions never time out
+	AllowRetakes      bool          // whether a client may take the survey again after completing it
+}
+
+type SurveyQuestion struct {
+	ID         int64
+	Position   int
+	Text       string
+	AnswerType string
+	Choices    string // comma separated, for choice questions
+	MinValue   sql.NullInt64
+	MaxValue   sql.NullInt64
+}
+
+type SurveySession struct {
+	ID              int64
+	CurrentPosition int
+	UpdatedAt       time.Time
+}
+
+type SurveyAnswerCount struct {
+	QuestionID int64
+	Answer     string
+	Count      int64
+}
+
+type SurveyRepository struct {
+	DB      *sql.DB
+	Replica *sql.DB // optional, serves lookups
+}
+
+func (sr *SurveyRepository) GetSurveyByShortNumber(ctx context.Context, shortNumber string, currentDateTime time.Time) (*Survey, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	query := `
+        SELECT s.id, COALESCE(s.completion_message, ''), COALESCE(s.session_timeout_seconds, 0), COALESCE(s.allow_retakes, FALSE)
+        FROM surveys s
+        JOIN accounts a ON s.account_id = a.id
+        WHERE a.short_number = ? AND s.starts_at <= ? AND s.ends_at >= ?
+    `
+	var survey Survey
+	var timeoutSeconds int64
+	err := lookupDB(sr.DB, sr.Replica).QueryRowContext(ctx, rewrite(query), shortNumber, currentDateTime, currentDateTime).Scan(&survey.ID, &survey.CompletionMessage, &timeoutSeconds, &survey.AllowRetakes)
+	if err != nil {
+		return nil, err
+	}
+	survey.SessionTimeout = time.Duration(timeoutSeconds) * time.Second
+	return &survey, nil
+}
+
+// GetQuestion returns the question at position, or nil when the survey has no
+// more questions.
+func (sr *SurveyRepository) GetQuestion(ctx context.Context, surveyID int64, position int) (*SurveyQuestion, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var question SurveyQuestion
+	err := lookupDB(sr.DB, sr.Replica).QueryRowContext(ctx,
+		rewrite("SELECT id, position, text, answer_type, COALESCE(choices, ''), min_value, max_value FROM survey_questions WHERE survey_id = ? AND position = ?"),
+		surveyID, position,
+	).Scan(&question.ID, &question.Position, &question.Text, &question.AnswerType, &question.Choices, &question.MinValue, &question.MaxValue)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &question, nil
+}
+
+func (sr *SurveyRepository) GetQuestions(ctx context.Context, surveyID int64) ([]SurveyQuestion, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := lookupDB(sr.DB, sr.Replica).QueryContext(ctx,
+		rewrite("SELECT id, position, text, answer_type, COALESCE(choices, ''), min_value, max_value FROM survey_questions WHERE survey_id = ? ORDER BY position"),
+		surveyID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var questions []SurveyQuestion
+	for rows.Next() {
+		var question SurveyQuestion
+		if err := rows.Scan(&question.ID, &question.Position, &question.Text, &question.AnswerType, &question.Choices, &question.MinValue, &question.MaxValue); err != nil {
+			return nil, err
+		}
+		questions = append(questions, question)
+	}
+	return questions, rows.Err()
+}
+
+// GetActiveSession returns the client's active session, or nil when there is none.
+func (sr *SurveyRepository) GetActiveSession(ctx context.Context, surveyID, clientID int64) (*SurveySession, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var session SurveySession
+	err := sr.DB.QueryRowContext(ctx,
+		rewrite("SELECT id, current_position, updated_at FROM survey_sessions WHERE survey_id = ? AND client_id = ? AND status = ? ORDER BY id DESC LIMIT 1"),
+		surveyID, clientID, SessionStatusActive,
+	).Scan(&session.ID, &session.CurrentPosition, &session.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// HasCompletedSession reports whether the client has completed the survey.
+func (sr *SurveyRepository) HasCompletedSession(ctx context.Context, surveyID, clientID int64) (bool, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var count int
+	err := sr.DB.QueryRowContext(ctx,
+		rewrite("SELECT COUNT(*) FROM survey_sessions WHERE survey_id = ? AND client_id = ? AND status = ?"),
+		surveyID, clientID, SessionStatusCompleted,
+	).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (sr *SurveyRepository) StartSession(ctx context.Context, surveyID, clientID int64, dt time.Time) (*SurveySession, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	id, err := insertID(ctx, sr.DB,
+		"INSERT INTO survey_sessions (survey_id, client_id, current_position, status, started_at, updated_at) VALUES (?, ?, 1, ?, ?, ?)",
+		surveyID, clientID, SessionStatusActive, dt, dt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &SurveySession{ID: id, CurrentPosition: 1, UpdatedAt: dt}, nil
+}
+
+func (sr *SurveyRepository) ExpireSession(ctx context.Context, sessionID int64) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	_, err := sr.DB.ExecContext(ctx, rewrite("UPDATE survey_sessions SET status = ? WHERE id = ?"), SessionStatusExpired, sessionID)
+	return err
+}
+
+// SaveAnswer stores the answer and advances the session in one transaction.
+// It returns false without saving if the session has already moved past the
+// question, e.g. because of a concurrent message from the same client.
+func (sr *SurveyRepository) SaveAnswer(ctx context.Context, surveyID int64, session *SurveySession, question *SurveyQuestion, clientID int64, answer string, dt time.Time, completed bool) (bool, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := sr.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+
+	status := SessionStatusActive
+	if completed {
+		status = SessionStatusCompleted
+	}
+
+	result, err := tx.ExecContext(ctx,
+		rewrite("UPDATE survey_sessions SET current_position = current_position + 1, status = ?, updated_at = ? WHERE id = ? AND current_position = ? AND status = ?"),
+		status, dt, session.ID, session.CurrentPosition, SessionStatusActive,
+	)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		tx.Rollback()
+		return false, err
+	} else if affected == 0 {
+		tx.Rollback()
+		return false, nil
+	}
+
+	_, err = tx.ExecContext(ctx,
+		rewrite("INSERT INTO survey_answers (session_id, survey_id, question_id, client_id, answer, dt) VALUES (?, ?, ?, ?, ?, ?)"),
+		session.ID, surveyID, question.ID, clientID, answer, dt,
+	)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// GetAnswerCounts counts the answers of completed and active sessions. The
+// answers of expired sessions are left out, since the client may have retaken
+// the survey and answered again.
+func (sr *SurveyRepository) GetAnswerCounts(ctx context.Context, surveyID int64) ([]SurveyAnswerCount, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := sr.DB.QueryContext(ctx, rewrite(`
+        SELECT a.question_id, a.answer, COUNT(*)
+        FROM survey_answers a
+        JOIN survey_sessions s ON a.session_id = s.id
+        WHERE a.survey_id = ? AND s.status <> ?
+        GROUP BY a.question_id, a.answer
+    `), surveyID, SessionStatusExpired)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []SurveyAnswerCount
+	for rows.Next() {
+		var count SurveyAnswerCount
+		if err := rows.Scan(&count.QuestionID, &count.Answer, &count.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+	return counts, rows.Err()
+}
+
+func (sr *SurveyRepository) GetCompletedSessionCount(ctx context.Context, surveyID int64) (int64, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var count int64
+	err := sr.DB.QueryRowContext(ctx,
+		rewrite("SELECT COUNT(*) FROM survey_sessions WHERE survey_id = ? AND status = ?"),
+		surveyID, SessionStatusCompleted,
+	).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
@@ -1,16 +1,23 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"sort"
+	"strings"
 	"time"
 )
 
 type VotingRepository struct {
-	DB *sql.DB
+	DB      *sql.DB
+	Replica *sql.DB // optional, serves lookups
 }
 
-func (vr *VotingRepository) GetVotingDetails(shortNumber string, currentDateTime time.Time) (int64, string, error) {
+func (vr *VotingRepository) GetVotingDetails(ctx context.Context, shortNumber string, currentDateTime time.Time) (int64, string, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
 	var votingID int64
 	var status string
 	query := `
@@ -19,25 +26,151 @@ func (vr *VotingRepository) GetVotingDetails(shortNumber string, currentDateTime
         JOIN accounts a ON v.account_id = a.id
         WHERE a.short_number = ? AND v.starts_at <= ? AND v.ends_at >= ?
     `
-	err := vr.DB.QueryRow(query, shortNumber, currentDateTime, currentDateTime).Scan(&votingID, &status)
+	err := lookupDB(vr.DB, vr.Replica).QueryRowContext(ctx, rewrite(query), shortNumber, currentDateTime, currentDateTime).Scan(&votingID, &status)
 	if err != nil {
 		return 0, "", err
 	}
 	return votingID, status, nil
 }
 
-func (vr *VotingRepository) GetVotingItemDetails(votingID int64, voteCode string) (int64, string, error) {
+// Voting is a voting with its items, as held by the campaign cache.
+type Voting struct {
+	ID          int64
+	ShortNumber string
+	Status      string
+	StartsAt    time.Time
+	EndsAt      time.Time
+	Items       []VotingItem
+}
+
+type VotingItem struct {
+	ID       int64
+	Title    string
+	VoteCode string
+}
+
+// FindItem matches voteCode the way GetVotingItemDetails does, ignoring case
+// and surrounding whitespace.
+func (v *Voting) FindItem(voteCode string) (*VotingItem, bool) {
+	voteCode = strings.TrimSpace(voteCode)
+	for i := range v.Items {
+		if strings.EqualFold(strings.TrimSpace(v.Items[i].VoteCode), voteCode) {
+			return &v.Items[i], true
+		}
+	}
+	return nil, false
+}
+
+// GetVoting returns the voting active on shortNumber at currentDateTime with its items.
+func (vr *VotingRepository) GetVoting(ctx context.Context, shortNumber string, currentDateTime time.Time) (*Voting, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	voting := Voting{ShortNumber: shortNumber}
+	err := lookupDB(vr.DB, vr.Replica).QueryRowContext(ctx, rewrite(`
+        SELECT v.id, v.status, v.starts_at, v.ends_at
+        FROM votings v
+        JOIN accounts a ON v.account_id = a.id
+        WHERE a.short_number = ? AND v.starts_at <= ? AND v.ends_at >= ?
+    `), shortNumber, currentDateTime, currentDateTime).Scan(&voting.ID, &voting.Status, &voting.StartsAt, &voting.EndsAt)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := lookupDB(vr.DB, vr.Replica).QueryContext(ctx, rewrite("SELECT id, title, vote_code FROM voting_items WHERE voting_id = ? ORDER BY id"), voting.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item VotingItem
+		if err := rows.Scan(&item.ID, &item.Title, &item.VoteCode); err != nil {
+			return nil, err
+		}
+		voting.Items = append(voting.Items, item)
+	}
+	return &voting, rows.Err()
+}
+
+// GetVotingsEndingAfter returns all votings, with their items, that end at or
+// after from.
+func (vr *VotingRepository) GetVotingsEndingAfter(ctx context.Context, from time.Time) ([]Voting, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := lookupDB(vr.DB, vr.Replica).QueryContext(ctx, rewrite(`
+        SELECT v.id, a.short_number, v.status, v.starts_at, v.ends_at
+        FROM votings v
+        JOIN accounts a ON v.account_id = a.id
+        WHERE v.ends_at >= ?
+        ORDER BY v.id
+    `), from)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var votings []Voting
+	index := make(map[int64]int)
+	for rows.Next() {
+		var voting Voting
+		if err := rows.Scan(&voting.ID, &voting.ShortNumber, &voting.Status, &voting.StartsAt, &voting.EndsAt); err != nil {
+			return nil, err
+		}
+		index[voting.ID] = len(votings)
+		votings = append(votings, voting)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	itemRows, err := lookupDB(vr.DB, vr.Replica).QueryContext(ctx, rewrite(`
+        SELECT i.id, i.voting_id, i.title, i.vote_code
+        FROM voting_items i
+        JOIN votings v ON i.voting_id = v.id
+        WHERE v.ends_at >= ?
+        ORDER BY i.id
+    `), from)
+	if err != nil {
+		return nil, err
+	}
+	defer itemRows.Close()
+
+	for itemRows.Next() {
+		var item VotingItem
+		var votingID int64
+		if err := itemRows.Scan(&item.ID, &votingID, &item.Title, &item.VoteCode); err != nil {
+			return nil, err
+		}
+		// Votings created between the two queries are picked up on the next refresh
+		if i, ok := index[votingID]; ok {
+			votings[i].Items = append(votings[i].Items, item)
+		}
+	}
+	return votings, itemRows.Err()
+}
+
+func (vr *VotingRepository) GetVotingItemDetails(ctx context.Context, votingID int64, voteCode string) (int64, string, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
 	var votingItemID int64
 	var title string
 	query := `SELECT id, title FROM voting_items WHERE voting_id = ? AND LOWER(TRIM(vote_code)) = LOWER(TRIM(?))`
-	err := vr.DB.QueryRow(query, votingID, voteCode).Scan(&votingItemID, &title)
+	err := lookupDB(vr.DB, vr.Replica).QueryRowContext(ctx, rewrite(query), votingID, voteCode).Scan(&votingItemID, &title)
 	if err != nil {
 		return 0, "", errors.New("voting item not found for vote code")
 	}
 	return votingItemID, title, nil
 }
 
-func (vr *VotingRepository) HasClientVoted(votingID, clientID int64, status string, currentDateTime time.Time) (bool, error) {
+// HasClientVoted applies the voting's limit. The daily window is the calendar
+// day of currentDateTime in its location, the configured business timezone.
+func (vr *VotingRepository) HasClientVoted(ctx context.Context, votingID, clientID int64, status string, currentDateTime time.Time) (bool, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
 	var count int
 	var err error
 
@@ -45,13 +178,13 @@ func (vr *VotingRepository) HasClientVoted(votingID, clientID int64, status stri
 	case "daily":
 		startOfDay := time.Date(currentDateTime.Year(), currentDateTime.Month(), currentDateTime.Day(), 0, 0, 0, 0, currentDateTime.Location())
 		endOfDay := startOfDay.Add(24 * time.Hour)
-		err = vr.DB.QueryRow(
-			"SELECT COUNT(*) FROM voting_sms_messages WHERE voting_id = ? AND client_id = ? AND dt >= ? AND dt < ?",
+		err = consistentDB(vr.DB, vr.Replica).QueryRowContext(ctx,
+			rewrite("SELECT COUNT(*) FROM voting_sms_messages WHERE voting_id = ? AND client_id = ? AND dt >= ? AND dt < ?"),
 			votingID, clientID, startOfDay, endOfDay,
 		).Scan(&count)
 	case "one":
-		err = vr.DB.QueryRow(
-			"SELECT COUNT(*) FROM voting_sms_messages WHERE voting_id = ? AND client_id = ?",
+		err = consistentDB(vr.DB, vr.Replica).QueryRowContext(ctx,
+			rewrite("SELECT COUNT(*) FROM voting_sms_messages WHERE voting_id = ? AND client_id = ?"),
 			votingID, clientID,
 		).Scan(&count)
 	case "unlimited":
@@ -65,14 +198,17 @@ func (vr *VotingRepository) HasClientVoted(votingID, clientID int64, status stri
 	return count > 0, nil
 }
 
-func (vr *VotingRepository) InsertVotingMessageAndUpdateCount(votingID, votingItemID int64, msg string, dt time.Time, clientID int64) error {
-	tx, err := vr.DB.Begin()
+func (vr *VotingRepository) InsertVotingMessageAndUpdateCount(ctx context.Context, votingID, votingItemID int64, msg string, dt time.Time, clientID int64) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := vr.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 
-	_, err = tx.Exec(
-		"INSERT INTO voting_sms_messages (voting_id, voting_item_id, msg, dt, client_id) VALUES (?, ?, ?, ?, ?)",
+	_, err = tx.ExecContext(ctx,
+		rewrite("INSERT INTO voting_sms_messages (voting_id, voting_item_id, msg, dt, client_id) VALUES (?, ?, ?, ?, ?)"),
 		votingID, votingItemID, msg, dt, clientID,
 	)
 	if err != nil {
@@ -80,8 +216,8 @@ func (vr *VotingRepository) InsertVotingMessageAndUpdateCount(votingID, votingIt
 		return err
 	}
 
-	_, err = tx.Exec(
-		"UPDATE voting_items SET votes_count = votes_count + 1 WHERE id = ?",
+	_, err = tx.ExecContext(ctx,
+		rewrite("UPDATE voting_items SET votes_count = votes_count + 1 WHERE id = ?"),
 		votingItemID,
 	)
 	if err != nil {
@@ -91,3 +227,160 @@ func (vr *VotingRepository) InsertVotingMessageAndUpdateCount(votingID, votingIt
 
 	return tx.Commit()
 }
+
+// Vote is an accepted vote waiting to be written by InsertVotes.
+type Vote struct {
+	VotingID     int64
+	VotingItemID int64
+	Message      string
+	Date         time.Time
+	ClientID     int64
+}
+
+// InsertVotes writes votes with one multi-row insert and adds the number of
+// votes per item to votes_count, all in one transaction. Items are updated in
+// ID order so that concurrent batches lock rows in the same order.
+func (vr *VotingRepository) InsertVotes(ctx context.Context, votes []Vote) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	if len(votes) == 0 {
+		return nil
+	}
+
+	args := make([]any, 0, len(votes)*5)
+	counts := make(map[int64]int64)
+	for _, vote := range votes {
+		args = append(args, vote.VotingID, vote.VotingItemID, vote.Message, vote.Date, vote.ClientID)
+		counts[vote.VotingItemID]++
+	}
+	itemIDs := make([]int64, 0, len(counts))
+	for itemID := range counts {
+		itemIDs = append(itemIDs, itemID)
+	}
+	sort.Slice(itemIDs, func(i, j int) bool { return itemIDs[i] < itemIDs[j] })
+
+	tx, err := vr.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	values := strings.TrimSuffix(strings.Repeat("(?, ?, ?, ?, ?), ", len(votes)), ", ")
+	if _, err := tx.ExecContext(ctx, rewrite("INSERT INTO voting_sms_messages (voting_id, voting_item_id, msg, dt, client_id) VALUES "+values), args...); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for _, itemID := range itemIDs {
+		if _, err := tx.ExecContext(ctx, rewrite("UPDATE voting_items SET votes_count = votes_count + ? WHERE id = ?"), counts[itemID], itemID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+type VotingItemResult struct {
+	ID         int64
+	Title      string
+	VoteCode   string
+	VotesCount int64
+}
+
+func (vr *VotingRepository) GetVotingResults(ctx context.Context, votingID int64) ([]VotingItemResult, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := lookupDB(vr.DB, vr.Replica).QueryContext(ctx,
+		rewrite("SELECT id, title, vote_code, votes_count FROM voting_items WHERE voting_id = ? ORDER BY id"),
+		votingID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []VotingItemResult
+	for rows.Next() {
+		var item VotingItemResult
+		if err := rows.Scan(&item.ID, &item.Title, &item.VoteCode, &item.VotesCount); err != nil {
+			return nil, err
+		}
+		results = append(results, item)
+	}
+	return results, rows.Err()
+}
+
+// ChangeClientVote records the client's vote for votingItemID, replacing the
+// client's earlier vote in the same voting if there is one. Counts of both the
+// old and the new item are adjusted in the same transaction. It returns the ID
+// of the previously voted item, or 0 when this is the client's first vote.
+func (vr *VotingRepository) ChangeClientVote(ctx context.Context, votingID, votingItemID int64, msg string, dt time.Time, clientID int64) (int64, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := vr.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	var messageID, previousItemID int64
+	err = tx.QueryRowContext(ctx,
+		rewrite("SELECT id, voting_item_id FROM voting_sms_messages WHERE voting_id = ? AND client_id = ? ORDER BY dt DESC, id DESC LIMIT 1 FOR UPDATE"),
+		votingID, clientID,
+	).Scan(&messageID, &previousItemID)
+	if err != nil && err != sql.ErrNoRows {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if previousItemID == votingItemID {
+		return previousItemID, tx.Commit()
+	}
+
+	if previousItemID == 0 {
+		_, err = tx.ExecContext(ctx,
+			rewrite("INSERT INTO voting_sms_messages (voting_id, voting_item_id, msg, dt, client_id) VALUES (?, ?, ?, ?, ?)"),
+			votingID, votingItemID, msg, dt, clientID,
+		)
+	} else {
+		_, err = tx.ExecContext(ctx,
+			rewrite("UPDATE voting_sms_messages SET voting_item_id = ?, msg = ?, dt = ? WHERE id = ?"),
+			votingItemID, msg, dt, messageID,
+		)
+		if err == nil {
+			_, err = tx.ExecContext(ctx,
+				rewrite("UPDATE voting_items SET votes_count = votes_count - 1 WHERE id = ? AND votes_count > 0"),
+				previousItemID,
+			)
+		}
+	}
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		rewrite("UPDATE voting_items SET votes_count = votes_count + 1 WHERE id = ?"),
+		votingItemID,
+	)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	return previousItemID, tx.Commit()
+}
+
+func (vr *VotingRepository) GetVotingItemTitle(ctx context.Context, votingItemID int64) (string, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var title string
+	err := lookupDB(vr.DB, vr.Replica).QueryRowContext(ctx, rewrite("SELECT title FROM voting_items WHERE id = ?"), votingItemID).Scan(&title)
+	if err != nil {
+		return "", err
+	}
+	return title, nil
+}
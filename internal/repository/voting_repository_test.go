@@ -0,0 +1,45 @@
+package repository
+
+import "testing"
+
+func TestVotingFindItem(t *testing.T) {
+	voting := &Voting{
+		Items: []VotingItem{
+			{ID: 1, Title: "First", VoteCode: "A1"},
+			{ID: 2, Title: "Second", VoteCode: " b2 "},
+			{ID: 3, Title: "Third", VoteCode: "Üç"},
+		},
+	}
+
+	tests := []struct {
+		voteCode string
+		wantID   int64
+		wantOK   bool
+	}{
+		{"A1", 1, true},
+		{"a1", 1, true},
+		{"  a1\n", 1, true},
+		{"B2", 2, true},
+		{"b2", 2, true},
+		{"üÇ", 3, true},
+		{"A", 0, false},
+		{"A1 B2", 0, false},
+		{"", 0, false},
+	}
+
+	for _, tt := range tests {
+		item, ok := voting.FindItem(tt.voteCode)
+		if ok != tt.wantOK {
+			t.Errorf("FindItem(%q) found = %v; want %v", tt.voteCode, ok, tt.wantOK)
+			continue
+		}
+		if ok && item.ID != tt.wantID {
+			t.Errorf("FindItem(%q) = item %d; want %d", tt.voteCode, item.ID, tt.wantID)
+		}
+	}
+
+	item, _ := voting.FindItem("a1")
+	if item != &voting.Items[0] {
+		t.Errorf("FindItem returned a copy; want a pointer into Items")
+	}
+}
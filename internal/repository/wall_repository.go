@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// SMS wall moderation statuses, stored in wall_messages.status.
+const (
+	WallStatusPending  = "pending"
+	WallStatusApproved = "approved"
+	WallStatusRejected = "rejected"
+)
+
+var ErrAlreadyModerated = errors.New("wall message has already been moderated")
+
+type WallMessage struct {
+	ID          int64
+	ShortNumber string
+	ClientID    int64
+	Phone       string
+	Message     string
+	Date        time.Time
+	Status      string
+	Reason      string
+}
+
+type WallRepository struct {
+	DB *sql.DB
+}
+
+func (wr *WallRepository) InsertWallMessage(ctx context.Context, shortNumber, msg string, dt time.Time, clientID int64, status, reason string) (int64, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	return insertID(ctx, wr.DB,
+		"INSERT INTO wall_messages (short_number, msg, dt, client_id, status, reason) VALUES (?, ?, ?, ?, ?, ?)",
+		shortNumber, msg, dt, clientID, status, reason,
+	)
+}
+
+func (wr *WallRepository) GetWallMessages(ctx context.Context, shortNumber, status string, limit int) ([]WallMessage, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := wr.DB.QueryContext(ctx, rewrite(`
+        SELECT w.id, w.short_number, w.client_id, c.phone, w.msg, w.dt, w.status, COALESCE(w.reason, '')
+        FROM wall_messages w
+        JOIN clients c ON w.client_id = c.id
+        WHERE w.short_number = ? AND w.status = ?
+        ORDER BY w.id
+        LIMIT ?
+    `), shortNumber, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []WallMessage
+	for rows.Next() {
+		var message WallMessage
+		if err := rows.Scan(&message.ID, &message.ShortNumber, &message.ClientID, &message.Phone, &message.Message, &message.Date, &message.Status, &message.Reason); err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+	return messages, rows.Err()
+}
+
+// Moderate moves a pending message to status and returns it. Messages that
+// were already moderated are left untouched and ErrAlreadyModerated is returned.
+func (wr *WallRepository) Moderate(ctx context.Context, id int64, status, reason string, moderatedAt time.Time) (*WallMessage, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	result, err := wr.DB.ExecContext(ctx,
+		rewrite("UPDATE wall_messages SET status = ?, reason = ?, moderated_at = ? WHERE id = ? AND status = ?"),
+		status, reason, moderatedAt, id, WallStatusPending,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var message WallMessage
+	err = wr.DB.QueryRowContext(ctx, rewrite(`
+        SELECT w.id, w.short_number, w.client_id, c.phone, w.msg, w.dt, w.status, COALESCE(w.reason, '')
+        FROM wall_messages w
+        JOIN clients c ON w.client_id = c.id
+        WHERE w.id = ?
+    `), id).Scan(&message.ID, &message.ShortNumber, &message.ClientID, &message.Phone, &message.Message, &message.Date, &message.Status, &message.Reason)
+	if err != nil {
+		return nil, err
+	}
+
+	if affected, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if affected == 0 {
+		return &message, ErrAlreadyModerated
+	}
+	return &message, nil
+}
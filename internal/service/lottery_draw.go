@@ -0,0 +1,224 @@
+package service
+
+import (
+	websocket "answers-processor/internal/delivery"
+	"answers-processor/internal/domain"
+	"answers-processor/internal/repository"
+	"answers-processor/internal/strategies"
+	"answers-processor/pkg/logger"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+const lotteryWinnerType = "lottery_winner"
+
+// LotteryDraws runs auditable lottery draws. A draw is committed once the
+// lottery has ended: the entry set and the excluded lotteries are frozen and
+// the SHA-256 hash of a random seed is published. The seed is handed to the
+// operator and not stored; when the draw is performed the operator reveals it
+// and winners are selected deterministically from it, so anyone can recompute
+// the result with SelectWinners.
+type LotteryDraws struct {
+	repo        *repository.LotteryRepository
+	broadcaster websocket.Broadcaster
+	LogInstance *logger.Loggers
+}
+
+var (
+	ErrLotteryNotEnded = errors.New("lottery has not ended yet")
+	ErrSeedMismatch    = errors.New("seed does not match the committed seed hash")
+	ErrEntriesChanged  = errors.New("lottery entries changed since the draw was committed")
+)
+
+type DrawResult struct {
+	Draw    *repository.LotteryDraw
+	Entries int
+	Winners []repository.LotteryWinner
+}
+
+func NewLotteryDraws(repo *repository.LotteryRepository, broadcaster websocket.Broadcaster, logInstance *logger.Loggers) *LotteryDraws {
+	return &LotteryDraws{
+		repo:        repo,
+		broadcaster: broadcaster,
+		LogInstance: logInstance,
+	}
+}
+
+// Commit creates the draw of an ended lottery and returns it with the seed
+// hash to publish and the seed for the operator to keep. The seed must not be
+// disclosed before Draw and cannot be recovered from the service. Winners of
+// the excluded lotteries' draws performed before the commit cannot win.
+func (ld *LotteryDraws) Commit(ctx context.Context, lotteryID int64, excludedLotteryIDs []int64) (*repository.LotteryDraw, error) {
+	endTime, err := ld.repo.GetLotteryEndTime(ctx, lotteryID)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find lottery: %w", err)
+	}
+	if strategies.CurrentDateTime().Before(endTime) {
+		return nil, ErrLotteryNotEnded
+	}
+
+	entries, err := ld.repo.GetLotteryEntries(ctx, lotteryID, math.MaxInt64)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get lottery entries: %w", err)
+	}
+
+	seedBytes := make([]byte, 32)
+	if _, err := rand.Read(seedBytes); err != nil {
+		return nil, fmt.Errorf("Failed to generate seed: %w", err)
+	}
+	seed := hex.EncodeToString(seedBytes)
+
+	draw := &repository.LotteryDraw{
+		LotteryID:          lotteryID,
+		SeedHash:           hashHex(seed),
+		EntriesDigest:      EntriesDigest(entries),
+		ExcludedLotteryIDs: excludedLotteryIDs,
+		CommittedAt:        time.Now(),
+	}
+	if len(entries) > 0 {
+		draw.LastEntryID = entries[len(entries)-1].ID
+	}
+	draw.ID, err = ld.repo.CreateDraw(ctx, draw)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create draw: %w", err)
+	}
+	draw.Seed = seed
+
+	ld.LogInstance.InfoLogger.Info("Lottery draw committed", "lottery_id", lotteryID, "draw_id", draw.ID, "seed_hash", draw.SeedHash, "entries", len(entries), "entries_digest", draw.EntriesDigest)
+	return draw, nil
+}
+
+// Draw checks the revealed seed against the commitment, selects count winners
+// from the entries frozen at commit time, stores them and broadcasts each
+// winner.
+func (ld *LotteryDraws) Draw(ctx context.Context, drawID int64, seed string, count int) (*DrawResult, error) {
+	if count <= 0 {
+		return nil, errors.New("winner count must be positive")
+	}
+
+	draw, err := ld.repo.GetDraw(ctx, drawID)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find draw: %w", err)
+	}
+	if draw.DrawnAt.Valid {
+		return nil, repository.ErrDrawCompleted
+	}
+	if hashHex(seed) != draw.SeedHash {
+		return nil, ErrSeedMismatch
+	}
+	seedBytes, err := hex.DecodeString(seed)
+	if err != nil {
+		return nil, ErrSeedMismatch
+	}
+
+	entries, err := ld.repo.GetLotteryEntries(ctx, draw.LotteryID, draw.LastEntryID)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get lottery entries: %w", err)
+	}
+	if EntriesDigest(entries) != draw.EntriesDigest {
+		return nil, ErrEntriesChanged
+	}
+
+	excluded, err := ld.repo.GetWinnerClientIDs(ctx, draw.ExcludedLotteryIDs, draw.CommittedAt)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get excluded winners: %w", err)
+	}
+
+	winners := SelectWinners(seedBytes, entries, count, excluded)
+	drawnAt := time.Now()
+
+	if err := ld.repo.SaveDrawResults(ctx, draw, seed, winners, drawnAt); err != nil {
+		return nil, fmt.Errorf("Failed to save draw results: %w", err)
+	}
+	draw.Seed = seed
+	draw.DrawnAt.Time, draw.DrawnAt.Valid = drawnAt, true
+
+	ld.LogInstance.InfoLogger.Info("Lottery draw completed", "lottery_id", draw.LotteryID, "draw_id", draw.ID, "entries", len(entries), "winners", len(winners))
+
+	shortNumber, err := ld.repo.GetLotteryShortNumber(ctx, draw.LotteryID)
+	if err != nil {
+		ld.LogInstance.ErrorLogger.Error("Failed to find lottery short number for winner broadcast", "lottery_id", draw.LotteryID, "error", err)
+	} else {
+		for _, winner := range winners {
+			ld.broadcaster.Broadcast(shortNumber, domain.LotteryWinnerMessage{
+				Type:          lotteryWinnerType,
+				LotteryID:     draw.LotteryID,
+				DrawID:        draw.ID,
+				Position:      winner.Position,
+				Src:           domain.NewSubscriber(winner.Entry.Phone, winner.Entry.ClientID),
+				SeedHash:      draw.SeedHash,
+				Seed:          seed,
+				EntriesDigest: draw.EntriesDigest,
+				Date:          drawnAt.Format(customDateFormat),
+			})
+		}
+	}
+
+	return &DrawResult{Draw: draw, Entries: len(entries), Winners: winners}, nil
+}
+
+// SelectWinners deterministically picks up to count entries from seed using a
+// partial Fisher-Yates shuffle driven by SHA-256(seed || round). Entries of
+// excluded clients are skipped and every client wins at most once.
+func SelectWinners(seed []byte, entries []repository.LotteryEntry, count int, excluded map[int64]bool) []repository.LotteryWinner {
+	pool := make([]repository.LotteryEntry, len(entries))
+	copy(pool, entries)
+
+	var winners []repository.LotteryWinner
+	won := make(map[int64]bool)
+	var round uint64
+
+	for i := 0; i < len(pool) && len(winners) < count; i++ {
+		j := i + int(uniformIndex(seed, &round, uint64(len(pool)-i)))
+		pool[i], pool[j] = pool[j], pool[i]
+
+		entry := pool[i]
+		if excluded[entry.ClientID] || won[entry.ClientID] {
+			continue
+		}
+		won[entry.ClientID] = true
+		winners = append(winners, repository.LotteryWinner{Position: len(winners) + 1, Entry: entry})
+	}
+
+	return winners
+}
+
+// uniformIndex returns an unbiased value in [0, n) using rejection sampling.
+func uniformIndex(seed []byte, round *uint64, n uint64) uint64 {
+	limit := ^uint64(0) - ^uint64(0)%n
+	for {
+		block := make([]byte, len(seed)+8)
+		copy(block, seed)
+		binary.BigEndian.PutUint64(block[len(seed):], *round)
+		*round++
+
+		sum := sha256.Sum256(block)
+		value := binary.BigEndian.Uint64(sum[:8])
+		if value < limit {
+			return value % n
+		}
+	}
+}
+
+// EntriesDigest fingerprints the ordered entry IDs the draw was made from.
+func EntriesDigest(entries []repository.LotteryEntry) string {
+	h := sha256.New()
+	for _, entry := range entries {
+		h.Write([]byte(strconv.FormatInt(entry.ID, 10)))
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func hashHex(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
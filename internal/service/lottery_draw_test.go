@@ -0,0 +1,82 @@
+package service
+
+import (
+	"answers-processor/internal/repository"
+	"encoding/hex"
+	"testing"
+)
+
+// The vectors below let auditors check an independent implementation of the
+// draw: seed 00 01 ... 1f and entries 1 to 10 sent by clients 100 + id%7.
+const testSeed = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+
+func testEntries() []repository.LotteryEntry {
+	var entries []repository.LotteryEntry
+	for id := int64(1); id <= 10; id++ {
+		entries = append(entries, repository.LotteryEntry{ID: id, ClientID: 100 + id%7})
+	}
+	return entries
+}
+
+func TestSelectWinners(t *testing.T) {
+	seed, err := hex.DecodeString(testSeed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		entries  []repository.LotteryEntry
+		count    int
+		excluded map[int64]bool
+		want     []int64 // entry IDs in winning order
+	}{
+		{"three winners", testEntries(), 3, nil, []int64{2, 3, 5}},
+		{"one winner", testEntries(), 1, nil, []int64{2}},
+		{"clients win once", testEntries(), 10, nil, []int64{2, 3, 5, 4, 7, 8, 6}},
+		{"excluded clients", testEntries(), 10, map[int64]bool{101: true}, []int64{2, 3, 5, 4, 7, 6}},
+		{"no entries", nil, 3, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			winners := SelectWinners(seed, tt.entries, tt.count, tt.excluded)
+			if len(winners) != len(tt.want) {
+				t.Fatalf("got %d winners, want %d", len(winners), len(tt.want))
+			}
+			for i, winner := range winners {
+				if winner.Position != i+1 || winner.Entry.ID != tt.want[i] {
+					t.Errorf("winner %d = position %d entry %d, want position %d entry %d", i, winner.Position, winner.Entry.ID, i+1, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSelectWinnersDoesNotReorderEntries(t *testing.T) {
+	seed, _ := hex.DecodeString(testSeed)
+	entries := testEntries()
+	SelectWinners(seed, entries, 3, nil)
+	for i, entry := range entries {
+		if entry.ID != int64(i+1) {
+			t.Fatalf("entries were reordered: %v", entries)
+		}
+	}
+}
+
+func TestEntriesDigest(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []repository.LotteryEntry
+		want    string
+	}{
+		{"no entries", nil, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		{"entries 1 to 10", testEntries(), "bf794518e35d7f1ce3a50b3058c4191bb9401e568fc645d77e10b0f404cf1f22"},
+	}
+
+	for _, tt := range tests {
+		if got := EntriesDigest(tt.entries); got != tt.want {
+			t.Errorf("%s: EntriesDigest = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
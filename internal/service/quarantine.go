@@ -0,0 +1,90 @@
+package service
+
+import (
+	"answers-processor/internal/domain"
+	"answers-processor/internal/pipeline"
+	"answers-processor/internal/repository"
+	"answers-processor/pkg/logger"
+	"context"
+	"expvar"
+	"fmt"
+	"time"
+)
+
+// messagePanics counts messages whose processing panicked. It is published
+// on /admin/debug/vars.
+var messagePanics = expvar.NewInt("message_panics_total")
+
+// quarantineMessage records a message whose processing panicked so that it
+// can be replayed later.
+func (s *Service) quarantineMessage(ctx context.Context, message domain.SMSMessage, panicErr *pipeline.PanicError) {
+	messagePanics.Add(1)
+	s.LogInstance.ErrorLogger.Error("Recovered from panic while processing message",
+		"src", message.Source, "dst", message.Destination, "panic", panicErr.Value, "stack", string(panicErr.Stack))
+
+	// The message context may already be done; the record must still be written
+	id, err := s.quarantine.InsertQuarantinedMessage(context.WithoutCancel(ctx), &repository.QuarantinedMessage{
+		Source:        message.Source,
+		Destination:   message.Destination,
+		Text:          message.Text,
+		Date:          message.Date,
+		Panic:         fmt.Sprint(panicErr.Value),
+		Stack:         string(panicErr.Stack),
+		QuarantinedAt: time.Now(),
+	})
+	if err != nil {
+		s.LogInstance.ErrorLogger.Error("Failed to quarantine message", "src", message.Source, "dst", message.Destination, "error", err)
+		return
+	}
+	s.LogInstance.InfoLogger.Info("Message quarantined", "id", id, "dst", message.Destination)
+}
+
+// Quarantine lists and replays messages whose processing panicked.
+type Quarantine struct {
+	repo        *repository.QuarantineRepository
+	processor   *Service
+	LogInstance *logger.Loggers
+}
+
+func NewQuarantine(repo *repository.QuarantineRepository, processor *Service, logInstance *logger.Loggers) *Quarantine {
+	return &Quarantine{
+		repo:        repo,
+		processor:   processor,
+		LogInstance: logInstance,
+	}
+}
+
+func (q *Quarantine) Messages(ctx context.Context, limit int) ([]repository.QuarantinedMessage, error) {
+	messages, err := q.repo.GetQuarantinedMessages(ctx, limit)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get quarantined messages: %w", err)
+	}
+	return messages, nil
+}
+
+// Replay processes a quarantined message again. The message is marked as
+// replayed first, so a message that panics again is quarantined anew rather
+// than replayed twice. A replay that fails for a reason a retry may fix
+// releases the mark again, so the message stays listed.
+func (q *Quarantine) Replay(ctx context.Context, id int64) (*repository.QuarantinedMessage, error) {
+	quarantined, err := q.repo.ClaimForReplay(ctx, id, time.Now())
+	if err != nil {
+		return quarantined, err
+	}
+
+	err = q.processor.ProcessMessage(ctx, domain.SMSMessage{
+		Source:      quarantined.Source,
+		Destination: quarantined.Destination,
+		Text:        quarantined.Text,
+		Date:        quarantined.Date,
+	})
+	if err != nil {
+		// The request context may already be done; the mark must still be cleared
+		if releaseErr := q.repo.ReleaseReplay(context.WithoutCancel(ctx), id); releaseErr != nil {
+			q.LogInstance.ErrorLogger.Error("Failed to release quarantined message for replay", "id", id, "error", releaseErr)
+		}
+		return quarantined, fmt.Errorf("Failed to replay message: %w", err)
+	}
+	q.LogInstance.InfoLogger.Info("Quarantined message replayed", "id", id, "dst", quarantined.Destination)
+	return quarantined, nil
+}
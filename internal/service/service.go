@@ -1,14 +1,27 @@
 package service
 
 import (
+	"answers-processor/config"
+	"answers-processor/internal/campaigns"
 	websocket "answers-processor/internal/delivery"
 	"answers-processor/internal/domain"
 	publisher "answers-processor/internal/infrastructure/rabbitmq/publisher"
+	"answers-processor/internal/pipeline"
 	"answers-processor/internal/repository"
 	"answers-processor/internal/strategies"
+	"answers-processor/pkg/cache"
+	db "answers-processor/pkg/database"
+	"answers-processor/pkg/dates"
 	"answers-processor/pkg/logger"
+	"answers-processor/pkg/phone"
+	"context"
 	"database/sql"
-
+	"errors"
+	"expvar"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -16,55 +29,323 @@ type Service struct {
 	DB          *sql.DB
 	LogInstance *logger.Loggers
 	strategies  map[string]strategies.ProcessingStrategy
+	started     []strategies.Lifecycle
+	handler     pipeline.Handler
+	quarantine  *repository.QuarantineRepository
+	dates       *dates.Parser
+	phones      *phone.Normalizer
+	clientIDs   *cache.LRU[string, int64]
+	campaigns   *campaigns.Cache
+
+	// Reloadable settings; reloadMu is held for reading while a message is
+	// processed, so a reload applies between messages and all at once
+	reloadMu sync.RWMutex
+	settings *pipeline.Settings
+	disabled map[string]bool // account types switched off in features
+
+	messageTimeout time.Duration
 }
 
 const customDateFormat = "2006-01-02T15:04:05"
 
-func NewService(db *sql.DB, publisher publisher.MessagePublisher, wsServer websocket.Broadcaster, logInstance *logger.Loggers) *Service {
+// adjustedDates counts message dates replaced under the dates policies, by
+// adjustment, so that a change in the gateway's date format shows up.
+var adjustedDates = expvar.NewMap("message_dates_adjusted_total")
+
+// NewService constructs every registered strategy. Strategies register
+// themselves with strategies.Register, so adding a campaign type does not
+// require changes here.
+func NewService(cfg *config.Config, db, replica *sql.DB, publisher publisher.MessagePublisher, wsServer websocket.Handler, logInstance *logger.Loggers) (*Service, error) {
+	dateParser, err := dates.NewParser(dates.Options{
+		Timezone:      cfg.Dates.Timezone,
+		Layouts:       cfg.Dates.Layouts,
+		MissingPolicy: cfg.Dates.MissingPolicy,
+		SkewPolicy:    cfg.Dates.SkewPolicy,
+		MaxFutureSkew: cfg.Dates.MaxFutureSkew,
+		MaxPastSkew:   cfg.Dates.MaxPastSkew,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid dates configuration: %w", err)
+	}
+	strategies.SetLocation(dateParser.Location())
+
+	phones, err := phone.NewNormalizer(cfg.Phone.DefaultCountry)
+	if err != nil {
+		return nil, fmt.Errorf("invalid phone configuration: %w", err)
+	}
+
 	s := &Service{
 		DB:          db,
 		LogInstance: logInstance,
 		strategies:  make(map[string]strategies.ProcessingStrategy),
+		quarantine:  &repository.QuarantineRepository{DB: db},
+		dates:       dateParser,
+		phones:      phones,
+		clientIDs:   cache.NewLRU[string, int64](cfg.Phone.CacheSize, cfg.Phone.CacheTTL),
+		campaigns:   campaigns.NewCache(db, replica, cfg.Campaigns.RefreshInterval, cfg.Campaigns.Lookback, logInstance),
+
+		settings: pipeline.NewSettings(cfg.Pipeline),
+		disabled: disabledTypes(cfg.Features),
+
+		messageTimeout: cfg.Pipeline.MessageTimeout,
+	}
+
+	deps := strategies.Dependencies{
+		DB:          db,
+		Replica:     replica,
+		Config:      cfg,
+		Publisher:   publisher,
+		Broadcaster: wsServer,
+		LogInstance: logInstance,
+		Campaigns:   s.campaigns,
 	}
 
 	// Initialize strategies
-	s.strategies["quiz"] = strategies.NewQuizStrategy(publisher, wsServer, &repository.QuizRepository{DB: db})
-	s.strategies["voting"] = strategies.NewVoteStrategy(publisher, wsServer, &repository.VotingRepository{DB: db})
-	s.strategies["shop"] = strategies.NewShopStrategy(publisher, wsServer, &repository.ShopRepository{DB: db})
-	s.strategies["lottery"] = strategies.NewLotteryStrategy(publisher, wsServer, &repository.LotteryRepository{DB: db})
-	return s
+	for _, registration := range strategies.Registered() {
+		if registration.Validate != nil {
+			if err := registration.Validate(cfg); err != nil {
+				return nil, fmt.Errorf("invalid configuration for %s strategy: %w", registration.Type, err)
+			}
+		}
+
+		strategy, err := registration.New(deps)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create %s strategy: %w", registration.Type, err)
+		}
+		s.strategies[registration.Type] = strategy
+	}
+
+	// Let strategies that expose live state serve it to newly connected clients
+	for _, strategy := range s.strategies {
+		if provider, ok := strategy.(websocket.SnapshotProvider); ok {
+			wsServer.AddSnapshotProvider(provider)
+		}
+	}
+
+	middlewares, err := pipeline.Build(cfg.Pipeline, s.settings, s.resolve, logInstance)
+	if err != nil {
+		return nil, err
+	}
+	s.handler = pipeline.Chain(s.dispatch, middlewares...)
+	return s, nil
+}
+
+// Start runs the lifecycle hooks of strategies with background work. On
+// failure the strategies already started are stopped again.
+func (s *Service) Start() error {
+	if err := s.campaigns.Start(); err != nil {
+		return fmt.Errorf("failed to load campaign cache: %w", err)
+	}
+
+	for accountType, strategy := range s.strategies {
+		lifecycle, ok := strategy.(strategies.Lifecycle)
+		if !ok {
+			continue
+		}
+		if err := lifecycle.Start(); err != nil {
+			s.Stop()
+			return fmt.Errorf("failed to start %s strategy: %w", accountType, err)
+		}
+		s.started = append(s.started, lifecycle)
+	}
+	return nil
+}
+
+// Stop waits for the message in progress, then stops started strategies in
+// reverse order, which writes votes still buffered.
+func (s *Service) Stop() {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	for i := len(s.started) - 1; i >= 0; i-- {
+		s.started[i].Stop()
+	}
+	s.started = nil
+	s.campaigns.Stop()
+}
+
+// Reload applies the reloadable settings of cfg: pipeline rate limits and
+// blocklist, features and the settings of reconfigurable strategies. It waits
+// for the message in progress, so no message sees a mix of old and new
+// settings.
+func (s *Service) Reload(cfg *config.Config) {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	s.settings.Apply(cfg.Pipeline)
+	s.disabled = disabledTypes(cfg.Features)
+	for _, strategy := range s.strategies {
+		if reconfigurable, ok := strategy.(strategies.Reconfigurable); ok {
+			reconfigurable.Reconfigure(cfg)
+		}
+	}
+}
+
+func disabledTypes(features config.Features) map[string]bool {
+	disabled := make(map[string]bool, len(features.DisabledTypes))
+	for _, accountType := range features.DisabledTypes {
+		disabled[strings.TrimSpace(accountType)] = true
+	}
+	return disabled
 }
 
-func (s *Service) ProcessMessage(message domain.SMSMessage) {
+// CheckAccountTypes reports account types in the accounts table that no
+// registered strategy handles; messages to those accounts would be dropped.
+func (s *Service) CheckAccountTypes(ctx context.Context) ([]string, error) {
+	accountTypes, err := repository.GetAccountTypes(ctx, s.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	var unknown []string
+	for _, accountType := range accountTypes {
+		if _, ok := s.strategies[accountType]; !ok {
+			unknown = append(unknown, accountType)
+		}
+	}
+	return unknown, nil
+}
+
+// ProcessMessage handles one incoming SMS. Processing is abandoned when ctx is
+// cancelled or the configured per-message timeout expires. A panic while
+// processing is recovered and the message quarantined, so one bad message
+// cannot stop the consumer. An error is returned only when processing failed
+// before anything was written, for a reason a retry may fix such as the
+// database being unreachable; the message should then be delivered again.
+// Failures after a write, e.g. a reply that could not be sent, are logged
+// only, since a redelivery would write twice.
+func (s *Service) ProcessMessage(ctx context.Context, message domain.SMSMessage) (retryErr error) {
+	s.reloadMu.RLock()
+	defer s.reloadMu.RUnlock()
+
+	defer func() {
+		if r := recover(); r != nil {
+			s.quarantineMessage(ctx, message, &pipeline.PanicError{Value: r, Stack: debug.Stack()})
+			retryErr = nil
+		}
+	}()
+
 	if s.DB == nil {
 		s.LogInstance.ErrorLogger.Error("Database instance is nil in ProcessMessage")
-		return
+		return nil
+	}
+
+	if s.messageTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.messageTimeout)
+		defer cancel()
 	}
 
-	parsedDate, err := time.Parse(customDateFormat, message.Date)
+	parsedDate, adjustment, err := s.dates.Parse(message.Date, time.Now())
 	if err != nil {
-		s.LogInstance.ErrorLogger.Error("Failed to parse date", "date", message.Date, "error", err)
-		return
+		s.LogInstance.ErrorLogger.Error("Rejected message date", "date", message.Date, "dst", message.Destination, "error", err)
+		return nil
+	}
+	if adjustment != dates.AdjustedNone {
+		adjustedDates.Add(adjustment, 1)
+		s.LogInstance.InfoLogger.Warn("Replaced message date", "date", message.Date, "dst", message.Destination, "adjustment", adjustment, "used", parsedDate.Format(customDateFormat))
 	}
 
-	clientID, err := repository.InsertClientIfNotExists(s.DB, message.Source)
+	// Clients are keyed by E.164 numbers so that one subscriber cannot appear
+	// as several clients; replies go to the source as received and other
+	// messages to the gateway form stored with the client
+	clientPhone, err := s.phones.Normalize(message.Source)
 	if err != nil {
-		s.LogInstance.ErrorLogger.Error("Failed to insert or find client", "error", err)
-		return
+		s.LogInstance.ErrorLogger.Error("Failed to normalize phone number", "src", message.Source, "error", err)
+		clientPhone = strings.TrimSpace(message.Source)
 	}
 
-	accountType, err := repository.GetAccountType(s.DB, message.Destination)
+	pc := &pipeline.Context{
+		Ctx:         ctx,
+		Message:     message,
+		ParsedDate:  parsedDate,
+		Phone:       clientPhone,
+		ShortNumber: message.Destination,
+	}
+	if err := s.handler(pc); err != nil {
+		pc.Result.Err = err
+		var panicErr *pipeline.PanicError
+		if errors.As(err, &panicErr) {
+			s.quarantineMessage(ctx, message, panicErr)
+			return nil
+		}
+		if pc.Result.Status == "" {
+			pc.Result.Status = pipeline.StatusFailed
+		}
+		s.LogInstance.ErrorLogger.Error(err.Error())
+		if errors.Is(err, db.ErrRetryable) {
+			return err
+		}
+	}
+	return nil
+}
+
+// HandleControl applies a control message received instead of an SMS.
+func (s *Service) HandleControl(ctx context.Context, message domain.ControlMessage) {
+	switch message.Control {
+	case domain.ControlInvalidateCampaigns:
+		if err := s.campaigns.Invalidate(ctx); err != nil {
+			s.LogInstance.ErrorLogger.Error("Failed to invalidate campaign cache", "dst", message.Destination, "error", err)
+			return
+		}
+		s.LogInstance.InfoLogger.Info("Campaign cache invalidated", "dst", message.Destination)
+	default:
+		s.LogInstance.ErrorLogger.Error("Unknown control message", "control", message.Control)
+	}
+}
+
+// clientID resolves the client for phone, from the cache when possible.
+// source is the phone as received, stored for messages sent to the client
+// later.
+func (s *Service) clientID(ctx context.Context, phone, source string) (int64, error) {
+	if id, ok := s.clientIDs.Get(phone); ok {
+		return id, nil
+	}
+	id, err := repository.UpsertClient(ctx, s.DB, phone, strings.TrimSpace(source))
 	if err != nil {
-		s.LogInstance.ErrorLogger.Error("Failed to get account type", "number", message.Destination)
-		return
+		return 0, err
 	}
+	s.clientIDs.Add(phone, id)
+	return id, nil
+}
 
-	if strategy, ok := s.strategies[accountType]; ok {
-		err = strategy.Process(clientID, message, parsedDate)
+// resolve is the resolve pipeline stage. It looks up the client and account
+// type for the stages after it and the strategy.
+func (s *Service) resolve(next pipeline.Handler) pipeline.Handler {
+	return func(pc *pipeline.Context) error {
+		clientID, err := s.clientID(pc.Ctx, pc.Phone, pc.Message.Source)
 		if err != nil {
-			s.LogInstance.ErrorLogger.Error(err.Error())
+			return fmt.Errorf("Failed to insert or find client: %w", db.Retryable(err))
 		}
-	} else {
-		s.LogInstance.ErrorLogger.Error("Unknown account type", "account_type", accountType)
+		pc.ClientID = clientID
+
+		accountType, err := s.campaigns.AccountType(pc.Ctx, pc.ShortNumber)
+		if err != nil {
+			return fmt.Errorf("Failed to get account type for %s: %w", pc.ShortNumber, err)
+		}
+		pc.AccountType = accountType
+
+		return next(pc)
+	}
+}
+
+// dispatch is the innermost pipeline handler. It hands the message to the
+// strategy for the account type.
+func (s *Service) dispatch(pc *pipeline.Context) error {
+	strategy, ok := s.strategies[pc.AccountType]
+	if !ok {
+		pc.Result.Status = pipeline.StatusUnknownAccount
+		return fmt.Errorf("Unknown account type %q", pc.AccountType)
+	}
+	if s.disabled[pc.AccountType] {
+		pc.Result.Status = pipeline.StatusDisabled
+		return nil
+	}
+
+	if err := strategy.Process(pc.Ctx, pc.ClientID, pc.Message, pc.ParsedDate); err != nil {
+		pc.Result.Status = pipeline.StatusFailed
+		return err
 	}
+	pc.Result.Status = pipeline.StatusProcessed
+	return nil
 }
@@ -0,0 +1,47 @@
+package service
+
+import (
+	websocket "answers-processor/internal/delivery"
+	"answers-processor/internal/domain"
+	"answers-processor/internal/repository"
+	"answers-processor/internal/strategies"
+	"answers-processor/pkg/logger"
+	"context"
+	"time"
+)
+
+// ShopOrders confirms reserved shop orders, e.g. once the operator has
+// reached the buyer. Confirmed orders keep their stock when reservations
+// expire and are broadcast to the shop's WebSocket channel.
+type ShopOrders struct {
+	repo        *repository.ShopRepository
+	broadcaster websocket.Broadcaster
+	LogInstance *logger.Loggers
+}
+
+func NewShopOrders(repo *repository.ShopRepository, broadcaster websocket.Broadcaster, logInstance *logger.Loggers) *ShopOrders {
+	return &ShopOrders{
+		repo:        repo,
+		broadcaster: broadcaster,
+		LogInstance: logInstance,
+	}
+}
+
+func (so *ShopOrders) Confirm(ctx context.Context, id int64) (*repository.ShopOrder, error) {
+	order, err := so.repo.ConfirmOrder(ctx, id, strategies.CurrentDateTime())
+	if err != nil {
+		return order, err
+	}
+
+	so.broadcaster.Broadcast(order.ShortNumber, domain.ShoppingMessage{
+		LotID:    order.LotID,
+		Date:     time.Now().Format(customDateFormat),
+		Src:      domain.NewSubscriber(order.Phone, order.ClientID),
+		OrderID:  order.ID,
+		Quantity: order.Quantity,
+		Variant:  order.Variant,
+		Status:   repository.OrderStatusConfirmed,
+	})
+	so.LogInstance.InfoLogger.Info("Shop order confirmed", "order_id", id, "dst", order.ShortNumber)
+	return order, nil
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	websocket "answers-processor/internal/delivery"
+	"answers-processor/internal/domain"
+	"answers-processor/internal/repository"
+	"answers-processor/pkg/logger"
+	"context"
+	"fmt"
+	"time"
+)
+
+const wallMessageType = "wall_message"
+
+// WallModeration approves and rejects queued SMS wall messages. Approved
+// messages are broadcast to the wall's WebSocket channel.
+type WallModeration struct {
+	repo        *repository.WallRepository
+	broadcaster websocket.Broadcaster
+	LogInstance *logger.Loggers
+}
+
+func NewWallModeration(repo *repository.WallRepository, broadcaster websocket.Broadcaster, logInstance *logger.Loggers) *WallModeration {
+	return &WallModeration{
+		repo:        repo,
+		broadcaster: broadcaster,
+		LogInstance: logInstance,
+	}
+}
+
+func (wm *WallModeration) Queue(ctx context.Context, shortNumber, status string, limit int) ([]repository.WallMessage, error) {
+	messages, err := wm.repo.GetWallMessages(ctx, shortNumber, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get wall messages: %w", err)
+	}
+	return messages, nil
+}
+
+func (wm *WallModeration) Approve(ctx context.Context, id int64) (*repository.WallMessage, error) {
+	message, err := wm.repo.Moderate(ctx, id, repository.WallStatusApproved, "", time.Now())
+	if err != nil {
+		return message, err
+	}
+
+	wm.broadcaster.Broadcast(message.ShortNumber, domain.WallMessage{
+		Type:      wallMessageType,
+		MessageID: message.ID,
+		Message:   message.Message,
+		Src:       domain.NewSubscriber(message.Phone, message.ClientID),
+		Date:      message.Date.Format(customDateFormat),
+	})
+	wm.LogInstance.InfoLogger.Info("Wall message approved", "id", id, "dst", message.ShortNumber)
+	return message, nil
+}
+
+func (wm *WallModeration) Reject(ctx context.Context, id int64, reason string) (*repository.WallMessage, error) {
+	message, err := wm.repo.Moderate(ctx, id, repository.WallStatusRejected, reason, time.Now())
+	if err != nil {
+		return message, err
+	}
+	wm.LogInstance.InfoLogger.Info("Wall message rejected", "id", id, "dst", message.ShortNumber)
+	return message, nil
+}
@@ -0,0 +1,139 @@
+package strategies
+
+import (
+	"answers-processor/config"
+	websocket "answers-processor/internal/delivery"
+	"answers-processor/internal/domain"
+	"answers-processor/internal/infrastructure/rabbitmq/publisher"
+	"answers-processor/internal/repository"
+	"answers-processor/pkg/logger"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const auctionLeaderType = "auction_leader"
+
+func init() {
+	Register(Registration{
+		Type: "auction",
+		New: func(deps Dependencies) (ProcessingStrategy, error) {
+			return NewAuctionStrategy(deps.Publisher, deps.Broadcaster, &repository.AuctionRepository{DB: deps.DB, Replica: deps.Replica}, deps.Config.Auction.BidIncrement, deps.LogInstance), nil
+		},
+		Validate: func(cfg *config.Config) error {
+			if cfg.Auction.BidIncrement <= 0 {
+				return fmt.Errorf("auction.bid_increment must be positive, got %d", cfg.Auction.BidIncrement)
+			}
+			return nil
+		},
+	})
+}
+
+type AuctionStrategy struct {
+	publisher    publisher.MessagePublisher
+	broadcaster  websocket.Broadcaster
+	repo         *repository.AuctionRepository
+	bidIncrement int64
+	logInstance  *logger.Loggers
+}
+
+func NewAuctionStrategy(publisher publisher.MessagePublisher, broadcaster websocket.Broadcaster, repo *repository.AuctionRepository, bidIncrement int64, logInstance *logger.Loggers) ProcessingStrategy {
+	return &AuctionStrategy{
+		publisher:    publisher,
+		broadcaster:  broadcaster,
+		repo:         repo,
+		bidIncrement: bidIncrement,
+		logInstance:  logInstance,
+	}
+}
+
+func (as *AuctionStrategy) Process(ctx context.Context, clientID int64, message domain.SMSMessage, parsedDate time.Time) error {
+	lot, err := as.repo.GetAuctionLotByShortNumber(ctx, message.Destination, parsedDate)
+	if err != nil {
+		return fmt.Errorf("Failed to find auction lot by short number and date: %w", err)
+	}
+
+	amount, ok := parseBidAmount(message.Text)
+	if !ok {
+		as.reply(ctx, message, "Teklibinizi san bilen iberin")
+		return nil
+	}
+
+	previous, err := as.repo.PlaceBid(ctx, lot, clientID, amount, as.bidIncrement, message.Text, parsedDate)
+	if errors.Is(err, repository.ErrBidTooLow) {
+		minimum := repository.MinimumBid(lot, previous, as.bidIncrement)
+		as.reply(ctx, message, fmt.Sprintf("Teklibiniz azyndan %d bolmaly", minimum))
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to place bid: %w", err)
+	}
+
+	as.reply(ctx, message, fmt.Sprintf("Sizin %d teklibiniz kabul edildi", amount))
+
+	// Let the previous leader know they have been outbid
+	if previous != nil && previous.ClientID != clientID {
+		text := fmt.Sprintf("Sizin teklibiniz gecildi, hazirki in yokary teklip %d", amount)
+		if err := as.publisher.SendMessage(ctx, message.Destination, previous.Phone, text); err != nil {
+			as.logInstance.ErrorLogger.Error("Failed to send outbid notification", "lot_id", lot.ID, "client_id", previous.ClientID, "error", err)
+		}
+	}
+
+	leader := &repository.AuctionBid{ClientID: clientID, Phone: message.Source, Amount: amount}
+	as.broadcaster.Broadcast(message.Destination, as.leaderMessage(lot, leader, parsedDate))
+	return nil
+}
+
+// Snapshot implements websocket.SnapshotProvider with the current leader of
+// the lot auctioned on the destination.
+func (as *AuctionStrategy) Snapshot(ctx context.Context, destination string) (any, error) {
+	now := CurrentDateTime()
+	lot, err := as.repo.GetAuctionLotByShortNumber(ctx, destination, now)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find auction lot by short number and date: %w", err)
+	}
+
+	highest, err := as.repo.GetHighestBid(ctx, lot.ID)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get highest bid: %w", err)
+	}
+	if highest == nil {
+		return nil, nil
+	}
+	return as.leaderMessage(lot, highest, now), nil
+}
+
+func (as *AuctionStrategy) leaderMessage(lot *repository.AuctionLot, leader *repository.AuctionBid, date time.Time) domain.AuctionMessage {
+	return domain.AuctionMessage{
+		Type:       auctionLeaderType,
+		LotID:      lot.ID,
+		HighestBid: leader.Amount,
+		Src:        domain.NewSubscriber(leader.Phone, leader.ClientID),
+		Date:       date.Format(customDateFormat),
+		EndsAt:     lot.EndsAt.Format(customDateFormat),
+	}
+}
+
+func (as *AuctionStrategy) reply(ctx context.Context, message domain.SMSMessage, text string) {
+	if err := as.publisher.SendMessage(ctx, message.Destination, message.Source, text); err != nil {
+		as.logInstance.ErrorLogger.Error("Failed to send message notification", "dst", message.Destination, "error", err)
+	}
+}
+
+// parseBidAmount accepts a positive whole amount, tolerating spaces used as
+// thousands separators.
+func parseBidAmount(text string) (int64, bool) {
+	text = strings.Join(strings.Fields(text), "")
+	amount, err := strconv.ParseInt(text, 10, 64)
+	if err != nil || amount <= 0 {
+		return 0, false
+	}
+	return amount, true
+}
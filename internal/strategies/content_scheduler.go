@@ -0,0 +1,110 @@
+package strategies
+
+import (
+	"answers-processor/internal/infrastructure/rabbitmq/publisher"
+	"answers-processor/internal/repository"
+	"answers-processor/pkg/logger"
+	"context"
+	"time"
+)
+
+// contentClaimLease is how long a claimed content is reserved for the
+// scheduler that claimed it before another run may claim it again.
+const contentClaimLease = 10 * time.Minute
+
+// contentScheduler pushes scheduled subscription content to the subscribers
+// of its topic once the content's send time has come.
+type contentScheduler struct {
+	repo        *repository.SubscriptionRepository
+	publisher   publisher.MessagePublisher
+	interval    time.Duration
+	logInstance *logger.Loggers
+	ctx         context.Context // cancelled by stop
+	cancel      context.CancelFunc
+}
+
+func newContentScheduler(repo *repository.SubscriptionRepository, publisher publisher.MessagePublisher, interval time.Duration, logInstance *logger.Loggers) *contentScheduler {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &contentScheduler{
+		repo:        repo,
+		publisher:   publisher,
+		interval:    interval,
+		logInstance: logInstance,
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+}
+
+// run delivers due content every interval until stop is called.
+func (cs *contentScheduler) run() {
+	ticker := time.NewTicker(cs.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			cs.deliverDueContents()
+		case <-cs.ctx.Done():
+			return
+		}
+	}
+}
+
+func (cs *contentScheduler) stop() {
+	cs.cancel()
+}
+
+func (cs *contentScheduler) deliverDueContents() {
+	now := CurrentDateTime()
+	contents, err := cs.repo.ClaimDueContents(cs.ctx, now, now.Add(contentClaimLease))
+	if err != nil {
+		cs.logInstance.ErrorLogger.Error("Failed to claim due subscription contents", "error", err)
+		return
+	}
+
+	for _, content := range contents {
+		if cs.ctx.Err() != nil {
+			return
+		}
+		cs.deliver(content)
+	}
+}
+
+// deliver sends the content to the subscribers it has not reached yet and
+// marks it as sent once all of them have it. Otherwise the content is claimed
+// again when its lease runs out.
+func (cs *contentScheduler) deliver(content repository.SubscriptionContent) {
+	recipients, err := cs.repo.GetPendingRecipients(cs.ctx, content.ID, content.TopicID)
+	if err != nil {
+		cs.logInstance.ErrorLogger.Error("Failed to get subscribers", "topic_id", content.TopicID, "error", err)
+		return
+	}
+
+	failed := 0
+	for _, recipient := range recipients {
+		if err := cs.publisher.SendMessage(cs.ctx, content.ShortNumber, recipient.Phone, content.Text); err != nil {
+			cs.logInstance.ErrorLogger.Error("Failed to send subscription content", "content_id", content.ID, "error", err)
+			failed++
+			continue
+		}
+		if err := cs.repo.RecordDelivery(cs.ctx, content.ID, recipient.ClientID, CurrentDateTime()); err != nil {
+			cs.logInstance.ErrorLogger.Error("Failed to record subscription content delivery", "content_id", content.ID, "client_id", recipient.ClientID, "error", err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		cs.logInstance.ErrorLogger.Error("Subscription content not delivered to all subscribers, retrying after the lease",
+			"content_id", content.ID, "topic_id", content.TopicID, "failed", failed, "subscribers", len(recipients))
+		return
+	}
+
+	if err := cs.repo.MarkContentSent(cs.ctx, content.ID, CurrentDateTime()); err != nil {
+		cs.logInstance.ErrorLogger.Error("Failed to mark subscription content as sent", "content_id", content.ID, "error", err)
+		return
+	}
+	cs.logInstance.InfoLogger.Info("Subscription content delivered", "content_id", content.ID, "topic_id", content.TopicID, "subscribers", len(recipients))
+}
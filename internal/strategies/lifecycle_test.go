@@ -0,0 +1,34 @@
+package strategies
+
+import (
+	"answers-processor/internal/repository"
+	"answers-processor/pkg/logger"
+	"testing"
+	"time"
+)
+
+// Stop may run more than once, e.g. from a deferred Stop after a failed Start.
+func TestLifecyclesStopTwice(t *testing.T) {
+	logInstance, err := logger.SetupLogger("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	strategies := map[string]ProcessingStrategy{
+		"shop":         NewShopStrategy(nil, nil, &repository.ShopRepository{}, ShopOptions{ReservationTTL: time.Hour, ExpiryInterval: time.Hour}, logInstance),
+		"voting":       NewVoteStrategy(nil, nil, &repository.VotingRepository{}, nil, VotingOptions{ResultsInterval: time.Hour, BatchWindow: time.Hour}, logInstance),
+		"subscription": NewSubscriptionStrategy(nil, &repository.SubscriptionRepository{}, time.Hour, logInstance),
+	}
+
+	for name, strategy := range strategies {
+		lifecycle, ok := strategy.(Lifecycle)
+		if !ok {
+			t.Fatalf("%s strategy does not implement Lifecycle", name)
+		}
+		if err := lifecycle.Start(); err != nil {
+			t.Fatalf("%s: Start: %v", name, err)
+		}
+		lifecycle.Stop()
+		lifecycle.Stop()
+	}
+}
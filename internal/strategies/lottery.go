@@ -1,71 +1,185 @@
 package strategies
 
 import (
+	"answers-processor/config"
+	"answers-processor/internal/campaigns"
 	websocket "answers-processor/internal/delivery"
 	"answers-processor/internal/domain"
 	"answers-processor/internal/infrastructure/rabbitmq/publisher"
 	"answers-processor/internal/repository"
 	"answers-processor/pkg/utils"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 )
 
+func init() {
+	Register(Registration{
+		Type: "lottery",
+		New: func(deps Dependencies) (ProcessingStrategy, error) {
+			return NewLotteryStrategy(deps.Publisher, deps.Broadcaster, &repository.LotteryRepository{DB: deps.DB, Replica: deps.Replica}, deps.Campaigns, lotteryOptions(deps.Config)), nil
+		},
+	})
+}
+
+// LotteryOptions configure the handling of texts that do not match the
+// lottery code. Reply templates may use the {suggestion} and {attempts}
+// placeholders.
+type LotteryOptions struct {
+	WrongCodeReply        string
+	SuggestionReply       string
+	MaxSuggestionDistance int
+	MaxWrongCodeReplies   int
+}
+
+func lotteryOptions(cfg *config.Config) LotteryOptions {
+	return LotteryOptions{
+		WrongCodeReply:        cfg.Lottery.WrongCodeReply,
+		SuggestionReply:       cfg.Lottery.SuggestionReply,
+		MaxSuggestionDistance: cfg.Lottery.MaxSuggestionDistance,
+		MaxWrongCodeReplies:   cfg.Lottery.MaxWrongCodeReplies,
+	}
+}
+
 type LotteryStrategy struct {
 	publisher   publisher.MessagePublisher
 	broadcaster websocket.Broadcaster
 	repo        *repository.LotteryRepository
+	campaigns   *campaigns.Cache
+	options     LotteryOptions
 }
 
-func NewLotteryStrategy(publisher publisher.MessagePublisher, broadcaster websocket.Broadcaster, repo *repository.LotteryRepository) ProcessingStrategy {
+func NewLotteryStrategy(publisher publisher.MessagePublisher, broadcaster websocket.Broadcaster, repo *repository.LotteryRepository, campaigns *campaigns.Cache, options LotteryOptions) ProcessingStrategy {
 	return &LotteryStrategy{
 		publisher:   publisher,
 		broadcaster: broadcaster,
 		repo:        repo,
+		campaigns:   campaigns,
+		options:     options,
 	}
 }
 
-func (ls *LotteryStrategy) Process(clientID int64, message domain.SMSMessage, parsedDate time.Time) error {
+// Reconfigure applies reloaded reply templates and limits.
+func (ls *LotteryStrategy) Reconfigure(cfg *config.Config) {
+	ls.options = lotteryOptions(cfg)
+}
+
+func (ls *LotteryStrategy) Process(ctx context.Context, clientID int64, message domain.SMSMessage, parsedDate time.Time) error {
 	// Implementation of quiz processing logic
 	const customDateFormat = "2006-01-02T15:04:05"
 
-	id, code, answer, err := ls.repo.GetLotteryByShortNumber(message.Destination, parsedDate)
+	lottery, err := ls.campaigns.Lottery(ctx, message.Destination, parsedDate)
 	if err != nil {
 		return fmt.Errorf("Failed to find lot by short number and date: %w", err)
 	}
 
 	text := strings.ToLower(strings.TrimSpace(message.Text))
-	code = strings.ToLower(strings.TrimSpace(code))
+	code := strings.ToLower(strings.TrimSpace(lottery.Code))
 
 	if text == code {
-		//todo insert lottery item bradcast
-		starredSrc := utils.StarMiddleDigits(message.Source)
-
-		err = ls.repo.InsertLotteryMessageAndUpdate(id, message.Text, parsedDate, clientID)
+		ticket, err := ls.repo.InsertLotteryMessageAndUpdate(ctx, lottery, message.Text, parsedDate, clientID)
+		if errors.Is(err, repository.ErrEntryLimitReached) {
+			return ls.sendEntryLimitReply(ctx, message, lottery, ticket)
+		}
 		if err != nil {
 			return fmt.Errorf("Failed to insert lottery message and update: %w", err)
 		}
 
 		// Send message notification
-		err = ls.publisher.SendMessage(message.Destination, message.Source, answer)
+		err = ls.publisher.SendMessage(ctx, message.Destination, message.Source, ticketReply(lottery.Answer, ticket))
 		if err != nil {
 			return fmt.Errorf("Failed to send message notification: %w", err)
 		}
 
 		// Broadcast to WebSocket
 		lotteryMessage := domain.LotteryMessage{
-			LotteryID: id,
-			Date:      parsedDate.Format(customDateFormat),
-			Src:       starredSrc,
+			LotteryID:    lottery.ID,
+			Date:         parsedDate.Format(customDateFormat),
+			Src:          domain.NewSubscriber(message.Source, clientID),
+			TicketNumber: ticket,
 		}
+		ls.broadcaster.Broadcast(message.Destination, lotteryMessage)
+		return nil
+	}
 
-		if msg, err := json.MarshalIndent(lotteryMessage, "", "    "); err != nil {
-			return fmt.Errorf("Failed to marshal correct answer message: %w", err)
-		} else {
-			ls.broadcaster.Broadcast(message.Destination, msg)
-		}
+	return ls.handleWrongCode(ctx, clientID, message, parsedDate, lottery)
+}
+
+// handleWrongCode records the unmatched text and tells the subscriber, with a
+// suggestion when the text is close to the code. Replies stop after
+// MaxWrongCodeReplies attempts so a misbehaving sender cannot run up costs.
+func (ls *LotteryStrategy) handleWrongCode(ctx context.Context, clientID int64, message domain.SMSMessage, parsedDate time.Time, lottery *repository.Lottery) error {
+	attempts, err := ls.repo.RecordUnmatchedEntry(ctx, lottery.ID, message.Text, parsedDate, clientID)
+	if err != nil {
+		return fmt.Errorf("Failed to record unmatched lottery entry: %w", err)
+	}
+
+	smsText := ls.options.wrongCodeReply(message.Text, lottery.Code, attempts)
+	if smsText == "" {
+		return nil
 	}
 
+	if err := ls.publisher.SendMessage(ctx, message.Destination, message.Source, smsText); err != nil {
+		return fmt.Errorf("Failed to send message notification: %w", err)
+	}
 	return nil
 }
+
+// wrongCodeReply returns the reply to the given attempt at the code, or an
+// empty string when the attempt gets no reply.
+func (o LotteryOptions) wrongCodeReply(text, code string, attempts int) string {
+	if attempts > o.MaxWrongCodeReplies {
+		return ""
+	}
+
+	template := o.WrongCodeReply
+	if isCloseToCode(text, code, o.MaxSuggestionDistance) && o.SuggestionReply != "" {
+		template = o.SuggestionReply
+	}
+	if template == "" {
+		return ""
+	}
+
+	return strings.NewReplacer(
+		"{suggestion}", strings.TrimSpace(code),
+		"{attempts}", strconv.Itoa(attempts),
+	).Replace(template)
+}
+
+// isCloseToCode reports whether text is within maxDistance edits of code,
+// ignoring case and whitespace.
+func isCloseToCode(text, code string, maxDistance int) bool {
+	normalize := func(s string) string {
+		return strings.ToLower(strings.Join(strings.Fields(s), ""))
+	}
+	text, code = normalize(text), normalize(code)
+	if text == "" || code == "" {
+		return false
+	}
+	return utils.Levenshtein(text, code) <= maxDistance
+}
+
+func (ls *LotteryStrategy) sendEntryLimitReply(ctx context.Context, message domain.SMSMessage, lottery *repository.Lottery, ticket int64) error {
+	smsText := fmt.Sprintf("Siz eyyam gatnasdynyz, bilet belginiz: %d", ticket)
+	if lottery.EntryPolicy == repository.EntryPolicyDaily {
+		smsText = fmt.Sprintf("Bu gun ucin gatnasyk cakiniz doldy, sonky bilet belginiz: %d", ticket)
+	}
+
+	if err := ls.publisher.SendMessage(ctx, message.Destination, message.Source, smsText); err != nil {
+		return fmt.Errorf("Failed to send message notification: %w", err)
+	}
+	return nil
+}
+
+// ticketReply fills the {ticket} placeholder of the lottery answer, or appends
+// the ticket number when the answer has none.
+func ticketReply(answer string, ticket int64) string {
+	number := strconv.FormatInt(ticket, 10)
+	if strings.Contains(answer, "{ticket}") {
+		return strings.ReplaceAll(answer, "{ticket}", number)
+	}
+	return strings.TrimSpace(answer) + " Bilet belginiz: " + number
+}
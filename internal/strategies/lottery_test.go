@@ -0,0 +1,64 @@
+package strategies
+
+import "testing"
+
+func TestIsCloseToCode(t *testing.T) {
+	tests := []struct {
+		text string
+		code string
+		want bool
+	}{
+		{"BAHAR", "BAHAR", true},    // distance 0
+		{"bahar", "BAHAR", true},    // case
+		{" ba har ", "BAHAR", true}, // whitespace
+		{"BAHR", "BAHAR", true},     // distance 1
+		{"BXHR", "BAHAR", true},     // distance 2
+		{"BXHRR", "BAHARA", false},  // distance 3
+		{"tomus", "BAHAR", false},
+		{"", "BAHAR", false},
+		{"   ", "BAHAR", false},
+		{"BAHAR", "", false},
+	}
+
+	for _, tt := range tests {
+		if got := isCloseToCode(tt.text, tt.code, 2); got != tt.want {
+			t.Errorf("isCloseToCode(%q, %q, 2) = %v; want %v", tt.text, tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestWrongCodeReply(t *testing.T) {
+	options := LotteryOptions{
+		WrongCodeReply:        "Nadogry kod, {attempts} synanysyk",
+		SuggestionReply:       "{suggestion} diymekcimi?",
+		MaxSuggestionDistance: 2,
+		MaxWrongCodeReplies:   3,
+	}
+	noSuggestion := options
+	noSuggestion.SuggestionReply = ""
+	disabled := options
+	disabled.MaxWrongCodeReplies = 0
+
+	tests := []struct {
+		name     string
+		options  LotteryOptions
+		text     string
+		attempts int
+		want     string
+	}{
+		{"suggestion", options, "bahr", 1, "BAHAR diymekcimi?"},
+		{"wrong code", options, "tomus", 2, "Nadogry kod, 2 synanysyk"},
+		{"last reply", options, "tomus", 3, "Nadogry kod, 3 synanysyk"},
+		{"over the cap", options, "bahr", 4, ""},
+		{"no suggestion template", noSuggestion, "bahr", 1, "Nadogry kod, 1 synanysyk"},
+		{"replies disabled", disabled, "tomus", 1, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.options.wrongCodeReply(tt.text, "BAHAR", tt.attempts); got != tt.want {
+				t.Errorf("wrongCodeReply(%q, %d) = %q; want %q", tt.text, tt.attempts, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,78 +1,87 @@
 package strategies
 
 import (
+	"answers-processor/internal/campaigns"
 	websocket "answers-processor/internal/delivery"
 	"answers-processor/internal/domain"
 	"answers-processor/internal/infrastructure/rabbitmq/publisher"
 	"answers-processor/internal/repository"
-	"answers-processor/pkg/utils"
-	"encoding/json"
+	"context"
 	"fmt"
 	"strings"
 	"time"
 )
 
+func init() {
+	Register(Registration{
+		Type: "quiz",
+		New: func(deps Dependencies) (ProcessingStrategy, error) {
+			return NewQuizStrategy(deps.Publisher, deps.Broadcaster, &repository.QuizRepository{DB: deps.DB, Replica: deps.Replica}, deps.Campaigns), nil
+		},
+	})
+}
+
 type QuizStrategy struct {
 	publisher   publisher.MessagePublisher
 	broadcaster websocket.Broadcaster
 	repo        *repository.QuizRepository
+	campaigns   *campaigns.Cache
 }
 
-func NewQuizStrategy(publisher publisher.MessagePublisher, broadcaster websocket.Broadcaster, repo *repository.QuizRepository) ProcessingStrategy {
+func NewQuizStrategy(publisher publisher.MessagePublisher, broadcaster websocket.Broadcaster, repo *repository.QuizRepository, campaigns *campaigns.Cache) ProcessingStrategy {
 	return &QuizStrategy{
 		publisher:   publisher,
 		broadcaster: broadcaster,
 		repo:        repo,
+		campaigns:   campaigns,
 	}
 }
 
-func (qs *QuizStrategy) Process(clientID int64, message domain.SMSMessage, parsedDate time.Time) error {
+func (qs *QuizStrategy) Process(ctx context.Context, clientID int64, message domain.SMSMessage, parsedDate time.Time) error {
 
 	text := message.Text
 
 	// _, questions, questionIDs, quizID, err := repository.GetAccountAndQuestions(qs.db, destination, parsedDate)
-	questionInfo, err := qs.repo.GetQuestionAndScoringInfo(message.Destination, parsedDate, clientID)
+	question, err := qs.campaigns.Question(ctx, message.Destination, parsedDate)
 	if err != nil {
 		return fmt.Errorf("Failed to find quiz and questions: %w", err)
 	}
+	scoring, err := qs.repo.GetScoringInfo(ctx, question.ID, clientID)
+	if err != nil {
+		return fmt.Errorf("Failed to get scoring info: %w", err)
+	}
 
-	isCorrect := compareAnswers(questionInfo.Answer, text)
+	isCorrect := compareAnswers(question.Answer, text)
 	const customDateFormat = "2006-01-02T15:04:05"
-	if isCorrect && !questionInfo.HasScored {
+	if isCorrect && !scoring.HasScored {
 
-		err = qs.repo.InsertAnswer(questionInfo.ID, text, parsedDate, clientID, questionInfo.Score, questionInfo.NextSerialNumber, questionInfo.NextSerialNumberForCorrect)
+		err = qs.repo.InsertAnswer(ctx, question.ID, text, parsedDate, clientID, question.Score, scoring.NextSerialNumber, scoring.NextSerialNumberForCorrect)
 		if err != nil {
 			return fmt.Errorf("Failed to insert answer: %w", err)
 		}
 
-		starredSrc := utils.StarMiddleDigits(message.Source)
-
 		correctAnswerMessage := domain.CorrectAnswerMessage{
 			Answer:                 text,
-			Score:                  questionInfo.Score,
+			Score:                  question.Score,
 			Date:                   parsedDate.Format(customDateFormat),
-			SerialNumber:           questionInfo.NextSerialNumber,
-			SerialNumberForCorrect: questionInfo.NextSerialNumberForCorrect,
-			StarredSrc:             starredSrc,
-			QuizID:                 questionInfo.QuizID,
-			QuestionID:             questionInfo.ID,
+			SerialNumber:           scoring.NextSerialNumber,
+			SerialNumberForCorrect: scoring.NextSerialNumberForCorrect,
+			StarredSrc:             domain.NewSubscriber(message.Source, clientID),
+			QuizID:                 question.QuizID,
+			QuestionID:             question.ID,
 		}
 
-		if msg, err := json.MarshalIndent(correctAnswerMessage, "", "    "); err != nil {
-			return fmt.Errorf("Failed to marshal correct answer message: %w", err)
-		} else {
-			qs.broadcaster.Broadcast(message.Destination, msg)
-		}
+		qs.broadcaster.Broadcast(message.Destination, correctAnswerMessage)
 
 	} else {
-		incorrectAnswerCount, err := qs.repo.GetIncorrectAnswerCount(questionInfo.ID, clientID)
+		incorrectAnswerCount, err := qs.repo.GetIncorrectAnswerCount(ctx, question.ID, clientID)
 		if err != nil {
 			//qs.service.LogInstance.ErrorLogger.Error("Failed to get incorrect answer count", "error", err)
 			return fmt.Errorf("Failed to get incorrect answer count: %w", err)
 		}
 
 		if incorrectAnswerCount == 0 {
-			err = qs.repo.InsertAnswer(questionInfo.ID, text, parsedDate, clientID, 0, questionInfo.NextSerialNumber, questionInfo.NextSerialNumberForCorrect)
+			err = qs.repo.InsertAnswer(ctx, question.ID, text, parsedDate, clientID, 0, scoring.NextSerialNumber, scoring.NextSerialNumberForCorrect)
 			if err != nil {
 				return fmt.Errorf("Failed to insert answer: %w", err)
 			}
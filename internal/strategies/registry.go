@@ -0,0 +1,83 @@
+package strategies
+
+import (
+	"answers-processor/config"
+	"answers-processor/internal/campaigns"
+	websocket "answers-processor/internal/delivery"
+	"answers-processor/internal/infrastructure/rabbitmq/publisher"
+	"answers-processor/pkg/logger"
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Dependencies are handed to every strategy constructor.
+type Dependencies struct {
+	DB          *sql.DB
+	Replica     *sql.DB // nil without a read replica
+	Config      *config.Config
+	Publisher   publisher.MessagePublisher
+	Broadcaster websocket.Broadcaster
+	LogInstance *logger.Loggers
+	Campaigns   *campaigns.Cache
+}
+
+// Registration describes a campaign type. Type is the accounts.type value the
+// strategy handles. Validate, when set, checks the strategy's configuration
+// before it is constructed.
+type Registration struct {
+	Type     string
+	New      func(deps Dependencies) (ProcessingStrategy, error)
+	Validate func(cfg *config.Config) error
+}
+
+// Lifecycle is implemented by strategies that run background work. Start is
+// called once all strategies are constructed and Stop on shutdown. Stop must
+// be safe to call more than once.
+type Lifecycle interface {
+	Start() error
+	Stop()
+}
+
+// Reconfigurable is implemented by strategies with settings that can be
+// reloaded while the service runs. Reconfigure is never called while a
+// message is being processed.
+type Reconfigurable interface {
+	Reconfigure(cfg *config.Config)
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[string]Registration)
+)
+
+// Register makes a strategy available to the service. It is meant to be
+// called from init and panics on duplicate or incomplete registrations.
+func Register(registration Registration) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if registration.Type == "" || registration.New == nil {
+		panic("strategies: registration needs a type and a constructor")
+	}
+	if _, exists := registry[registration.Type]; exists {
+		panic(fmt.Sprintf("strategies: type %q registered twice", registration.Type))
+	}
+	registry[registration.Type] = registration
+}
+
+// Registered returns all registrations ordered by type.
+func Registered() []Registration {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	registrations := make([]Registration, 0, len(registry))
+	for _, registration := range registry {
+		registrations = append(registrations, registration)
+	}
+	sort.Slice(registrations, func(i, j int) bool {
+		return registrations[i].Type < registrations[j].Type
+	})
+	return registrations
+}
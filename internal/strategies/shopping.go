@@ -1,56 +1,211 @@
 package strategies
 
 import (
+	"answers-processor/config"
 	websocket "answers-processor/internal/delivery"
 	"answers-processor/internal/domain"
 	"answers-processor/internal/infrastructure/rabbitmq/publisher"
 	"answers-processor/internal/repository"
-	"encoding/json"
+	"answers-processor/pkg/logger"
+	"context"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 )
 
+const orderStatusSoldOut = "sold_out"
+
+// orderKeywords may prefix an order, e.g. "BUY 2 RED".
+var orderKeywords = map[string]bool{"buy": true, "al": true}
+
+func init() {
+	Register(Registration{
+		Type: "shop",
+		New: func(deps Dependencies) (ProcessingStrategy, error) {
+			return NewShopStrategy(deps.Publisher, deps.Broadcaster, &repository.ShopRepository{DB: deps.DB}, ShopOptions{
+				ReservationTTL:   deps.Config.Shop.ReservationTTL,
+				ExpiryInterval:   deps.Config.Shop.ExpiryInterval,
+				MaxOrderQuantity: deps.Config.Shop.MaxOrderQuantity,
+			}, deps.LogInstance), nil
+		},
+		Validate: func(cfg *config.Config) error {
+			if cfg.Shop.ReservationTTL > 0 && cfg.Shop.ExpiryInterval <= 0 {
+				return fmt.Errorf("shop.expiry_interval must be positive when reservations expire")
+			}
+			return nil
+		},
+	})
+}
+
+type ShopOptions struct {
+	ReservationTTL   time.Duration
+	ExpiryInterval   time.Duration
+	MaxOrderQuantity int64
+}
+
 type ShopStrategy struct {
 	publisher   publisher.MessagePublisher
 	broadcaster websocket.Broadcaster
 	repo        *repository.ShopRepository
+	options     ShopOptions
+	logInstance *logger.Loggers
+	ctx         context.Context // cancelled by Stop
+	cancel      context.CancelFunc
 }
 
-func NewShopStrategy(publisher publisher.MessagePublisher, broadcaster websocket.Broadcaster, repo *repository.ShopRepository) ProcessingStrategy {
+func NewShopStrategy(publisher publisher.MessagePublisher, broadcaster websocket.Broadcaster, repo *repository.ShopRepository, options ShopOptions, logInstance *logger.Loggers) ProcessingStrategy {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &ShopStrategy{
 		publisher:   publisher,
 		broadcaster: broadcaster,
 		repo:        repo,
+		options:     options,
+		logInstance: logInstance,
+		ctx:         ctx,
+		cancel:      cancel,
 	}
 }
 
-func (ss *ShopStrategy) Process(clientID int64, message domain.SMSMessage, parsedDate time.Time) error {
+// Start begins releasing expired reservations when reservations are enabled.
+func (ss *ShopStrategy) Start() error {
+	if ss.options.ReservationTTL > 0 && ss.options.ExpiryInterval > 0 {
+		go ss.expireReservations()
+	}
+	return nil
+}
+
+func (ss *ShopStrategy) Stop() {
+	ss.cancel()
+}
+
+func (ss *ShopStrategy) Process(ctx context.Context, clientID int64, message domain.SMSMessage, parsedDate time.Time) error {
 	const customDateFormat = "2006-01-02T15:04:05"
-	lotID, description, err := ss.repo.GetLotDetailsByShortNumber(message.Destination, parsedDate)
+	lotID, description, err := ss.repo.GetLotDetailsByShortNumber(ctx, message.Destination, parsedDate)
 	if err != nil {
 		return fmt.Errorf("Failed to find lot by short number and date: %w", err)
 	}
 
-	err = ss.repo.InsertLotMessageAndUpdate(lotID, message.Text, parsedDate, clientID)
-	if err != nil {
+	quantity, variant, ok := parseOrder(message.Text)
+	if !ok {
+		ss.reply(ctx, message, "Bagyslan, sargyt sany nadogry")
+		return nil
+	}
+	if quantity > ss.options.MaxOrderQuantity && ss.options.MaxOrderQuantity > 0 {
+		ss.reply(ctx, message, fmt.Sprintf("Bir sargytda in kop %d sany sargyt edip bolyar", ss.options.MaxOrderQuantity))
+		return nil
+	}
+
+	order := repository.LotOrder{Quantity: quantity, Variant: variant}
+	if ss.options.ReservationTTL > 0 {
+		order.ExpiresAt = parsedDate.Add(ss.options.ReservationTTL)
+	}
+
+	shoppingMessage := domain.ShoppingMessage{
+		LotID:    lotID,
+		Message:  message.Text,
+		Date:     parsedDate.Format(customDateFormat),
+		Src:      domain.NewSubscriber(message.Source, clientID),
+		Quantity: quantity,
+		Variant:  variant,
+	}
+
+	orderID, err := ss.repo.InsertLotMessageAndUpdate(ctx, lotID, message.Text, parsedDate, clientID, order)
+	var stockErr *repository.OutOfStockError
+	switch {
+	case errors.As(err, &stockErr):
+		if stockErr.Available > 0 {
+			ss.reply(ctx, message, fmt.Sprintf("Bagyslan, dine %d sany galdy", stockErr.Available))
+		} else {
+			ss.reply(ctx, message, "Bagyslan, haryt satylyp gutardy")
+		}
+		shoppingMessage.Status = orderStatusSoldOut
+		ss.broadcast(message.Destination, shoppingMessage)
+		return nil
+	case err != nil:
 		return fmt.Errorf("Failed to insert lot SMS message and update: %w", err)
 	}
 
 	// Send message notification
-	err = ss.publisher.SendMessage(message.Destination, message.Source, description)
+	err = ss.publisher.SendMessage(ctx, message.Destination, message.Source, description)
 	if err != nil {
 		return fmt.Errorf("Failed to send message notification: %w", err)
 	}
 
 	// Broadcast to WebSocket
-	shoppingMessage := domain.ShoppingMessage{
-		LotID:    lotID,
-		ClientID: clientID,
-		Message:  message.Text,
-		Date:     parsedDate.Format(customDateFormat),
-		Src:      message.Source,
+	shoppingMessage.OrderID = orderID
+	shoppingMessage.Status = repository.OrderStatusConfirmed
+	if !order.ExpiresAt.IsZero() {
+		shoppingMessage.Status = repository.OrderStatusReserved
 	}
-	msg, _ := json.MarshalIndent(shoppingMessage, "", "    ")
-	ss.broadcaster.Broadcast(message.Destination, msg)
+	ss.broadcast(message.Destination, shoppingMessage)
 	return nil
 }
+
+// expireReservations periodically releases stock held by reservations that
+// were not confirmed in time and broadcasts their new status.
+func (ss *ShopStrategy) expireReservations() {
+	ticker := time.NewTicker(ss.options.ExpiryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ss.ctx.Done():
+			return
+		}
+
+		now := CurrentDateTime()
+		expired, err := ss.repo.ExpireReservations(ss.ctx, now)
+		if err != nil {
+			ss.logInstance.ErrorLogger.Error("Failed to expire lot reservations", "error", err)
+			continue
+		}
+
+		for _, order := range expired {
+			ss.broadcast(order.ShortNumber, domain.ShoppingMessage{
+				LotID:    order.LotID,
+				Date:     now.Format(customDateFormat),
+				Src:      domain.NewSubscriber(order.Phone, order.ClientID),
+				OrderID:  order.ID,
+				Quantity: order.Quantity,
+				Variant:  order.Variant,
+				Status:   repository.OrderStatusExpired,
+			})
+		}
+	}
+}
+
+func (ss *ShopStrategy) broadcast(destination string, shoppingMessage domain.ShoppingMessage) {
+	ss.broadcaster.Broadcast(destination, shoppingMessage)
+}
+
+func (ss *ShopStrategy) reply(ctx context.Context, message domain.SMSMessage, text string) {
+	if err := ss.publisher.SendMessage(ctx, message.Destination, message.Source, text); err != nil {
+		ss.logInstance.ErrorLogger.Error("Failed to send message notification", "error", err)
+	}
+}
+
+// parseOrder extracts the quantity and optional variant from texts such as
+// "2", "BUY 2 RED" or "RED". Texts without a quantity order a single item;
+// ok is false when the quantity is zero or negative.
+func parseOrder(text string) (quantity int64, variant string, ok bool) {
+	fields := strings.Fields(text)
+	if len(fields) > 0 && orderKeywords[strings.ToLower(fields[0])] {
+		fields = fields[1:]
+	}
+
+	quantity = 1
+	if len(fields) > 0 {
+		if n, err := strconv.ParseInt(fields[0], 10, 64); err == nil {
+			if n <= 0 {
+				return 0, "", false
+			}
+			quantity = n
+			fields = fields[1:]
+		}
+	}
+
+	return quantity, strings.Join(fields, " "), true
+}
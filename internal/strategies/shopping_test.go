@@ -0,0 +1,30 @@
+package strategies
+
+import "testing"
+
+func TestParseOrder(t *testing.T) {
+	tests := []struct {
+		text     string
+		quantity int64
+		variant  string
+		ok       bool
+	}{
+		{"", 1, "", true},
+		{"2", 2, "", true},
+		{"BUY 2 RED", 2, "RED", true},
+		{"al 3 gyzyl uly", 3, "gyzyl uly", true},
+		{"RED", 1, "RED", true},
+		{"buy", 1, "", true},
+		{"0", 0, "", false},
+		{"-2 RED", 0, "", false},
+		{"buy 0", 0, "", false},
+		{"  buy   5  ", 5, "", true},
+	}
+
+	for _, tt := range tests {
+		quantity, variant, ok := parseOrder(tt.text)
+		if quantity != tt.quantity || variant != tt.variant || ok != tt.ok {
+			t.Errorf("parseOrder(%q) = %d, %q, %t; want %d, %q, %t", tt.text, quantity, variant, ok, tt.quantity, tt.variant, tt.ok)
+		}
+	}
+}
@@ -2,9 +2,27 @@ package strategies
 
 import (
 	"answers-processor/internal/domain"
+	"context"
 	"time"
 )
 
+const customDateFormat = "2006-01-02T15:04:05"
+
 type ProcessingStrategy interface {
-	Process(clientID int64, message domain.SMSMessage, parsedDate time.Time) error
+	Process(ctx context.Context, clientID int64, message domain.SMSMessage, parsedDate time.Time) error
+}
+
+var location = time.Local
+
+// SetLocation sets the business timezone returned by CurrentDateTime. It must
+// be called before strategies are started.
+func SetLocation(loc *time.Location) {
+	location = loc
+}
+
+// CurrentDateTime returns the current time in the business timezone, in the
+// same form as dates parsed from incoming SMS messages, for lookups that are
+// not triggered by a message.
+func CurrentDateTime() time.Time {
+	return time.Now().In(location).Truncate(time.Second)
 }
@@ -0,0 +1,141 @@
+package strategies
+
+import (
+	"answers-processor/internal/domain"
+	"answers-processor/internal/infrastructure/rabbitmq/publisher"
+	"answers-processor/internal/repository"
+	"answers-processor/pkg/logger"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	subscribeKeyword   = "start"
+	unsubscribeKeyword = "stop"
+)
+
+func init() {
+	Register(Registration{
+		Type: "subscription",
+		New: func(deps Dependencies) (ProcessingStrategy, error) {
+			return NewSubscriptionStrategy(deps.Publisher, &repository.SubscriptionRepository{DB: deps.DB}, deps.Config.Content.ScheduleInterval, deps.LogInstance), nil
+		},
+	})
+}
+
+// SubscriptionStrategy manages subscriptions to content services:
+// "START <topic>" subscribes, "STOP [topic]" unsubscribes. Scheduled content
+// is pushed to subscribers while the strategy is started.
+type SubscriptionStrategy struct {
+	publisher publisher.MessagePublisher
+	repo      *repository.SubscriptionRepository
+	scheduler *contentScheduler
+}
+
+func NewSubscriptionStrategy(publisher publisher.MessagePublisher, repo *repository.SubscriptionRepository, scheduleInterval time.Duration, logInstance *logger.Loggers) ProcessingStrategy {
+	return &SubscriptionStrategy{
+		publisher: publisher,
+		repo:      repo,
+		scheduler: newContentScheduler(repo, publisher, scheduleInterval, logInstance),
+	}
+}
+
+// Start begins delivering scheduled content.
+func (ss *SubscriptionStrategy) Start() error {
+	go ss.scheduler.run()
+	return nil
+}
+
+func (ss *SubscriptionStrategy) Stop() {
+	ss.scheduler.stop()
+}
+
+func (ss *SubscriptionStrategy) Process(ctx context.Context, clientID int64, message domain.SMSMessage, parsedDate time.Time) error {
+	topics, err := ss.repo.GetTopicsByShortNumber(ctx, message.Destination)
+	if err != nil {
+		return fmt.Errorf("Failed to find subscription topics by short number: %w", err)
+	}
+	if len(topics) == 0 {
+		return fmt.Errorf("No subscription topics for short number %s", message.Destination)
+	}
+
+	fields := strings.Fields(message.Text)
+	if len(fields) == 0 {
+		return ss.send(ctx, message, topicsHelp(topics))
+	}
+	keyword := strings.ToLower(fields[0])
+	code := strings.Join(fields[1:], " ")
+
+	switch keyword {
+	case subscribeKeyword:
+		topic := findTopic(topics, code)
+		if topic == nil {
+			return ss.send(ctx, message, topicsHelp(topics))
+		}
+
+		subscribed, err := ss.repo.Subscribe(ctx, topic.ID, clientID, parsedDate)
+		if err != nil {
+			return fmt.Errorf("Failed to subscribe client: %w", err)
+		}
+		if !subscribed {
+			return ss.send(ctx, message, topic.Name+" hyzmatyna eyyam yazylansynyz")
+		}
+		return ss.send(ctx, message, topic.Name+" hyzmatyna yazyldynyz. Yatyrmak ucin STOP ugradyn")
+	case unsubscribeKeyword:
+		var topicIDs []int64
+		if code == "" {
+			for _, topic := range topics {
+				topicIDs = append(topicIDs, topic.ID)
+			}
+		} else if topic := findTopic(topics, code); topic != nil {
+			topicIDs = append(topicIDs, topic.ID)
+		} else {
+			return ss.send(ctx, message, topicsHelp(topics))
+		}
+
+		cancelled, err := ss.repo.Unsubscribe(ctx, topicIDs, clientID, parsedDate)
+		if err != nil {
+			return fmt.Errorf("Failed to unsubscribe client: %w", err)
+		}
+		if cancelled == 0 {
+			return ss.send(ctx, message, "Siz hic bir hyzmata yazylmadyk")
+		}
+		return ss.send(ctx, message, "Yazylmanyz yatyryldy")
+	default:
+		return ss.send(ctx, message, topicsHelp(topics))
+	}
+}
+
+func (ss *SubscriptionStrategy) send(ctx context.Context, message domain.SMSMessage, text string) error {
+	if err := ss.publisher.SendMessage(ctx, message.Destination, message.Source, text); err != nil {
+		return fmt.Errorf("Failed to send message notification: %w", err)
+	}
+	return nil
+}
+
+// findTopic matches the topic code case-insensitively. An empty code selects
+// the only topic of single-topic services.
+func findTopic(topics []repository.SubscriptionTopic, code string) *repository.SubscriptionTopic {
+	if code == "" {
+		if len(topics) == 1 {
+			return &topics[0]
+		}
+		return nil
+	}
+	for i := range topics {
+		if strings.EqualFold(strings.TrimSpace(topics[i].Code), code) {
+			return &topics[i]
+		}
+	}
+	return nil
+}
+
+func topicsHelp(topics []repository.SubscriptionTopic) string {
+	codes := make([]string, 0, len(topics))
+	for _, topic := range topics {
+		codes = append(codes, "START "+topic.Code)
+	}
+	return "Yazylmak ucin ugradyn: " + strings.Join(codes, ", ")
+}
@@ -0,0 +1,266 @@
+package strategies
+
+import (
+	websocket "answers-processor/internal/delivery"
+	"answers-processor/internal/domain"
+	"answers-processor/internal/infrastructure/rabbitmq/publisher"
+	"answers-processor/internal/repository"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	surveyResultsType     = "survey_results"
+	maxSurveyAnswerLength = 160
+)
+
+func init() {
+	Register(Registration{
+		Type: "survey",
+		New: func(deps Dependencies) (ProcessingStrategy, error) {
+			return NewSurveyStrategy(deps.Publisher, deps.Broadcaster, &repository.SurveyRepository{DB: deps.DB, Replica: deps.Replica}), nil
+		},
+	})
+}
+
+// SurveyStrategy runs multi-step SMS surveys. The first SMS from a client
+// starts a session and is answered with the first question; every following
+// SMS answers the current question and is answered with the next one.
+type SurveyStrategy struct {
+	publisher   publisher.MessagePublisher
+	broadcaster websocket.Broadcaster
+	repo        *repository.SurveyRepository
+}
+
+func NewSurveyStrategy(publisher publisher.MessagePublisher, broadcaster websocket.Broadcaster, repo *repository.SurveyRepository) ProcessingStrategy {
+	return &SurveyStrategy{
+		publisher:   publisher,
+		broadcaster: broadcaster,
+		repo:        repo,
+	}
+}
+
+func (ss *SurveyStrategy) Process(ctx context.Context, clientID int64, message domain.SMSMessage, parsedDate time.Time) error {
+	survey, err := ss.repo.GetSurveyByShortNumber(ctx, message.Destination, parsedDate)
+	if err != nil {
+		return fmt.Errorf("Failed to find survey by short number and date: %w", err)
+	}
+
+	session, err := ss.repo.GetActiveSession(ctx, survey.ID, clientID)
+	if err != nil {
+		return fmt.Errorf("Failed to get survey session: %w", err)
+	}
+
+	// Sessions left idle for too long start over
+	if session != nil && survey.SessionTimeout > 0 && parsedDate.Sub(session.UpdatedAt) > survey.SessionTimeout {
+		if err := ss.repo.ExpireSession(ctx, session.ID); err != nil {
+			return fmt.Errorf("Failed to expire survey session: %w", err)
+		}
+		session = nil
+	}
+
+	if session == nil {
+		// Retakes would count the same client twice in the results
+		if !survey.AllowRetakes {
+			completed, err := ss.repo.HasCompletedSession(ctx, survey.ID, clientID)
+			if err != nil {
+				return fmt.Errorf("Failed to check completed survey sessions: %w", err)
+			}
+			if completed {
+				return ss.send(ctx, message, "Siz bu sorag-jogaba eyyam gatnasdynyz")
+			}
+		}
+
+		session, err = ss.repo.StartSession(ctx, survey.ID, clientID, parsedDate)
+		if err != nil {
+			return fmt.Errorf("Failed to start survey session: %w", err)
+		}
+		return ss.askQuestion(ctx, message, survey.ID, session.CurrentPosition)
+	}
+
+	question, err := ss.repo.GetQuestion(ctx, survey.ID, session.CurrentPosition)
+	if err != nil {
+		return fmt.Errorf("Failed to get survey question: %w", err)
+	}
+	if question == nil {
+		return fmt.Errorf("Survey %d has no question at position %d", survey.ID, session.CurrentPosition)
+	}
+
+	answer, problem := validateSurveyAnswer(question, message.Text)
+	if problem != "" {
+		return ss.send(ctx, message, problem+"\n"+question.Text)
+	}
+
+	next, err := ss.repo.GetQuestion(ctx, survey.ID, session.CurrentPosition+1)
+	if err != nil {
+		return fmt.Errorf("Failed to get survey question: %w", err)
+	}
+
+	saved, err := ss.repo.SaveAnswer(ctx, survey.ID, session, question, clientID, answer, parsedDate, next == nil)
+	if err != nil {
+		return fmt.Errorf("Failed to save survey answer: %w", err)
+	}
+	if !saved {
+		return nil
+	}
+
+	if next != nil {
+		if err := ss.send(ctx, message, next.Text); err != nil {
+			return err
+		}
+	} else if survey.CompletionMessage != "" {
+		if err := ss.send(ctx, message, survey.CompletionMessage); err != nil {
+			return err
+		}
+	}
+
+	resultsMessage, err := ss.results(ctx, survey.ID, parsedDate)
+	if err != nil {
+		return err
+	}
+	ss.broadcaster.Broadcast(message.Destination, resultsMessage)
+	return nil
+}
+
+// Snapshot implements websocket.SnapshotProvider with the aggregated results
+// of the survey active on the destination.
+func (ss *SurveyStrategy) Snapshot(ctx context.Context, destination string) (any, error) {
+	now := CurrentDateTime()
+	survey, err := ss.repo.GetSurveyByShortNumber(ctx, destination, now)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find survey by short number and date: %w", err)
+	}
+	return ss.results(ctx, survey.ID, now)
+}
+
+func (ss *SurveyStrategy) askQuestion(ctx context.Context, message domain.SMSMessage, surveyID int64, position int) error {
+	question, err := ss.repo.GetQuestion(ctx, surveyID, position)
+	if err != nil {
+		return fmt.Errorf("Failed to get survey question: %w", err)
+	}
+	if question == nil {
+		return fmt.Errorf("Survey %d has no question at position %d", surveyID, position)
+	}
+	return ss.send(ctx, message, question.Text)
+}
+
+func (ss *SurveyStrategy) send(ctx context.Context, message domain.SMSMessage, text string) error {
+	if err := ss.publisher.SendMessage(ctx, message.Destination, message.Source, text); err != nil {
+		return fmt.Errorf("Failed to send message notification: %w", err)
+	}
+	return nil
+}
+
+func (ss *SurveyStrategy) results(ctx context.Context, surveyID int64, date time.Time) (*domain.SurveyResultsMessage, error) {
+	questions, err := ss.repo.GetQuestions(ctx, surveyID)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get survey questions: %w", err)
+	}
+	counts, err := ss.repo.GetAnswerCounts(ctx, surveyID)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get survey answer counts: %w", err)
+	}
+	completed, err := ss.repo.GetCompletedSessionCount(ctx, surveyID)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get completed survey count: %w", err)
+	}
+
+	byQuestion := make(map[int64][]repository.SurveyAnswerCount)
+	for _, count := range counts {
+		byQuestion[count.QuestionID] = append(byQuestion[count.QuestionID], count)
+	}
+
+	resultsMessage := &domain.SurveyResultsMessage{
+		Type:      surveyResultsType,
+		SurveyID:  surveyID,
+		Completed: completed,
+		Questions: make([]domain.SurveyQuestionResult, 0, len(questions)),
+		Date:      date.Format(customDateFormat),
+	}
+	for _, question := range questions {
+		result := domain.SurveyQuestionResult{
+			QuestionID: question.ID,
+			Position:   question.Position,
+			Text:       question.Text,
+			AnswerType: question.AnswerType,
+		}
+
+		var sum float64
+		for _, count := range byQuestion[question.ID] {
+			result.Responses += count.Count
+			switch question.AnswerType {
+			case repository.AnswerTypeChoice:
+				if result.Answers == nil {
+					result.Answers = make(map[string]int64)
+				}
+				result.Answers[count.Answer] += count.Count
+			case repository.AnswerTypeNumber:
+				if value, err := strconv.ParseFloat(count.Answer, 64); err == nil {
+					sum += value * float64(count.Count)
+				}
+			}
+		}
+		if question.AnswerType == repository.AnswerTypeNumber && result.Responses > 0 {
+			average := sum / float64(result.Responses)
+			result.Average = &average
+		}
+
+		resultsMessage.Questions = append(resultsMessage.Questions, result)
+	}
+
+	return resultsMessage, nil
+}
+
+// validateSurveyAnswer normalizes the answer for the question type. It returns
+// a non-empty problem text, sent back to the subscriber, when the answer is invalid.
+func validateSurveyAnswer(question *repository.SurveyQuestion, text string) (string, string) {
+	answer := strings.TrimSpace(text)
+	if answer == "" {
+		return "", "Jogap bos bolmaly dal"
+	}
+
+	switch question.AnswerType {
+	case repository.AnswerTypeNumber:
+		value, err := strconv.ParseInt(answer, 10, 64)
+		if err != nil {
+			return "", "Jogaby san bilen iberin"
+		}
+		if question.MinValue.Valid && value < question.MinValue.Int64 || question.MaxValue.Valid && value > question.MaxValue.Int64 {
+			return "", rangeProblem(question.MinValue, question.MaxValue)
+		}
+		return strconv.FormatInt(value, 10), ""
+	case repository.AnswerTypeChoice:
+		for _, choice := range strings.Split(question.Choices, ",") {
+			choice = strings.TrimSpace(choice)
+			if choice != "" && strings.EqualFold(choice, answer) {
+				return choice, ""
+			}
+		}
+		return "", "Jogap su wariantlardan biri bolmaly: " + question.Choices
+	default:
+		if len([]rune(answer)) > maxSurveyAnswerLength {
+			return "", fmt.Sprintf("Jogap %d harpdan uzyn bolmaly dal", maxSurveyAnswerLength)
+		}
+		return answer, ""
+	}
+}
+
+// rangeProblem describes the allowed range using only the bounds that are set.
+func rangeProblem(minValue, maxValue sql.NullInt64) string {
+	switch {
+	case minValue.Valid && maxValue.Valid:
+		return fmt.Sprintf("Jogap %d bilen %d aralygynda bolmaly", minValue.Int64, maxValue.Int64)
+	case minValue.Valid:
+		return fmt.Sprintf("Jogap %d-dan kici bolmaly dal", minValue.Int64)
+	default:
+		return fmt.Sprintf("Jogap %d-dan uly bolmaly dal", maxValue.Int64)
+	}
+}
@@ -0,0 +1,50 @@
+package strategies
+
+import (
+	"answers-processor/internal/repository"
+	"database/sql"
+	"strings"
+	"testing"
+)
+
+func TestValidateSurveyAnswer(t *testing.T) {
+	bound := func(value int64) sql.NullInt64 { return sql.NullInt64{Int64: value, Valid: true} }
+	number := func(min, max sql.NullInt64) *repository.SurveyQuestion {
+		return &repository.SurveyQuestion{AnswerType: repository.AnswerTypeNumber, MinValue: min, MaxValue: max}
+	}
+	choice := &repository.SurveyQuestion{AnswerType: repository.AnswerTypeChoice, Choices: "Hawa, Yok"}
+	text := &repository.SurveyQuestion{AnswerType: repository.AnswerTypeText}
+
+	tests := []struct {
+		name     string
+		question *repository.SurveyQuestion
+		text     string
+		answer   string
+		problem  string // expected substring of the problem, empty when valid
+	}{
+		{"empty", text, "   ", "", "bos"},
+		{"text", text, " salam ", "salam", ""},
+		{"long text", text, strings.Repeat("a", maxSurveyAnswerLength+1), "", "harpdan"},
+		{"number", number(bound(1), bound(10)), "7", "7", ""},
+		{"not a number", number(bound(1), bound(10)), "yedi", "", "san"},
+		{"between bounds", number(bound(1), bound(10)), "11", "", "1 bilen 10 aralygynda"},
+		{"min only", number(bound(5), sql.NullInt64{}), "3", "", "5-dan kici"},
+		{"min only valid", number(bound(5), sql.NullInt64{}), "300", "300", ""},
+		{"max only", number(sql.NullInt64{}, bound(5)), "6", "", "5-dan uly"},
+		{"max only negative", number(sql.NullInt64{}, bound(5)), "-6", "-6", ""},
+		{"choice", choice, "hawa", "Hawa", ""},
+		{"unknown choice", choice, "belki", "", "wariantlardan"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			answer, problem := validateSurveyAnswer(tt.question, tt.text)
+			if answer != tt.answer {
+				t.Errorf("answer = %q, want %q", answer, tt.answer)
+			}
+			if tt.problem == "" && problem != "" || !strings.Contains(problem, tt.problem) {
+				t.Errorf("problem = %q, want it to contain %q", problem, tt.problem)
+			}
+		})
+	}
+}
@@ -1,71 +1,168 @@
 package strategies
 
 import (
+	"answers-processor/internal/campaigns"
 	websocket "answers-processor/internal/delivery"
 	"answers-processor/internal/domain"
 	"answers-processor/internal/infrastructure/rabbitmq/publisher"
 	"answers-processor/internal/repository"
-	"encoding/json"
+	"answers-processor/pkg/logger"
+	"context"
 	"fmt"
 	"log"
 	"time"
 )
 
+func init() {
+	Register(Registration{
+		Type: "voting",
+		New: func(deps Dependencies) (ProcessingStrategy, error) {
+			return NewVoteStrategy(deps.Publisher, deps.Broadcaster, &repository.VotingRepository{DB: deps.DB, Replica: deps.Replica}, deps.Campaigns, VotingOptions{
+				ResultsInterval: deps.Config.Voting.ResultsInterval,
+				BatchWindow:     deps.Config.Voting.BatchWindow,
+				BatchSize:       deps.Config.Voting.BatchSize,
+			}, deps.LogInstance), nil
+		},
+	})
+}
+
+// VotingOptions configure result broadcasts and batched vote writes. With a
+// zero BatchWindow every vote is written in its own transaction.
+type VotingOptions struct {
+	ResultsInterval time.Duration
+	BatchWindow     time.Duration
+	BatchSize       int
+}
+
 type VoteStrategy struct {
 	publisher   publisher.MessagePublisher
 	broadcaster websocket.Broadcaster
 	repo        *repository.VotingRepository
+	campaigns   *campaigns.Cache
+	results     *votingResults
+	batcher     *voteBatcher // nil unless votes are batched
 }
 
-func NewVoteStrategy(publisher publisher.MessagePublisher, broadcaster websocket.Broadcaster, repo *repository.VotingRepository) ProcessingStrategy {
-	return &VoteStrategy{
+func NewVoteStrategy(publisher publisher.MessagePublisher, broadcaster websocket.Broadcaster, repo *repository.VotingRepository, campaigns *campaigns.Cache, options VotingOptions, logInstance *logger.Loggers) ProcessingStrategy {
+	vs := &VoteStrategy{
 		publisher:   publisher,
 		broadcaster: broadcaster,
 		repo:        repo,
+		campaigns:   campaigns,
+		results:     newVotingResults(repo, broadcaster, options.ResultsInterval, logInstance),
 	}
+	if options.BatchWindow > 0 {
+		vs.batcher = newVoteBatcher(repo, vs.results, options.BatchWindow, options.BatchSize, logInstance)
+	}
+	return vs
 }
 
-func (vs *VoteStrategy) Process(clientID int64, message domain.SMSMessage, parsedDate time.Time) error {
-	const customDateFormat = "2006-01-02T15:04:05"
-	votingID, status, err := vs.repo.GetVotingDetails(message.Destination, parsedDate)
-	if err != nil {
-		return fmt.Errorf("Failed to find voting by short number and date: %w", err)
+// Start begins the periodic results broadcast and the batched vote writer.
+func (vs *VoteStrategy) Start() error {
+	go vs.results.run()
+	if vs.batcher != nil {
+		go vs.batcher.run()
 	}
+	return nil
+}
 
-	votingItemID, votingItemTitle, err := vs.repo.GetVotingItemDetails(votingID, message.Text)
-	if err != nil {
-		return fmt.Errorf("Failed to find voting item by vote code: %w", err)
+// Stop writes buffered votes before stopping the results broadcast.
+func (vs *VoteStrategy) Stop() {
+	if vs.batcher != nil {
+		vs.batcher.stop()
 	}
+	vs.results.stop()
+}
 
-	hasVoted, err := vs.repo.HasClientVoted(votingID, clientID, status, parsedDate)
+// Snapshot implements websocket.SnapshotProvider with the current results of
+// the voting active on the destination.
+func (vs *VoteStrategy) Snapshot(ctx context.Context, destination string) (any, error) {
+	return vs.results.snapshot(ctx, destination)
+}
+
+func (vs *VoteStrategy) Process(ctx context.Context, clientID int64, message domain.SMSMessage, parsedDate time.Time) error {
+	voting, err := vs.campaigns.Voting(ctx, message.Destination, parsedDate)
 	if err != nil {
-		return fmt.Errorf("Failed to check if client has voted: %w", err)
-	} else if hasVoted {
-		log.Printf("client has already Voted")
-		return nil
+		return fmt.Errorf("Failed to find voting by short number and date: %w", err)
 	}
+	votingID, status := voting.ID, voting.Status
 
-	err = vs.repo.InsertVotingMessageAndUpdateCount(votingID, votingItemID, message.Text, parsedDate, clientID)
-	if err != nil {
-		return fmt.Errorf("Failed to insert voting message and update count: %w", err)
+	item, ok := voting.FindItem(message.Text)
+	if !ok {
+		return fmt.Errorf("Failed to find voting item by vote code: %q", message.Text)
 	}
+	votingItemID, votingItemTitle := item.ID, item.Title
 
 	smsText := votingItemTitle + " ucin beren sesiniz kabul edildi"
-	err = vs.publisher.SendMessage(message.Destination, message.Source, smsText)
+
+	if status == "last" {
+		// Last vote wins: a later SMS replaces the client's earlier vote
+		previousItemID, err := vs.repo.ChangeClientVote(ctx, votingID, votingItemID, message.Text, parsedDate, clientID)
+		if err != nil {
+			return fmt.Errorf("Failed to change client vote: %w", err)
+		}
+
+		if previousItemID == votingItemID {
+			smsText = votingItemTitle + " ucin beren sesiniz eyyam kabul edildi"
+			if err := vs.publisher.SendMessage(ctx, message.Destination, message.Source, smsText); err != nil {
+				log.Printf("Failed to send message notification: %v", err)
+			}
+			return nil
+		}
+
+		if previousItemID != 0 {
+			previousTitle, err := vs.repo.GetVotingItemTitle(ctx, previousItemID)
+			if err != nil {
+				return fmt.Errorf("Failed to find previous voting item: %w", err)
+			}
+			smsText = previousTitle + " ucin beren sesiniz " + votingItemTitle + " ucin uytgedildi"
+		}
+	} else if vs.batcher != nil {
+		// The confirmation waits for the batch to be written
+		vote := repository.Vote{VotingID: votingID, VotingItemID: votingItemID, Message: message.Text, Date: parsedDate, ClientID: clientID}
+		accepted, err := vs.batcher.accept(ctx, vote, status, message.Destination, func(ctx context.Context) {
+			vs.confirmVote(ctx, message, smsText, votingID, votingItemID, parsedDate)
+		})
+		if err != nil {
+			return fmt.Errorf("Failed to check if client has voted: %w", err)
+		} else if !accepted {
+			log.Printf("client has already Voted")
+		}
+		return nil
+	} else {
+		hasVoted, err := vs.repo.HasClientVoted(ctx, votingID, clientID, status, parsedDate)
+		if err != nil {
+			return fmt.Errorf("Failed to check if client has voted: %w", err)
+		} else if hasVoted {
+			log.Printf("client has already Voted")
+			return nil
+		}
+
+		err = vs.repo.InsertVotingMessageAndUpdateCount(ctx, votingID, votingItemID, message.Text, parsedDate, clientID)
+		if err != nil {
+			return fmt.Errorf("Failed to insert voting message and update count: %w", err)
+		}
+	}
+
+	vs.confirmVote(ctx, message, smsText, votingID, votingItemID, parsedDate)
+	return nil
+
+}
+
+// confirmVote replies to the voter and broadcasts a vote that has been written.
+func (vs *VoteStrategy) confirmVote(ctx context.Context, message domain.SMSMessage, smsText string, votingID, votingItemID int64, parsedDate time.Time) {
+	const customDateFormat = "2006-01-02T15:04:05"
+	err := vs.publisher.SendMessage(ctx, message.Destination, message.Source, smsText)
 	if err != nil {
-		log.Printf("Failed to send message notification: %w", err)
+		log.Printf("Failed to send message notification: %v", err)
 	}
 
 	votingMessage := domain.VotingMessage{
 		VotingID:     votingID,
 		VotingItemID: votingItemID,
-		ClientID:     clientID,
 		Message:      message.Text,
 		Date:         parsedDate.Format(customDateFormat),
 	}
-	msg, _ := json.MarshalIndent(votingMessage, "", "    ")
-	vs.broadcaster.Broadcast(message.Destination, msg)
-
-	return nil
-
+	vs.broadcaster.Broadcast(message.Destination, votingMessage)
+	vs.results.markDirty(votingID, message.Destination)
 }
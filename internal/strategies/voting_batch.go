@@ -0,0 +1,271 @@
+package strategies
+
+import (
+	"answers-processor/internal/repository"
+	db "answers-processor/pkg/database"
+	"answers-processor/pkg/logger"
+	"context"
+	"sync"
+	"time"
+)
+
+// voteKey identifies what a vote limit counts: one vote per client and voting,
+// or per client, voting and day for daily votings.
+type voteKey struct {
+	votingID int64
+	clientID int64
+	day      string
+}
+
+// voteConfirmTimeout bounds the replies and broadcasts of one written batch,
+// so that an unreachable broker cannot hold up stop.
+const voteConfirmTimeout = 30 * time.Second
+
+// bufferedVote is an accepted vote waiting to be written.
+type bufferedVote struct {
+	vote        repository.Vote
+	key         voteKey
+	limited     bool
+	destination string
+	confirm     func(context.Context) // run once the vote is written
+}
+
+// voteBatcher buffers accepted votes for a short window and writes them in
+// one transaction, so popular items are not updated once per vote during
+// finales. While a vote is buffered its client is reserved, which lets limit
+// checks see votes that have not reached the database yet. A vote is confirmed
+// only once it is written, but its message is acknowledged when the vote is
+// buffered: votes that fail for a reason a retry may fix stay buffered for the
+// next flush, and votes still buffered when the process dies are lost, while
+// Stop writes them.
+type voteBatcher struct {
+	repo        *repository.VotingRepository
+	results     *votingResults
+	logInstance *logger.Loggers
+	window      time.Duration
+	size        int
+
+	mu       sync.Mutex
+	pending  []bufferedVote
+	reserved map[voteKey]bool
+	full     chan struct{}
+
+	confirming sync.WaitGroup  // confirmations of written batches
+	ctx        context.Context // cancelled by stop
+	cancel     context.CancelFunc
+	done       chan struct{}
+}
+
+func newVoteBatcher(repo *repository.VotingRepository, results *votingResults, window time.Duration, size int, logInstance *logger.Loggers) *voteBatcher {
+	if size <= 0 {
+		size = 500
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &voteBatcher{
+		repo:        repo,
+		results:     results,
+		logInstance: logInstance,
+		window:      window,
+		size:        size,
+		reserved:    make(map[voteKey]bool),
+		full:        make(chan struct{}, 1),
+		ctx:         ctx,
+		cancel:      cancel,
+		done:        make(chan struct{}),
+	}
+}
+
+// newVoteKey returns the key the voting's limit counts the vote under. Daily
+// votings count per day in the business timezone, whatever the location of
+// the vote's date.
+func newVoteKey(vote repository.Vote, status string) voteKey {
+	key := voteKey{votingID: vote.VotingID, clientID: vote.ClientID}
+	if status == "daily" {
+		key.day = vote.Date.In(location).Format(time.DateOnly)
+	}
+	return key
+}
+
+// accept applies the voting's limit and buffers the vote. It reports false
+// when the client has already voted, either in the database or in a vote that
+// is still buffered. confirm runs after the vote is written, and not at all
+// if writing it fails for good.
+func (vb *voteBatcher) accept(ctx context.Context, vote repository.Vote, status, destination string, confirm func(context.Context)) (bool, error) {
+	buffered := bufferedVote{
+		vote:        vote,
+		key:         newVoteKey(vote, status),
+		limited:     status != "unlimited",
+		destination: destination,
+		confirm:     confirm,
+	}
+
+	if buffered.limited {
+		vb.mu.Lock()
+		if vb.reserved[buffered.key] {
+			vb.mu.Unlock()
+			return false, nil
+		}
+		vb.reserved[buffered.key] = true
+		vb.mu.Unlock()
+
+		hasVoted, err := vb.repo.HasClientVoted(ctx, vote.VotingID, vote.ClientID, status, vote.Date.In(location))
+		if err != nil || hasVoted {
+			vb.release(buffered.key)
+			return false, db.Retryable(err)
+		}
+	}
+
+	vb.mu.Lock()
+	vb.pending = append(vb.pending, buffered)
+	full := len(vb.pending) >= vb.size
+	vb.mu.Unlock()
+
+	if full {
+		select {
+		case vb.full <- struct{}{}:
+		default:
+		}
+	}
+	return true, nil
+}
+
+func (vb *voteBatcher) release(key voteKey) {
+	vb.mu.Lock()
+	delete(vb.reserved, key)
+	vb.mu.Unlock()
+}
+
+func (vb *voteBatcher) run() {
+	defer close(vb.done)
+
+	ticker := time.NewTicker(vb.window)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			vb.flush()
+		case <-vb.full:
+			vb.flush()
+		case <-vb.ctx.Done():
+			vb.flush()
+			vb.mu.Lock()
+			lost := len(vb.pending)
+			vb.mu.Unlock()
+			if lost > 0 {
+				vb.logInstance.ErrorLogger.Error("Votes could not be written before stopping", "votes", lost)
+			}
+			return
+		}
+	}
+}
+
+// stop writes the remaining votes and waits for the writer and the
+// confirmations to finish.
+func (vb *voteBatcher) stop() {
+	vb.cancel()
+	<-vb.done
+	vb.confirming.Wait()
+}
+
+func (vb *voteBatcher) flush() {
+	vb.mu.Lock()
+	batch := vb.pending
+	vb.pending = nil
+	vb.mu.Unlock()
+
+	if len(batch) == 0 {
+		return
+	}
+
+	// The batch is written even while stopping; queries are still bounded by
+	// the query timeout
+	written, retry := vb.write(context.WithoutCancel(vb.ctx), batch)
+
+	// Written votes are visible to HasClientVoted from now on. Votes to retry
+	// keep their reservation and go back to the front of the buffer
+	var confirms []func(context.Context)
+	var kept []bufferedVote
+	destinations := make(map[int64]string)
+	vb.mu.Lock()
+	for i, buffered := range batch {
+		if retry[i] {
+			kept = append(kept, buffered)
+			continue
+		}
+		if buffered.limited {
+			delete(vb.reserved, buffered.key)
+		}
+		if written[i] {
+			destinations[buffered.vote.VotingID] = buffered.destination
+			if buffered.confirm != nil {
+				confirms = append(confirms, buffered.confirm)
+			}
+		}
+	}
+	vb.pending = append(kept, vb.pending...)
+	vb.mu.Unlock()
+
+	for votingID, destination := range destinations {
+		vb.results.markDirty(votingID, destination)
+	}
+
+	if len(confirms) > 0 {
+		vb.confirming.Add(1)
+		go vb.confirm(confirms)
+	}
+}
+
+// write stores the batch in one transaction. When that fails for a reason
+// other than the database being unavailable, the votes are written one by
+// one so that a single bad vote does not hold up the others. It reports which
+// votes were written and which failed for a reason a retry may fix.
+func (vb *voteBatcher) write(ctx context.Context, batch []bufferedVote) (written, retry []bool) {
+	written = make([]bool, len(batch))
+	retry = make([]bool, len(batch))
+
+	votes := make([]repository.Vote, len(batch))
+	for i, buffered := range batch {
+		votes[i] = buffered.vote
+	}
+
+	err := vb.repo.InsertVotes(ctx, votes)
+	switch {
+	case err == nil:
+		for i := range written {
+			written[i] = true
+		}
+		return written, retry
+	case db.IsTransient(err):
+		vb.logInstance.ErrorLogger.Error("Failed to write vote batch, retrying on the next flush", "votes", len(votes), "error", err)
+		for i := range retry {
+			retry[i] = true
+		}
+		return written, retry
+	}
+
+	vb.logInstance.ErrorLogger.Error("Failed to write vote batch, writing votes one by one", "votes", len(votes), "error", err)
+	for i, vote := range votes {
+		err := vb.repo.InsertVotingMessageAndUpdateCount(ctx, vote.VotingID, vote.VotingItemID, vote.Message, vote.Date, vote.ClientID)
+		switch {
+		case err == nil:
+			written[i] = true
+		case db.IsTransient(err):
+			retry[i] = true
+		default:
+			vb.logInstance.ErrorLogger.Error("Failed to insert voting message and update count", "voting_id", vote.VotingID, "client_id", vote.ClientID, "error", err)
+		}
+	}
+	return written, retry
+}
+
+// confirm runs the confirmations of a written batch off the writer goroutine.
+func (vb *voteBatcher) confirm(confirms []func(context.Context)) {
+	defer vb.confirming.Done()
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(vb.ctx), voteConfirmTimeout)
+	defer cancel()
+	for _, confirm := range confirms {
+		confirm(ctx)
+	}
+}
@@ -0,0 +1,242 @@
+package strategies
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"answers-processor/internal/repository"
+	db "answers-processor/pkg/database"
+	"answers-processor/pkg/logger"
+
+	_ "modernc.org/sqlite"
+)
+
+// The business timezone of the tests, five hours ahead of UTC like Ashgabat.
+var businessLocation = time.FixedZone("TMT", 5*60*60)
+
+const votingSchema = `
+CREATE TABLE voting_items (
+    id INTEGER PRIMARY KEY, voting_id INTEGER NOT NULL, title TEXT NOT NULL,
+    vote_code TEXT NOT NULL, votes_count INTEGER NOT NULL DEFAULT 0
+);
+CREATE TABLE voting_sms_messages (
+    id INTEGER PRIMARY KEY, voting_id INTEGER, voting_item_id INTEGER, msg TEXT, dt DATETIME, client_id INTEGER
+);
+INSERT INTO voting_items (id, voting_id, title, vote_code) VALUES (1, 1, 'Aydym', '1');
+`
+
+// newTestBatcher returns a batcher writing to a fresh SQLite database. The
+// writer goroutine is not started; tests flush by hand.
+func newTestBatcher(t *testing.T) (*voteBatcher, *sql.DB, *logger.Loggers) {
+	t.Helper()
+
+	logInstance, err := logger.SetupLogger("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repository.Init(logInstance, 0, db.Dialects["sqlite"])
+	previousLocation := location
+	SetLocation(businessLocation)
+	t.Cleanup(func() {
+		repository.Init(nil, 0, db.Dialects["mysql"])
+		SetLocation(previousLocation)
+	})
+
+	database, err := db.Dialects["sqlite"].Open("sqlite", filepath.Join(t.TempDir(), "test.db"), businessLocation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if _, err := database.Exec(votingSchema); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := &repository.VotingRepository{DB: database}
+	results := newVotingResults(repo, nil, time.Hour, logInstance)
+	return newVoteBatcher(repo, results, time.Hour, 100, logInstance), database, logInstance
+}
+
+func testVote(clientID int64, date time.Time) repository.Vote {
+	return repository.Vote{VotingID: 1, VotingItemID: 1, Message: "1", Date: date, ClientID: clientID}
+}
+
+func TestNewVoteKey(t *testing.T) {
+	previousLocation := location
+	SetLocation(businessLocation)
+	defer SetLocation(previousLocation)
+
+	tests := []struct {
+		name   string
+		date   time.Time
+		status string
+		want   string
+	}{
+		{"business morning", time.Date(2024, time.March, 16, 2, 0, 0, 0, businessLocation), "daily", "2024-03-16"},
+		{"UTC evening of the previous day", time.Date(2024, time.March, 15, 21, 0, 0, 0, time.UTC), "daily", "2024-03-16"},
+		{"UTC morning", time.Date(2024, time.March, 15, 18, 59, 0, 0, time.UTC), "daily", "2024-03-15"},
+		{"one vote per voting", time.Date(2024, time.March, 15, 21, 0, 0, 0, time.UTC), "one", ""},
+	}
+
+	for _, tt := range tests {
+		if got := newVoteKey(testVote(7, tt.date), tt.status); got.day != tt.want {
+			t.Errorf("%s: day = %q; want %q", tt.name, got.day, tt.want)
+		}
+	}
+}
+
+func TestVoteBatcherReservations(t *testing.T) {
+	vb, database, _ := newTestBatcher(t)
+	ctx := context.Background()
+	now := time.Date(2024, time.March, 15, 12, 0, 0, 0, businessLocation)
+
+	var confirmed atomic.Int32
+	confirm := func(context.Context) { confirmed.Add(1) }
+
+	if accepted, err := vb.accept(ctx, testVote(7, now), "one", "0456", confirm); err != nil || !accepted {
+		t.Fatalf("first vote: accept = %v, %v; want accepted", accepted, err)
+	}
+	// Not written yet, but the client is reserved
+	if accepted, err := vb.accept(ctx, testVote(7, now), "one", "0456", confirm); err != nil || accepted {
+		t.Fatalf("vote while buffered: accept = %v, %v; want rejected", accepted, err)
+	}
+	if accepted, err := vb.accept(ctx, testVote(8, now), "one", "0456", confirm); err != nil || !accepted {
+		t.Fatalf("other client: accept = %v, %v; want accepted", accepted, err)
+	}
+
+	vb.flush()
+	vb.confirming.Wait()
+	if len(vb.reserved) != 0 || len(vb.pending) != 0 {
+		t.Errorf("after the write: reserved = %v, pending = %d; want none", vb.reserved, len(vb.pending))
+	}
+	if confirmed.Load() != 2 {
+		t.Errorf("confirmed %d votes; want 2", confirmed.Load())
+	}
+
+	// The written vote is found in the database
+	if accepted, err := vb.accept(ctx, testVote(7, now), "one", "0456", confirm); err != nil || accepted {
+		t.Fatalf("vote after the write: accept = %v, %v; want rejected", accepted, err)
+	}
+	if len(vb.reserved) != 0 {
+		t.Errorf("a rejected vote left reservations %v", vb.reserved)
+	}
+
+	var count int64
+	if err := database.QueryRow("SELECT votes_count FROM voting_items WHERE id = 1").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("votes_count = %d; want 2", count)
+	}
+}
+
+func TestVoteBatcherDailyReservations(t *testing.T) {
+	vb, _, _ := newTestBatcher(t)
+	ctx := context.Background()
+
+	// 21:00 UTC on the 15th is already the 16th in the business timezone
+	tests := []struct {
+		name string
+		date time.Time
+		want bool
+	}{
+		{"first vote", time.Date(2024, time.March, 15, 21, 0, 0, 0, time.UTC), true},
+		{"same business day", time.Date(2024, time.March, 16, 10, 0, 0, 0, businessLocation), false},
+		{"previous business day", time.Date(2024, time.March, 15, 10, 0, 0, 0, businessLocation), true},
+	}
+
+	for _, tt := range tests {
+		accepted, err := vb.accept(ctx, testVote(7, tt.date), "daily", "0456", nil)
+		if err != nil || accepted != tt.want {
+			t.Errorf("%s: accept = %v, %v; want %v", tt.name, accepted, err, tt.want)
+		}
+	}
+
+	// The same holds once the votes are written
+	vb.flush()
+	for _, tt := range tests[1:] {
+		if accepted, err := vb.accept(ctx, testVote(7, tt.date), "daily", "0456", nil); err != nil || accepted {
+			t.Errorf("%s after the write: accept = %v, %v; want rejected", tt.name, accepted, err)
+		}
+	}
+}
+
+func TestVoteBatcherFailedWrites(t *testing.T) {
+	vb, database, logInstance := newTestBatcher(t)
+	ctx := context.Background()
+	now := time.Date(2024, time.March, 15, 12, 0, 0, 0, businessLocation)
+
+	var confirmed atomic.Int32
+	confirm := func(context.Context) { confirmed.Add(1) }
+	if accepted, err := vb.accept(ctx, testVote(7, now), "one", "0456", confirm); err != nil || !accepted {
+		t.Fatalf("accept = %v, %v; want accepted", accepted, err)
+	}
+
+	// A timed-out write may succeed on retry: the vote stays buffered and
+	// its client reserved
+	repository.Init(logInstance, time.Nanosecond, db.Dialects["sqlite"])
+	vb.flush()
+	repository.Init(logInstance, 0, db.Dialects["sqlite"])
+	vb.confirming.Wait()
+	if len(vb.pending) != 1 || !vb.reserved[newVoteKey(testVote(7, now), "one")] || confirmed.Load() != 0 {
+		t.Fatalf("after a timed-out write: pending = %d, reserved = %v, confirmed = %d; want the vote kept", len(vb.pending), vb.reserved, confirmed.Load())
+	}
+
+	vb.flush()
+	vb.confirming.Wait()
+	if len(vb.pending) != 0 || len(vb.reserved) != 0 || confirmed.Load() != 1 {
+		t.Fatalf("after the retry: pending = %d, reserved = %v, confirmed = %d; want the vote written", len(vb.pending), vb.reserved, confirmed.Load())
+	}
+
+	// A write that cannot succeed drops the vote and releases its client
+	if accepted, err := vb.accept(ctx, testVote(8, now), "one", "0456", confirm); err != nil || !accepted {
+		t.Fatalf("accept = %v, %v; want accepted", accepted, err)
+	}
+	if _, err := database.Exec("DROP TABLE voting_items"); err != nil {
+		t.Fatal(err)
+	}
+	vb.flush()
+	vb.confirming.Wait()
+	if len(vb.pending) != 0 || len(vb.reserved) != 0 || confirmed.Load() != 1 {
+		t.Fatalf("after a failed write: pending = %d, reserved = %v, confirmed = %d; want the vote dropped", len(vb.pending), vb.reserved, confirmed.Load())
+	}
+}
+
+// Confirmations run off the writer and are bounded, so a confirmation that
+// blocks until its context is done does not hold up flush or stop forever.
+func TestVoteBatcherConfirmOffWriter(t *testing.T) {
+	vb, _, _ := newTestBatcher(t)
+	ctx := context.Background()
+	now := time.Date(2024, time.March, 15, 12, 0, 0, 0, businessLocation)
+
+	release := make(chan struct{})
+	confirmed := make(chan bool, 1)
+	confirm := func(ctx context.Context) {
+		_, hasDeadline := ctx.Deadline()
+		<-release
+		confirmed <- hasDeadline
+	}
+	if accepted, err := vb.accept(ctx, testVote(7, now), "one", "0456", confirm); err != nil || !accepted {
+		t.Fatalf("accept = %v, %v; want accepted", accepted, err)
+	}
+
+	flushed := make(chan struct{})
+	go func() {
+		vb.flush()
+		close(flushed)
+	}()
+	select {
+	case <-flushed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("flush waited for the confirmation")
+	}
+
+	close(release)
+	if hasDeadline := <-confirmed; !hasDeadline {
+		t.Error("confirmation context has no deadline")
+	}
+	vb.confirming.Wait()
+}
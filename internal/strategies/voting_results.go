@@ -0,0 +1,141 @@
+package strategies
+
+import (
+	websocket "answers-processor/internal/delivery"
+	"answers-processor/internal/domain"
+	"answers-processor/internal/repository"
+	"answers-processor/pkg/logger"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+const votingResultsType = "voting_results"
+
+// votingResults periodically broadcasts aggregated totals for votings that
+// received votes since the last tick, so studio graphics never have to count
+// individual votes themselves.
+type votingResults struct {
+	repo        *repository.VotingRepository
+	broadcaster websocket.Broadcaster
+	logInstance *logger.Loggers
+	interval    time.Duration
+
+	mu     sync.Mutex
+	dirty  map[int64]string // voting ID -> destination
+	ctx    context.Context  // cancelled by stop
+	cancel context.CancelFunc
+}
+
+func newVotingResults(repo *repository.VotingRepository, broadcaster websocket.Broadcaster, interval time.Duration, logInstance *logger.Loggers) *votingResults {
+	if interval <= 0 {
+		interval = 500 * time.Millisecond
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &votingResults{
+		repo:        repo,
+		broadcaster: broadcaster,
+		logInstance: logInstance,
+		interval:    interval,
+		dirty:       make(map[int64]string),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+}
+
+// markDirty schedules a results broadcast for the voting on the next tick.
+func (vr *votingResults) markDirty(votingID int64, destination string) {
+	vr.mu.Lock()
+	vr.dirty[votingID] = destination
+	vr.mu.Unlock()
+}
+
+func (vr *votingResults) run() {
+	ticker := time.NewTicker(vr.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			vr.flush()
+		case <-vr.ctx.Done():
+			return
+		}
+	}
+}
+
+func (vr *votingResults) stop() {
+	vr.cancel()
+}
+
+func (vr *votingResults) flush() {
+	vr.mu.Lock()
+	if len(vr.dirty) == 0 {
+		vr.mu.Unlock()
+		return
+	}
+	pending := vr.dirty
+	vr.dirty = make(map[int64]string)
+	vr.mu.Unlock()
+
+	for votingID, destination := range pending {
+		resultsMessage, err := vr.build(vr.ctx, votingID)
+		if err != nil {
+			vr.logInstance.ErrorLogger.Error("Failed to build voting results", "voting_id", votingID, "error", err)
+			continue
+		}
+		vr.broadcaster.Broadcast(destination, resultsMessage)
+	}
+}
+
+func (vr *votingResults) build(ctx context.Context, votingID int64) (*domain.VotingResultsMessage, error) {
+	items, err := vr.repo.GetVotingResults(ctx, votingID)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get voting results: %w", err)
+	}
+
+	var total int64
+	for _, item := range items {
+		total += item.VotesCount
+	}
+
+	resultsMessage := domain.VotingResultsMessage{
+		Type:       votingResultsType,
+		VotingID:   votingID,
+		TotalVotes: total,
+		Items:      make([]domain.VotingItemResult, 0, len(items)),
+		Date:       CurrentDateTime().Format(customDateFormat),
+	}
+	for _, item := range items {
+		var percentage float64
+		if total > 0 {
+			percentage = math.Round(float64(item.VotesCount)*10000/float64(total)) / 100
+		}
+		resultsMessage.Items = append(resultsMessage.Items, domain.VotingItemResult{
+			VotingItemID: item.ID,
+			Title:        item.Title,
+			VoteCode:     item.VoteCode,
+			VotesCount:   item.VotesCount,
+			Percentage:   percentage,
+		})
+	}
+
+	return &resultsMessage, nil
+}
+
+// snapshot returns the current results for the voting active on destination,
+// or nil when there is none.
+func (vr *votingResults) snapshot(ctx context.Context, destination string) (any, error) {
+	votingID, _, err := vr.repo.GetVotingDetails(ctx, destination, CurrentDateTime())
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find voting by short number and date: %w", err)
+	}
+	return vr.build(ctx, votingID)
+}
@@ -0,0 +1,95 @@
+package strategies
+
+import (
+	"answers-processor/config"
+	"answers-processor/internal/domain"
+	"answers-processor/internal/infrastructure/rabbitmq/publisher"
+	"answers-processor/internal/repository"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const profanityReason = "profanity"
+
+func init() {
+	Register(Registration{
+		Type: "wall",
+		New: func(deps Dependencies) (ProcessingStrategy, error) {
+			return NewWallStrategy(deps.Publisher, &repository.WallRepository{DB: deps.DB}, deps.Config.Wall.BlockedWords, deps.Config.Wall.Reply), nil
+		},
+	})
+}
+
+// WallStrategy queues audience messages for moderation. Nothing is shown on
+// air until an operator approves the message through the admin API.
+type WallStrategy struct {
+	publisher    publisher.MessagePublisher
+	repo         *repository.WallRepository
+	blockedWords map[string]bool
+	reply        string
+}
+
+func NewWallStrategy(publisher publisher.MessagePublisher, repo *repository.WallRepository, blockedWords []string, reply string) ProcessingStrategy {
+	return &WallStrategy{
+		publisher:    publisher,
+		repo:         repo,
+		blockedWords: wordSet(blockedWords),
+		reply:        reply,
+	}
+}
+
+// Reconfigure applies reloaded blocked words and reply.
+func (ws *WallStrategy) Reconfigure(cfg *config.Config) {
+	ws.blockedWords = wordSet(cfg.Wall.BlockedWords)
+	ws.reply = cfg.Wall.Reply
+}
+
+func wordSet(blockedWords []string) map[string]bool {
+	words := make(map[string]bool, len(blockedWords))
+	for _, word := range blockedWords {
+		if word = strings.ToLower(strings.TrimSpace(word)); word != "" {
+			words[word] = true
+		}
+	}
+	return words
+}
+
+func (ws *WallStrategy) Process(ctx context.Context, clientID int64, message domain.SMSMessage, parsedDate time.Time) error {
+	text := strings.TrimSpace(message.Text)
+	if text == "" {
+		return nil
+	}
+
+	// Profane messages never reach the moderators' queue
+	status, reason := repository.WallStatusPending, ""
+	if ws.containsBlockedWord(text) {
+		status, reason = repository.WallStatusRejected, profanityReason
+	}
+
+	_, err := ws.repo.InsertWallMessage(ctx, message.Destination, text, parsedDate, clientID, status, reason)
+	if err != nil {
+		return fmt.Errorf("Failed to insert wall message: %w", err)
+	}
+
+	if ws.reply != "" {
+		if err := ws.publisher.SendMessage(ctx, message.Destination, message.Source, ws.reply); err != nil {
+			return fmt.Errorf("Failed to send message notification: %w", err)
+		}
+	}
+	return nil
+}
+
+func (ws *WallStrategy) containsBlockedWord(text string) bool {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		if ws.blockedWords[word] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,3 @@
+-- Clients complete a survey once unless the survey allows retakes.
+ALTER TABLE surveys
+    ADD COLUMN allow_retakes BOOLEAN NOT NULL DEFAULT FALSE;
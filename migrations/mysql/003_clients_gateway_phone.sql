@@ -0,0 +1,8 @@
+-- clients.phone holds E.164 numbers; gateway_phone keeps the number as the
+-- SMS gateway delivers it, which outbid notices and scheduled content are
+-- sent to. Run before cmd/mergeclients, so numbers that are not normalized
+-- yet are kept as the gateway form.
+ALTER TABLE clients
+    ADD COLUMN gateway_phone VARCHAR(32) NULL AFTER phone;
+
+UPDATE clients SET gateway_phone = phone WHERE phone NOT LIKE '+%';
@@ -0,0 +1,6 @@
+-- UpsertClient resolves concurrent first messages from a phone to one client
+-- only when clients.phone is unique, and the processor refuses to start
+-- without this index. Run after cmd/mergeclients, which removes the
+-- duplicates that would make this statement fail.
+ALTER TABLE clients
+    ADD UNIQUE INDEX clients_phone_unique (phone);
@@ -0,0 +1,11 @@
+-- Lottery draws freeze their entry set and excluded lotteries when they are
+-- committed, and store the seed only once it is revealed by the draw.
+ALTER TABLE lottery_draws
+    ALTER COLUMN seed TYPE VARCHAR(64),
+    ALTER COLUMN seed DROP NOT NULL,
+    ADD COLUMN last_entry_id BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN excluded_lottery_ids VARCHAR(1024) NULL;
+
+-- Seeds of draws that were committed but not performed were readable by
+-- anyone with access to the table; such draws must be committed again.
+DELETE FROM lottery_draws WHERE drawn_at IS NULL;
@@ -0,0 +1,13 @@
+-- The content scheduler leases due contents through claimed_until and sets
+-- sent_at only once every subscriber has the content. Deliveries are recorded
+-- per subscriber, so a content claimed again after failed sends skips the
+-- subscribers it already reached.
+ALTER TABLE subscription_contents
+    ADD COLUMN claimed_until TIMESTAMP NULL;
+
+CREATE TABLE subscription_deliveries (
+    content_id BIGINT NOT NULL,
+    client_id BIGINT NOT NULL,
+    delivered_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (content_id, client_id)
+);
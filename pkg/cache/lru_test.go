@@ -0,0 +1,133 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRU(t *testing.T) {
+	type op struct {
+		action string // "add", "get", "remove" or "wait"
+		key    string
+		value  int
+		found  bool
+	}
+
+	tests := []struct {
+		name     string
+		capacity int
+		ttl      time.Duration
+		ops      []op
+		wantLen  int
+	}{
+		{
+			name:     "get returns added values",
+			capacity: 2,
+			ops: []op{
+				{action: "add", key: "a", value: 1},
+				{action: "get", key: "a", value: 1, found: true},
+				{action: "get", key: "b"},
+			},
+			wantLen: 1,
+		},
+		{
+			name:     "add replaces the value of a key",
+			capacity: 2,
+			ops: []op{
+				{action: "add", key: "a", value: 1},
+				{action: "add", key: "a", value: 2},
+				{action: "get", key: "a", value: 2, found: true},
+			},
+			wantLen: 1,
+		},
+		{
+			name:     "least recently added is evicted",
+			capacity: 2,
+			ops: []op{
+				{action: "add", key: "a", value: 1},
+				{action: "add", key: "b", value: 2},
+				{action: "add", key: "c", value: 3},
+				{action: "get", key: "a"},
+				{action: "get", key: "b", value: 2, found: true},
+				{action: "get", key: "c", value: 3, found: true},
+			},
+			wantLen: 2,
+		},
+		{
+			name:     "get marks an entry as recently used",
+			capacity: 2,
+			ops: []op{
+				{action: "add", key: "a", value: 1},
+				{action: "add", key: "b", value: 2},
+				{action: "get", key: "a", value: 1, found: true},
+				{action: "add", key: "c", value: 3},
+				{action: "get", key: "a", value: 1, found: true},
+				{action: "get", key: "b"},
+			},
+			wantLen: 2,
+		},
+		{
+			name:     "remove drops the entry",
+			capacity: 2,
+			ops: []op{
+				{action: "add", key: "a", value: 1},
+				{action: "remove", key: "a"},
+				{action: "remove", key: "missing"},
+				{action: "get", key: "a"},
+			},
+			wantLen: 0,
+		},
+		{
+			name:     "zero capacity stores nothing",
+			capacity: 0,
+			ops: []op{
+				{action: "add", key: "a", value: 1},
+				{action: "get", key: "a"},
+			},
+			wantLen: 0,
+		},
+		{
+			name:     "expired entries are dropped on get",
+			capacity: 2,
+			ttl:      time.Millisecond,
+			ops: []op{
+				{action: "add", key: "a", value: 1},
+				{action: "wait"},
+				{action: "get", key: "a"},
+			},
+			wantLen: 0,
+		},
+		{
+			name:     "zero ttl never expires",
+			capacity: 2,
+			ops: []op{
+				{action: "add", key: "a", value: 1},
+				{action: "wait"},
+				{action: "get", key: "a", value: 1, found: true},
+			},
+			wantLen: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		c := NewLRU[string, int](tt.capacity, tt.ttl)
+		for i, o := range tt.ops {
+			switch o.action {
+			case "add":
+				c.Add(o.key, o.value)
+			case "remove":
+				c.Remove(o.key)
+			case "wait":
+				time.Sleep(5 * time.Millisecond)
+			case "get":
+				got, found := c.Get(o.key)
+				if got != o.value || found != o.found {
+					t.Errorf("%s: op %d: Get(%q) = %d, %v; want %d, %v", tt.name, i, o.key, got, found, o.value, o.found)
+				}
+			}
+		}
+		if got := c.Len(); got != tt.wantLen {
+			t.Errorf("%s: Len() = %d; want %d", tt.name, got, tt.wantLen)
+		}
+	}
+}
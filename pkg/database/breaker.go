@@ -0,0 +1,141 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"answers-processor/pkg/logger"
+)
+
+// Breaker pings the database periodically and opens after threshold
+// consecutive failed pings. Message consumption is paused while it is open,
+// so messages stay queued instead of failing one after another during an
+// outage or a failover. The first successful ping closes it again.
+type Breaker struct {
+	db          *sql.DB
+	interval    time.Duration
+	threshold   int
+	logInstance *logger.Loggers
+
+	mu       sync.Mutex
+	failures int
+	opened   time.Time       // zero while closed
+	healthy  chan struct{}   // closed while the breaker is closed
+	tripped  chan struct{}   // closed while the breaker is open
+	ctx      context.Context // cancelled by Stop
+	cancel   context.CancelFunc
+}
+
+func NewBreaker(db *sql.DB, interval time.Duration, threshold int, logInstance *logger.Loggers) *Breaker {
+	if threshold <= 0 {
+		threshold = 1
+	}
+	healthy := make(chan struct{})
+	close(healthy)
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Breaker{
+		db:          db,
+		interval:    interval,
+		threshold:   threshold,
+		logInstance: logInstance,
+		healthy:     healthy,
+		tripped:     make(chan struct{}),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+}
+
+// Start begins the health checks. A zero interval disables them and the
+// breaker stays closed.
+func (b *Breaker) Start() {
+	if b.interval <= 0 {
+		return
+	}
+	go b.run()
+}
+
+func (b *Breaker) Stop() {
+	b.cancel()
+}
+
+func (b *Breaker) run() {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(b.ctx, b.interval)
+			err := b.db.PingContext(ctx)
+			cancel()
+			b.record(err)
+		case <-b.ctx.Done():
+			return
+		}
+	}
+}
+
+func (b *Breaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err == nil {
+		b.failures = 0
+		if !b.opened.IsZero() {
+			b.logInstance.InfoLogger.Info("Database is healthy again, resuming consumption", "down_for", time.Since(b.opened).Round(time.Second))
+			b.opened = time.Time{}
+			close(b.healthy)
+			b.tripped = make(chan struct{})
+		}
+		return
+	}
+
+	b.failures++
+	if b.failures < b.threshold || !b.opened.IsZero() {
+		b.logInstance.ErrorLogger.Error("Database health check failed", "failures", b.failures, "error", err)
+		return
+	}
+	b.logInstance.ErrorLogger.Error("Database is unhealthy, pausing consumption", "failures", b.failures, "error", err)
+	b.opened = time.Now()
+	close(b.tripped)
+	b.healthy = make(chan struct{})
+}
+
+// Healthy returns a channel that is closed while the breaker is closed.
+func (b *Breaker) Healthy() <-chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.healthy
+}
+
+// Tripped returns a channel that is closed once the breaker opens.
+func (b *Breaker) Tripped() <-chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tripped
+}
+
+// Wait blocks until the breaker is closed or ctx is done.
+func (b *Breaker) Wait(ctx context.Context) error {
+	select {
+	case <-b.Healthy():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// BreakerStats is the breaker state published for monitoring.
+type BreakerStats struct {
+	Open     bool      `json:"open"`
+	Failures int       `json:"failures"`
+	OpenedAt time.Time `json:"opened_at"`
+}
+
+func (b *Breaker) Stats() BreakerStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return BreakerStats{Open: !b.opened.IsZero(), Failures: b.failures, OpenedAt: b.opened}
+}
@@ -3,22 +3,76 @@ package db
 import (
 	"database/sql"
 	"fmt"
+	"slices"
+	"time"
 
-	_ "github.com/go-sql-driver/mysql"
+	"answers-processor/pkg/logger"
 )
 
-func NewDatabase(addr string) (*sql.DB, error) {
+// Options tune the connection pool and the connection attempts at startup.
+// Zero pool values keep the database/sql defaults.
+type Options struct {
+	DriverName        string // database/sql driver, the dialect's default when empty
+	MaxOpenConns      int
+	MaxIdleConns      int
+	ConnMaxLifetime   time.Duration
+	ConnMaxIdleTime   time.Duration
+	ConnectAttempts   int           // at least one
+	ConnectBackoff    time.Duration // delay after the first failed attempt, doubled after each one
+	MaxConnectBackoff time.Duration
+}
+
+// NewDatabase opens the database of the given dialect. DATETIME values are
+// written and read as wall-clock times in loc. The database is pinged until it
+// answers or options.ConnectAttempts are used up, so the service can start
+// while the database is still coming up.
+//
+// The MySQL and PostgreSQL (pgx) drivers are linked into the service; SQLite's
+// is linked by building with -tags sqlite.
+func NewDatabase(dialect Dialect, addr string, loc *time.Location, options Options, logInstance *logger.Loggers) (*sql.DB, error) {
 	if addr == "" {
 		return nil, fmt.Errorf("database address is empty")
 	}
-	db, err := sql.Open("mysql", addr)
+	driverName := options.DriverName
+	if driverName == "" {
+		driverName = dialect.DriverName()
+	}
+	if !slices.Contains(sql.Drivers(), driverName) {
+		return nil, fmt.Errorf("no database/sql driver %q is linked into this build for %s", driverName, dialect.Name())
+	}
+
+	db, err := dialect.Open(driverName, addr, loc)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database connection: %w", err)
 	}
-
-	if err = db.Ping(); err != nil {
-		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	if options.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(options.MaxOpenConns)
+	}
+	if options.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(options.MaxIdleConns)
+	}
+	if options.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(options.ConnMaxLifetime)
+	}
+	if options.ConnMaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(options.ConnMaxIdleTime)
 	}
 
-	return db, nil
+	backoff := options.ConnectBackoff
+	for attempt := 1; ; attempt++ {
+		if err = db.Ping(); err == nil {
+			return db, nil
+		}
+		if attempt >= options.ConnectAttempts {
+			db.Close()
+			return nil, fmt.Errorf("failed to connect to database after %d attempts: %w", attempt, err)
+		}
+
+		logInstance.ErrorLogger.Error("Failed to connect to database, retrying", "attempt", attempt, "retry_in", backoff, "error", err)
+		time.Sleep(backoff)
+		backoff *= 2
+		if options.MaxConnectBackoff > 0 && backoff > options.MaxConnectBackoff {
+			backoff = options.MaxConnectBackoff
+		}
+	}
 }
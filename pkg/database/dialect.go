@@ -0,0 +1,197 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Dialect adapts the repository queries, which are written for MySQL with ?
+// placeholders, to a database backend.
+type Dialect interface {
+	Name() string
+	// DriverName is the database/sql driver the backend is opened with by
+	// default.
+	DriverName() string
+	// Open opens addr with the named driver. DATETIME values are read and
+	// written as wall-clock times in loc, except with drivers the dialect does
+	// not know, which get addr unchanged.
+	Open(driverName, addr string, loc *time.Location) (*sql.DB, error)
+	// Rewrite turns a query written for MySQL into one for this backend.
+	Rewrite(query string) string
+	// ReturningID reports whether inserted IDs are read with RETURNING id
+	// instead of LastInsertId.
+	ReturningID() bool
+	// UpsertKeepID is appended to an INSERT so that a row conflicting on
+	// column is kept unchanged and its ID reported like an inserted one.
+	UpsertKeepID(column string) string
+	// UniqueIndexQuery counts the unique indexes on exactly the column given
+	// as the second argument of the table given as the first.
+	UniqueIndexQuery() string
+}
+
+// Dialects are keyed by the database.driver configuration value.
+var Dialects = map[string]Dialect{
+	"mysql":    mysqlDialect{},
+	"postgres": postgresDialect{},
+	"sqlite":   sqliteDialect{},
+}
+
+func LookupDialect(name string) (Dialect, error) {
+	dialect, ok := Dialects[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported database driver %q", name)
+	}
+	return dialect, nil
+}
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) Name() string       { return "mysql" }
+func (mysqlDialect) DriverName() string { return "mysql" }
+
+func (mysqlDialect) Open(driverName, addr string, loc *time.Location) (*sql.DB, error) {
+	// Repositories scan DATETIME columns into time.Time
+	mysqlConfig, err := mysql.ParseDSN(addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse database address: %w", err)
+	}
+	mysqlConfig.ParseTime = true
+	mysqlConfig.Loc = loc
+	return sql.Open(driverName, mysqlConfig.FormatDSN())
+}
+
+func (mysqlDialect) Rewrite(query string) string { return query }
+func (mysqlDialect) ReturningID() bool           { return false }
+
+func (mysqlDialect) UpsertKeepID(column string) string {
+	// LAST_INSERT_ID(id) makes LastInsertId return the existing row's ID
+	return "ON DUPLICATE KEY UPDATE id = LAST_INSERT_ID(id)"
+}
+
+func (mysqlDialect) UniqueIndexQuery() string {
+	return `
+        SELECT COUNT(*) FROM (
+            SELECT index_name
+            FROM information_schema.statistics
+            WHERE table_schema = DATABASE() AND table_name = ? AND non_unique = 0
+            GROUP BY index_name
+            HAVING COUNT(*) = 1 AND MAX(column_name) = ?
+        ) unique_indexes
+    `
+}
+
+// postgresDialect expects timestamp without time zone columns. Set the TimeZone
+// parameter of the address to the business timezone too, so that SQL functions
+// such as now() agree with the service.
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string       { return "postgres" }
+func (postgresDialect) DriverName() string { return "pgx" }
+
+func (postgresDialect) Open(driverName, addr string, loc *time.Location) (*sql.DB, error) {
+	if driverName != "pgx" {
+		return sql.Open(driverName, addr)
+	}
+	return openPgx(addr, loc)
+}
+
+func (postgresDialect) Rewrite(query string) string { return numberPlaceholders(query) }
+func (postgresDialect) ReturningID() bool           { return true }
+
+func (postgresDialect) UpsertKeepID(column string) string {
+	// A no-op update, unlike DO NOTHING, makes RETURNING report the existing row
+	return "ON CONFLICT (" + column + ") DO UPDATE SET " + column + " = excluded." + column
+}
+
+func (postgresDialect) UniqueIndexQuery() string {
+	return `
+        SELECT COUNT(*)
+        FROM pg_index i
+        JOIN pg_class t ON t.oid = i.indrelid
+        JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = i.indkey[0]
+        WHERE t.relname = ? AND i.indisunique AND i.indnatts = 1 AND a.attname = ?
+            AND pg_table_is_visible(t.oid)
+    `
+}
+
+// sqliteDialect is meant for local development and integration tests; its
+// driver, modernc.org/sqlite, is linked with the sqlite build tag. SQLite
+// serializes writers, so row locks are dropped from queries. Times are stored
+// as text in loc, so that they compare in order.
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string       { return "sqlite" }
+func (sqliteDialect) DriverName() string { return "sqlite" }
+
+func (sqliteDialect) Open(driverName, addr string, loc *time.Location) (*sql.DB, error) {
+	if driverName != "sqlite" {
+		return sql.Open(driverName, addr)
+	}
+	db, err := sql.Open(driverName, "")
+	if err != nil {
+		return nil, err
+	}
+	driver := db.Driver()
+	db.Close()
+
+	// Write times in a format SQLite's date functions understand and whose
+	// text sorts in time order within one UTC offset
+	separator := "?"
+	if strings.Contains(addr, "?") {
+		separator = "&"
+	}
+	if !strings.Contains(addr, "_time_format=") {
+		addr += separator + "_time_format=sqlite"
+	}
+	return sql.OpenDB(&locationConnector{driver: driver, dsn: addr, loc: loc}), nil
+}
+
+func (sqliteDialect) Rewrite(query string) string {
+	query = strings.ReplaceAll(query, "FOR UPDATE SKIP LOCKED", "")
+	return strings.ReplaceAll(query, "FOR UPDATE", "")
+}
+
+func (sqliteDialect) ReturningID() bool { return true }
+
+func (sqliteDialect) UpsertKeepID(column string) string {
+	return postgresDialect{}.UpsertKeepID(column)
+}
+
+func (sqliteDialect) UniqueIndexQuery() string {
+	return `
+        SELECT COUNT(*)
+        FROM pragma_index_list(?) l
+        WHERE l."unique" = 1
+            AND (SELECT COUNT(*) FROM pragma_index_info(l.name)) = 1
+            AND (SELECT name FROM pragma_index_info(l.name)) = ?
+    `
+}
+
+// numberPlaceholders replaces ? placeholders outside string literals with $1,
+// $2 and so on.
+func numberPlaceholders(query string) string {
+	var b strings.Builder
+	b.Grow(len(query) + 16)
+
+	n := 0
+	inString := false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'':
+			inString = !inString
+		case c == '?' && !inString:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,83 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestNumberPlaceholders(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT 1", "SELECT 1"},
+		{"SELECT * FROM t WHERE a = ?", "SELECT * FROM t WHERE a = $1"},
+		{"INSERT INTO t (a, b, c) VALUES (?, ?, ?)", "INSERT INTO t (a, b, c) VALUES ($1, $2, $3)"},
+		{"SELECT * FROM t WHERE a = '?' AND b = ?", "SELECT * FROM t WHERE a = '?' AND b = $1"},
+		{"SELECT * FROM t WHERE a = 'it''s ?' AND b = ?", "SELECT * FROM t WHERE a = 'it''s ?' AND b = $1"},
+		{"SELECT ? || '?' || ?", "SELECT $1 || '?' || $2"},
+		{"VALUES " + "(?, ?), (?, ?), (?, ?), (?, ?), (?, ?)", "VALUES ($1, $2), ($3, $4), ($5, $6), ($7, $8), ($9, $10)"},
+	}
+
+	for _, tt := range tests {
+		if got := numberPlaceholders(tt.query); got != tt.want {
+			t.Errorf("numberPlaceholders(%q) = %q; want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestSQLiteRewrite(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT id FROM lots WHERE id = ? FOR UPDATE", "SELECT id FROM lots WHERE id = ? "},
+		{"SELECT id FROM c ORDER BY send_at FOR UPDATE SKIP LOCKED", "SELECT id FROM c ORDER BY send_at "},
+		{"SELECT id FROM a FOR UPDATE; SELECT id FROM b FOR UPDATE", "SELECT id FROM a ; SELECT id FROM b "},
+		{"SELECT id FROM lots WHERE id = ?", "SELECT id FROM lots WHERE id = ?"},
+	}
+
+	for _, tt := range tests {
+		if got := (sqliteDialect{}).Rewrite(tt.query); got != tt.want {
+			t.Errorf("Rewrite(%q) = %q; want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestPostgresTimestampLocation(t *testing.T) {
+	loc := time.FixedZone("TMT", 5*60*60)
+	m := pgtype.NewMap()
+	registerTimestampLocation(m, loc)
+
+	wallClock := time.Date(2024, time.March, 15, 12, 30, 0, 0, loc)
+	tests := []struct {
+		name  string
+		value time.Time
+	}{
+		{"business timezone", wallClock},
+		{"UTC", wallClock.UTC()},
+		{"another timezone", wallClock.In(time.FixedZone("MSK", 3*60*60))},
+	}
+
+	for _, tt := range tests {
+		for _, format := range []int16{pgtype.TextFormatCode, pgtype.BinaryFormatCode} {
+			encoded, err := m.Encode(pgtype.TimestampOID, format, tt.value, nil)
+			if err != nil {
+				t.Fatalf("%s: Encode: %v", tt.name, err)
+			}
+			if format == pgtype.TextFormatCode && string(encoded) != "2024-03-15 12:30:00" {
+				t.Errorf("%s: encoded %q; want the business wall clock %q", tt.name, encoded, "2024-03-15 12:30:00")
+			}
+
+			var scanned time.Time
+			if err := m.Scan(pgtype.TimestampOID, format, encoded, &scanned); err != nil {
+				t.Fatalf("%s: Scan: %v", tt.name, err)
+			}
+			if !scanned.Equal(wallClock) || scanned.Location() != loc {
+				t.Errorf("%s: scanned %v; want %v", tt.name, scanned, wallClock)
+			}
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// MySQL server errors that go away on retry.
+var transientMySQLErrors = map[uint16]bool{
+	1040: true, // too many connections
+	1205: true, // lock wait timeout
+	1213: true, // deadlock
+	1290: true, // read-only, e.g. a demoted primary during failover
+	1792: true, // read-only transaction
+	1836: true, // read-only mode
+}
+
+// IsTransient reports whether err may go away when the operation is retried:
+// a lost or timed-out connection, a deadlock or lock wait timeout, or a server
+// that is failing over. Errors about the data itself, such as sql.ErrNoRows or
+// a constraint violation, are not transient.
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) ||
+		errors.Is(err, sql.ErrConnDone) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return transientMySQLErrors[mysqlErr.Number]
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// Connection exceptions, serialization failures and deadlocks,
+		// insufficient resources, operator intervention and read-only
+		// transactions on a standby
+		return strings.HasPrefix(pgErr.Code, "08") || strings.HasPrefix(pgErr.Code, "40") ||
+			strings.HasPrefix(pgErr.Code, "53") || strings.HasPrefix(pgErr.Code, "57P") ||
+			pgErr.Code == "25006"
+	}
+	return false
+}
+
+// ErrRetryable marks errors of operations that failed before anything was
+// written, for a reason a retry may fix. Only such failures may be retried
+// without writing twice.
+var ErrRetryable = errors.New("retryable")
+
+type retryableError struct {
+	err error
+}
+
+func (e *retryableError) Error() string   { return e.err.Error() }
+func (e *retryableError) Unwrap() []error { return []error{e.err, ErrRetryable} }
+
+// Retryable marks err with ErrRetryable when it is transient or its context
+// was cancelled. Call it only on errors of operations that have not written
+// anything, such as lookups.
+func Retryable(err error) error {
+	if IsTransient(err) || errors.Is(err, context.Canceled) {
+		return &retryableError{err: err}
+	}
+	return err
+}
@@ -0,0 +1,85 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"no rows", sql.ErrNoRows, false},
+		{"other error", errors.New("voting item not found for vote code"), false},
+		{"bad connection", driver.ErrBadConn, true},
+		{"invalid connection", mysql.ErrInvalidConn, true},
+		{"connection done", sql.ErrConnDone, true},
+		{"query timeout", context.DeadlineExceeded, true},
+		{"cancelled", context.Canceled, false},
+		{"network", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+		{"wrapped", fmt.Errorf("Failed to insert answer: %w", driver.ErrBadConn), true},
+		{"mysql deadlock", &mysql.MySQLError{Number: 1213}, true},
+		{"mysql lock wait timeout", &mysql.MySQLError{Number: 1205}, true},
+		{"mysql read-only", &mysql.MySQLError{Number: 1290}, true},
+		{"mysql duplicate entry", &mysql.MySQLError{Number: 1062}, false},
+		{"mysql unknown column", &mysql.MySQLError{Number: 1054}, false},
+		{"postgres connection failure", &pgconn.PgError{Code: "08006"}, true},
+		{"postgres serialization failure", &pgconn.PgError{Code: "40001"}, true},
+		{"postgres deadlock", &pgconn.PgError{Code: "40P01"}, true},
+		{"postgres admin shutdown", &pgconn.PgError{Code: "57P01"}, true},
+		{"postgres read-only transaction", &pgconn.PgError{Code: "25006"}, true},
+		{"postgres unique violation", &pgconn.PgError{Code: "23505"}, false},
+	}
+
+	for _, tt := range tests {
+		if got := IsTransient(tt.err); got != tt.want {
+			t.Errorf("%s: IsTransient(%v) = %v; want %v", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"no rows", sql.ErrNoRows, false},
+		{"bad connection", driver.ErrBadConn, true},
+		{"query timeout", context.DeadlineExceeded, true},
+		{"cancelled", context.Canceled, true},
+		{"wrapped", fmt.Errorf("Failed to get account type: %w", driver.ErrBadConn), true},
+		{"mysql duplicate entry", &mysql.MySQLError{Number: 1062}, false},
+	}
+
+	for _, tt := range tests {
+		err := Retryable(tt.err)
+		if got := errors.Is(err, ErrRetryable); got != tt.want {
+			t.Errorf("%s: Retryable(%v) is ErrRetryable = %v; want %v", tt.name, tt.err, got, tt.want)
+		}
+		if tt.err != nil && !errors.Is(err, tt.err) {
+			t.Errorf("%s: Retryable(%v) = %v; want it to wrap the error", tt.name, tt.err, err)
+		}
+		if tt.err == nil && err != nil {
+			t.Errorf("%s: Retryable(nil) = %v; want nil", tt.name, err)
+		}
+	}
+
+	// Marked errors keep their message and stay marked when wrapped again
+	err := fmt.Errorf("Failed to find lottery: %w", Retryable(driver.ErrBadConn))
+	if !errors.Is(err, ErrRetryable) || err.Error() != "Failed to find lottery: "+driver.ErrBadConn.Error() {
+		t.Errorf("wrapped retryable error = %q, retryable %v", err, errors.Is(err, ErrRetryable))
+	}
+}
@@ -0,0 +1,65 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// openPgx opens addr with pgx, reading and writing timestamp without time
+// zone values as wall-clock times in loc like the MySQL driver does.
+func openPgx(addr string, loc *time.Location) (*sql.DB, error) {
+	config, err := pgx.ParseConfig(addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse database address: %w", err)
+	}
+	return stdlib.OpenDB(*config, stdlib.OptionAfterConnect(func(ctx context.Context, conn *pgx.Conn) error {
+		registerTimestampLocation(conn.TypeMap(), loc)
+		return nil
+	})), nil
+}
+
+// registerTimestampLocation makes m scan timestamps as wall-clock times in loc
+// and convert times to loc before encoding them; pgx otherwise writes the
+// wall clock of whatever location a time.Time carries and scans into UTC.
+func registerTimestampLocation(m *pgtype.Map, loc *time.Location) {
+	m.RegisterType(&pgtype.Type{
+		Name:  "timestamp",
+		OID:   pgtype.TimestampOID,
+		Codec: &timestampCodec{TimestampCodec: pgtype.TimestampCodec{ScanLocation: loc}, loc: loc},
+	})
+}
+
+type timestampCodec struct {
+	pgtype.TimestampCodec
+	loc *time.Location
+}
+
+func (c *timestampCodec) PlanEncode(m *pgtype.Map, oid uint32, format int16, value any) pgtype.EncodePlan {
+	plan := c.TimestampCodec.PlanEncode(m, oid, format, value)
+	if plan == nil {
+		return nil
+	}
+	return &timestampEncodePlan{next: plan, loc: c.loc}
+}
+
+type timestampEncodePlan struct {
+	next pgtype.EncodePlan
+	loc  *time.Location
+}
+
+func (p *timestampEncodePlan) Encode(value any, buf []byte) ([]byte, error) {
+	ts, err := value.(pgtype.TimestampValuer).TimestampValue()
+	if err != nil {
+		return nil, err
+	}
+	if ts.Valid && ts.InfinityModifier == pgtype.Finite {
+		ts.Time = ts.Time.In(p.loc)
+	}
+	return p.next.Encode(ts, buf)
+}
@@ -0,0 +1,7 @@
+//go:build sqlite
+
+package db
+
+// SQLite is for local development and integration tests and is left out of
+// production builds.
+import _ "modernc.org/sqlite"
@@ -0,0 +1,24 @@
+package db
+
+import (
+	"database/sql"
+	"expvar"
+)
+
+// PublishStats exposes the pool statistics of db and of replica, which may be
+// nil, and the breaker state as the "database" expvar variable. It must be
+// called once.
+func PublishStats(db, replica *sql.DB, breaker *Breaker) {
+	expvar.Publish("database", expvar.Func(func() any {
+		stats := struct {
+			Pool        sql.DBStats  `json:"pool"`
+			ReplicaPool *sql.DBStats `json:"replica_pool,omitempty"`
+			Breaker     BreakerStats `json:"breaker"`
+		}{Pool: db.Stats(), Breaker: breaker.Stats()}
+		if replica != nil {
+			replicaStats := replica.Stats()
+			stats.ReplicaPool = &replicaStats
+		}
+		return stats
+	}))
+}
@@ -0,0 +1,176 @@
+package dates
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policies for messages whose date is missing, unparsable or outside the
+// accepted skew.
+const (
+	PolicyReceiveTime = "receive_time" // use the time the message was received
+	PolicyReject      = "reject"       // drop the message
+	PolicyClamp       = "clamp"        // move the date to the nearest accepted time; skew only
+)
+
+// Adjustments report how Parse changed a date under the policies.
+const (
+	AdjustedNone    = ""
+	AdjustedMissing = "missing_replaced" // missing or unparsable, replaced by the receive time
+	AdjustedSkew    = "skew_replaced"    // outside the skew, replaced by the receive time
+	AdjustedClamped = "skew_clamped"     // outside the skew, moved to the nearest accepted time
+)
+
+var (
+	ErrMissingDate = errors.New("message date is missing or invalid")
+	ErrSkewedDate  = errors.New("message date is outside the accepted skew")
+)
+
+// Layouts with an explicit offset. Their instant is kept and only converted
+// to the business timezone.
+var zonedLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02T15:04:05-0700",
+	"2006-01-02 15:04:05-0700",
+	time.RFC1123Z,
+}
+
+// Layouts without an offset, read as wall-clock time in the business timezone.
+var localLayouts = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04",
+	"02.01.2006 15:04:05",
+}
+
+type Options struct {
+	Timezone      string        // IANA name, "Local" or "UTC"
+	Layouts       []string      // extra layouts tried before the built-in ones
+	MissingPolicy string        // receive_time or reject
+	SkewPolicy    string        // receive_time, reject or clamp
+	MaxFutureSkew time.Duration // 0 accepts any future date
+	MaxPastSkew   time.Duration // 0 accepts any past date
+}
+
+// Parser turns SMS gateway dates into times in the business timezone.
+type Parser struct {
+	location      *time.Location
+	layouts       []string
+	missingPolicy string
+	skewPolicy    string
+	maxFutureSkew time.Duration
+	maxPastSkew   time.Duration
+}
+
+func NewParser(options Options) (*Parser, error) {
+	location, err := time.LoadLocation(options.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %w", options.Timezone, err)
+	}
+
+	switch options.MissingPolicy {
+	case PolicyReceiveTime, PolicyReject:
+	default:
+		return nil, fmt.Errorf("invalid missing date policy %q", options.MissingPolicy)
+	}
+	switch options.SkewPolicy {
+	case PolicyReceiveTime, PolicyReject, PolicyClamp:
+	default:
+		return nil, fmt.Errorf("invalid date skew policy %q", options.SkewPolicy)
+	}
+	if options.MaxFutureSkew < 0 || options.MaxPastSkew < 0 {
+		return nil, errors.New("date skew limits must not be negative")
+	}
+
+	return &Parser{
+		location:      location,
+		layouts:       options.Layouts,
+		missingPolicy: options.MissingPolicy,
+		skewPolicy:    options.SkewPolicy,
+		maxFutureSkew: options.MaxFutureSkew,
+		maxPastSkew:   options.MaxPastSkew,
+	}, nil
+}
+
+// Location returns the business timezone.
+func (p *Parser) Location() *time.Location {
+	return p.location
+}
+
+// Parse reads value and applies the missing and skew policies relative to
+// received. The result is always in the business timezone; the adjustment
+// tells whether a policy replaced the date, so callers can report it.
+func (p *Parser) Parse(value string, received time.Time) (time.Time, string, error) {
+	received = received.In(p.location).Truncate(time.Second)
+
+	date, ok := p.parse(strings.TrimSpace(value))
+	if !ok {
+		if p.missingPolicy == PolicyReject {
+			return time.Time{}, AdjustedNone, fmt.Errorf("%w: %q", ErrMissingDate, value)
+		}
+		return received, AdjustedMissing, nil
+	}
+	date = date.Truncate(time.Second)
+
+	var bound time.Time
+	switch {
+	case p.maxFutureSkew > 0 && date.After(received.Add(p.maxFutureSkew)):
+		bound = received.Add(p.maxFutureSkew)
+	case p.maxPastSkew > 0 && date.Before(received.Add(-p.maxPastSkew)):
+		bound = received.Add(-p.maxPastSkew)
+	default:
+		return date, AdjustedNone, nil
+	}
+
+	switch p.skewPolicy {
+	case PolicyReject:
+		return time.Time{}, AdjustedNone, fmt.Errorf("%w: %s received at %s", ErrSkewedDate, date.Format(time.RFC3339), received.Format(time.RFC3339))
+	case PolicyClamp:
+		return bound, AdjustedClamped, nil
+	default:
+		return received, AdjustedSkew, nil
+	}
+}
+
+func (p *Parser) parse(value string) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, false
+	}
+
+	if epoch, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return p.fromEpoch(epoch), true
+	}
+
+	for _, layout := range p.layouts {
+		if date, err := time.ParseInLocation(layout, value, p.location); err == nil {
+			return date.In(p.location), true
+		}
+	}
+	for _, layout := range zonedLayouts {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date.In(p.location), true
+		}
+	}
+	for _, layout := range localLayouts {
+		if date, err := time.ParseInLocation(layout, value, p.location); err == nil {
+			return date, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// fromEpoch accepts Unix seconds or, for values too large to be seconds,
+// milliseconds.
+func (p *Parser) fromEpoch(epoch int64) time.Time {
+	const maxSeconds = 1e11 // year 5138
+	if epoch > maxSeconds || epoch < -maxSeconds {
+		return time.UnixMilli(epoch).In(p.location)
+	}
+	return time.Unix(epoch, 0).In(p.location)
+}
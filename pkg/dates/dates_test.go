@@ -0,0 +1,83 @@
+package dates
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	ashgabat, err := time.LoadLocation("Asia/Ashgabat")
+	if err != nil {
+		t.Skip("timezone database not available")
+	}
+	received := time.Date(2024, 3, 1, 12, 0, 0, 0, ashgabat)
+	at := func(hour, minute, second int) time.Time {
+		return time.Date(2024, 3, 1, hour, minute, second, 0, ashgabat)
+	}
+
+	lenient := Options{Timezone: "Asia/Ashgabat", MissingPolicy: PolicyReceiveTime, SkewPolicy: PolicyReceiveTime, MaxFutureSkew: time.Hour, MaxPastSkew: 24 * time.Hour}
+	strict := Options{Timezone: "Asia/Ashgabat", MissingPolicy: PolicyReject, SkewPolicy: PolicyReject, MaxFutureSkew: time.Hour, MaxPastSkew: 24 * time.Hour}
+	clamp := Options{Timezone: "Asia/Ashgabat", MissingPolicy: PolicyReject, SkewPolicy: PolicyClamp, MaxFutureSkew: time.Hour, MaxPastSkew: 24 * time.Hour}
+	custom := Options{Timezone: "Asia/Ashgabat", Layouts: []string{"01/02/2006 15:04"}, MissingPolicy: PolicyReject, SkewPolicy: PolicyReject}
+
+	tests := []struct {
+		name       string
+		options    Options
+		value      string
+		want       time.Time
+		adjustment string
+		err        error
+	}{
+		{"local layout", strict, "2024-03-01T10:30:00", at(10, 30, 0), AdjustedNone, nil},
+		{"space layout", strict, "2024-03-01 10:30:00", at(10, 30, 0), AdjustedNone, nil},
+		{"fractional seconds", strict, "2024-03-01T10:30:00.75", at(10, 30, 0), AdjustedNone, nil},
+		{"without seconds", strict, "2024-03-01T10:30", at(10, 30, 0), AdjustedNone, nil},
+		{"dotted", strict, "01.03.2024 10:30:00", at(10, 30, 0), AdjustedNone, nil},
+		{"offset converted", strict, "2024-03-01T05:30:00Z", at(10, 30, 0), AdjustedNone, nil},
+		{"epoch seconds", strict, "1709271000", at(10, 30, 0), AdjustedNone, nil},
+		{"epoch milliseconds", strict, "1709271000000", at(10, 30, 0), AdjustedNone, nil},
+		{"custom layout", custom, "03/01/2024 10:30", at(10, 30, 0), AdjustedNone, nil},
+		{"missing replaced", lenient, "", received, AdjustedMissing, nil},
+		{"unparsable replaced", lenient, "yesterday", received, AdjustedMissing, nil},
+		{"missing rejected", strict, "", time.Time{}, AdjustedNone, ErrMissingDate},
+		{"future replaced", lenient, "2024-03-01T14:00:00", received, AdjustedSkew, nil},
+		{"future rejected", strict, "2024-03-01T14:00:00", time.Time{}, AdjustedNone, ErrSkewedDate},
+		{"future clamped", clamp, "2024-03-01T14:00:00", at(13, 0, 0), AdjustedClamped, nil},
+		{"past clamped", clamp, "2024-02-27T12:00:00", received.Add(-24 * time.Hour), AdjustedClamped, nil},
+		{"within skew", clamp, "2024-03-01T12:59:59", at(12, 59, 59), AdjustedNone, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parser, err := NewParser(tt.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, adjustment, err := parser.Parse(tt.value, received)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error = %v, want %v", err, tt.err)
+			}
+			if !got.Equal(tt.want) || adjustment != tt.adjustment {
+				t.Errorf("Parse(%q) = %s, %q; want %s, %q", tt.value, got, adjustment, tt.want, tt.adjustment)
+			}
+			if err == nil && got.Location().String() != ashgabat.String() {
+				t.Errorf("location = %s, want %s", got.Location(), ashgabat)
+			}
+		})
+	}
+}
+
+func TestNewParserRejectsInvalidOptions(t *testing.T) {
+	tests := []Options{
+		{Timezone: "Mars/Olympus", MissingPolicy: PolicyReject, SkewPolicy: PolicyReject},
+		{Timezone: "UTC", MissingPolicy: PolicyClamp, SkewPolicy: PolicyReject},
+		{Timezone: "UTC", MissingPolicy: PolicyReject, SkewPolicy: "ignore"},
+		{Timezone: "UTC", MissingPolicy: PolicyReject, SkewPolicy: PolicyReject, MaxPastSkew: -time.Second},
+	}
+	for _, options := range tests {
+		if _, err := NewParser(options); err == nil {
+			t.Errorf("NewParser(%+v) succeeded", options)
+		}
+	}
+}
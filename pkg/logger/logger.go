@@ -9,11 +9,24 @@ import (
 type Loggers struct {
 	InfoLogger  *slog.Logger
 	ErrorLogger *slog.Logger
+	level       *slog.LevelVar // minimum level of InfoLogger
+}
+
+// SetLevel changes the minimum level of InfoLogger, e.g. to "debug" or
+// "warn", while the service runs. ErrorLogger always logs errors.
+func (l *Loggers) SetLevel(name string) error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return err
+	}
+	l.level.Set(level)
+	return nil
 }
 
 func SetupLogger(env string) (*Loggers, error) {
 	var infoHandler slog.Handler
 	var errorHandler slog.Handler
+	level := new(slog.LevelVar)
 
 	if env == "test" {
 		infoHandler = slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelInfo})
@@ -49,7 +62,7 @@ func SetupLogger(env string) (*Loggers, error) {
 			}
 		}
 
-		infoHandler = slog.NewTextHandler(infoFile, &slog.HandlerOptions{Level: slog.LevelInfo})
+		infoHandler = slog.NewTextHandler(infoFile, &slog.HandlerOptions{Level: level})
 		errorHandler = slog.NewTextHandler(errorFile, &slog.HandlerOptions{Level: slog.LevelError})
 	}
 
@@ -59,5 +72,6 @@ func SetupLogger(env string) (*Loggers, error) {
 	return &Loggers{
 		InfoLogger:  infoLogger,
 		ErrorLogger: errorLogger,
+		level:       level,
 	}, nil
 }
@@ -0,0 +1,98 @@
+package phone
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidNumber = errors.New("not a valid phone number")
+
+// Country holds the dialling rules needed to turn national numbers into E.164.
+type Country struct {
+	CallingCode           string
+	TrunkPrefix           string   // dialled before national numbers, e.g. 8 in Turkmenistan
+	NationalLength        int      // digits of a national number without the trunk prefix
+	InternationalPrefixes []string // dialled before a calling code
+}
+
+// Countries are keyed by ISO 3166-1 alpha-2 code.
+var Countries = map[string]Country{
+	"TM": {CallingCode: "993", TrunkPrefix: "8", NationalLength: 8, InternationalPrefixes: []string{"810", "00"}},
+	"RU": {CallingCode: "7", TrunkPrefix: "8", NationalLength: 10, InternationalPrefixes: []string{"810", "00"}},
+	"KZ": {CallingCode: "7", TrunkPrefix: "8", NationalLength: 10, InternationalPrefixes: []string{"810", "00"}},
+	"UZ": {CallingCode: "998", NationalLength: 9, InternationalPrefixes: []string{"00"}},
+	"TR": {CallingCode: "90", TrunkPrefix: "0", NationalLength: 10, InternationalPrefixes: []string{"00"}},
+}
+
+const (
+	minE164Digits = 8
+	maxE164Digits = 15
+)
+
+// Normalizer converts phone numbers as delivered by the SMS gateway to E.164.
+// Numbers without a calling code are read as numbers of the default country.
+type Normalizer struct {
+	country Country
+}
+
+func NewNormalizer(defaultCountry string) (*Normalizer, error) {
+	country, ok := Countries[strings.ToUpper(defaultCountry)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported default country %q", defaultCountry)
+	}
+	return &Normalizer{country: country}, nil
+}
+
+// Normalize returns number in E.164 form, e.g. "+99365123456" for
+// "865123456", "99365123456" or "+993 65 12-34-56" with TM as the default
+// country.
+func (n *Normalizer) Normalize(number string) (string, error) {
+	number = strings.TrimSpace(number)
+	international := strings.HasPrefix(number, "+")
+
+	digits := strings.Map(func(r rune) rune {
+		switch {
+		case r >= '0' && r <= '9':
+			return r
+		case r == '+' || r == ' ' || r == '-' || r == '(' || r == ')' || r == '.':
+			return -1
+		default:
+			return 'x'
+		}
+	}, number)
+	if digits == "" || strings.ContainsRune(digits, 'x') || strings.Count(number, "+") > 1 {
+		return "", fmt.Errorf("%w: %q", ErrInvalidNumber, number)
+	}
+
+	if !international {
+		digits = n.toInternational(digits)
+	}
+
+	if len(digits) < minE164Digits || len(digits) > maxE164Digits || digits[0] == '0' {
+		return "", fmt.Errorf("%w: %q", ErrInvalidNumber, number)
+	}
+	return "+" + digits, nil
+}
+
+// toInternational strips dialling prefixes and adds the default calling code
+// to national numbers. Numbers that fit no rule are assumed to carry their
+// calling code already.
+func (n *Normalizer) toInternational(digits string) string {
+	c := n.country
+
+	for _, prefix := range c.InternationalPrefixes {
+		if rest, ok := strings.CutPrefix(digits, prefix); ok && len(rest) >= minE164Digits {
+			return rest
+		}
+	}
+
+	switch {
+	case len(digits) == c.NationalLength:
+		return c.CallingCode + digits
+	case c.TrunkPrefix != "" && len(digits) == len(c.TrunkPrefix)+c.NationalLength && strings.HasPrefix(digits, c.TrunkPrefix):
+		return c.CallingCode + digits[len(c.TrunkPrefix):]
+	default:
+		return digits
+	}
+}
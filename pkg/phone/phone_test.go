@@ -0,0 +1,59 @@
+package phone
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		country string
+		number  string
+		want    string
+	}{
+		{"TM", "865123456", "+99365123456"},
+		{"TM", "65123456", "+99365123456"},
+		{"TM", "99365123456", "+99365123456"},
+		{"TM", "+99365123456", "+99365123456"},
+		{"TM", "+993 65 12-34-56", "+99365123456"},
+		{"TM", "(865) 12.34.56", "+99365123456"},
+		{"TM", "81099365123456", "+99365123456"},
+		{"TM", "0099365123456", "+99365123456"},
+		{"TM", " 865123456 ", "+99365123456"},
+		{"TM", "79161234567", "+79161234567"},
+		{"RU", "89161234567", "+79161234567"},
+		{"RU", "9161234567", "+79161234567"},
+		{"UZ", "901234567", "+998901234567"},
+		{"TR", "05321234567", "+905321234567"},
+	}
+
+	for _, tt := range tests {
+		normalizer, err := NewNormalizer(tt.country)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := normalizer.Normalize(tt.number)
+		if err != nil || got != tt.want {
+			t.Errorf("%s: Normalize(%q) = %q, %v; want %q", tt.country, tt.number, got, err, tt.want)
+		}
+	}
+}
+
+func TestNormalizeRejectsInvalidNumbers(t *testing.T) {
+	normalizer, err := NewNormalizer("tm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, number := range []string{"", "   ", "abc", "8651234x6", "++99365123456", "+9936512", "1234", "+0123456789", "+1234567890123456"} {
+		if got, err := normalizer.Normalize(number); !errors.Is(err, ErrInvalidNumber) {
+			t.Errorf("Normalize(%q) = %q, %v; want ErrInvalidNumber", number, got, err)
+		}
+	}
+}
+
+func TestNewNormalizerRejectsUnknownCountry(t *testing.T) {
+	if _, err := NewNormalizer("XX"); err == nil {
+		t.Fatal("NewNormalizer(XX) succeeded")
+	}
+}
@@ -0,0 +1,29 @@
+package utils
+
+import "testing"
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"bahar", "bahar", 0},
+		{"bahar", "bahr", 1},   // deletion
+		{"bahar", "bahars", 1}, // insertion
+		{"bahar", "baxar", 1},  // substitution
+		{"bahar", "bxhr", 2},
+		{"bahar", "BAHAR", 5}, // case sensitive
+		{"", "bahar", 5},
+		{"gün", "gun", 1}, // counted in runes
+	}
+
+	for _, tt := range tests {
+		if got := Levenshtein(tt.a, tt.b); got != tt.want {
+			t.Errorf("Levenshtein(%q, %q) = %d; want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := Levenshtein(tt.b, tt.a); got != tt.want {
+			t.Errorf("Levenshtein(%q, %q) = %d; want %d", tt.b, tt.a, got, tt.want)
+		}
+	}
+}